@@ -0,0 +1,103 @@
+package gpio
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Apply changes the pins started by Start and Apply to reqs, e.g. when a configuration is
+// reloaded: pins no longer requested are closed, new pins are opened and pins whose request
+// changed are reopened, while unchanged pins are left alone. Pins registered with Add aren't
+// touched. The change is all or nothing: conflicts are reported as a *ClaimError before
+// anything is changed, and if a pin fails to open, the pins opened so far are cleaned up
+// and the previous pins are reopened, outputs at the values they had.
+// Apply must not run concurrently with Start or another Apply on the same Manager.
+func (m *Manager) Apply(reqs ...PinRequest) (ClaimReport, error) {
+	m.mu.Lock()
+	current := make(map[string]PinRequest, len(m.started))
+	owned := make(map[uint]bool)
+	for name, req := range m.started {
+		if _, ok := m.pins[name]; ok {
+			current[name] = req
+			owned[req.Number] = true
+		}
+	}
+	m.mu.Unlock()
+
+	wanted := make(map[string]bool, len(reqs))
+	var open []PinRequest
+	for _, req := range reqs {
+		wanted[req.Name] = true
+		if prev, ok := current[req.Name]; !ok || prev != req {
+			open = append(open, req)
+		}
+	}
+	// the pins to replace are those changed or dropped
+	var release []PinRequest
+	for name, req := range current {
+		if !wanted[name] || !containsRequest(reqs, req) {
+			release = append(release, req)
+		}
+	}
+
+	report := m.Check(reqs...)
+	for i := range report {
+		c := &report[i]
+		if _, ok := current[c.Name]; ok && c.Conflict == "name already registered" {
+			c.Conflict = ""
+		}
+		if owned[c.Number] && strings.HasPrefix(c.Conflict, "line is held by") {
+			c.Conflict = ""
+		}
+	}
+	if conflicts := report.Conflicts(); len(conflicts) != 0 {
+		return report, &ClaimError{Conflicts: conflicts}
+	}
+	if len(open) == 0 && len(release) == 0 {
+		return report, nil
+	}
+
+	// outputs are reopened at their current values on rollback
+	values := make(map[string]bool)
+	for _, req := range release {
+		p, _ := m.forget(req.Name)
+		if req.Output {
+			v, err := p.Read()
+			values[req.Name] = req.InitHigh
+			if err == nil {
+				values[req.Name] = v == 1
+			}
+		}
+		p.Close()
+	}
+	for i, req := range open {
+		err := m.startPin(req, req.InitHigh)
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("failed to apply %s: %s", req.Name, err)
+		for _, done := range open[:i] {
+			if p, ok := m.forget(done.Name); ok {
+				p.Cleanup()
+			}
+		}
+		for _, prev := range release {
+			if rerr := m.startPin(prev, values[prev.Name]); rerr != nil {
+				logger().Error("failed to restore pin", "name", prev.Name, "pin", prev.Number, "err", rerr)
+				err = fmt.Errorf("%s, and failed to restore %s: %s", err, prev.Name, rerr)
+			}
+		}
+		return report, err
+	}
+	logger().Info("applied pin configuration", "opened", len(open), "released", len(release))
+	return report, nil
+}
+
+func containsRequest(reqs []PinRequest, req PinRequest) bool {
+	for _, r := range reqs {
+		if r == req {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package gpio
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Priority ranks the requests of the sources of an Arbiter, higher priorities win
+type Priority uint
+
+const (
+	// PriorityAutomation is the priority of the normal control of an output
+	PriorityAutomation Priority = iota
+	// PrioritySafety is the priority of interlocks overriding the automation
+	PrioritySafety
+	// PriorityOverride is the priority of an operator manually overriding everything else
+	PriorityOverride
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityAutomation:
+		return "automation"
+	case PrioritySafety:
+		return "safety"
+	case PriorityOverride:
+		return "override"
+	}
+	return fmt.Sprintf("priority %d", uint(p))
+}
+
+// Arbitration is the outcome of the requests made to an Arbiter. Source is the name of the
+// winning source, empty when no source has a request and the idle value is applied.
+type Arbitration struct {
+	Value    uint
+	Source   string
+	Priority Priority
+}
+
+// Arbiter lets several components request a value for the same output. The request of the
+// highest priority wins, the latest one among requests of the same priority, and the output
+// is driven to the idle value when no source has a request.
+type Arbiter struct {
+	w    Writer
+	idle uint
+
+	mu      sync.Mutex
+	sources map[string]*ArbiterSource
+	seq     uint64
+	result  Arbitration
+	// applied is false until the result was written successfully
+	applied bool
+}
+
+// ArbiterSource is a component requesting values from an Arbiter
+type ArbiterSource struct {
+	a        *Arbiter
+	name     string
+	priority Priority
+
+	active bool
+	value  uint
+	seq    uint64
+}
+
+// NewArbiter creates an Arbiter for w and drives it to idle
+func NewArbiter(w Writer, idle uint) (*Arbiter, error) {
+	a := &Arbiter{
+		w:       w,
+		idle:    idle,
+		sources: make(map[string]*ArbiterSource),
+	}
+	a.result = Arbitration{Value: idle}
+	if err := Write(w, idle); err != nil {
+		return nil, err
+	}
+	a.applied = true
+	return a, nil
+}
+
+// Source registers a component under a unique name, making requests with the given priority
+func (a *Arbiter) Source(name string, priority Priority) (*ArbiterSource, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, ok := a.sources[name]; ok {
+		return nil, fmt.Errorf("arbiter source %q already exists", name)
+	}
+	s := &ArbiterSource{a: a, name: name, priority: priority}
+	a.sources[name] = s
+	return s, nil
+}
+
+// Result returns the current outcome of the arbitration
+func (a *Arbiter) Result() Arbitration {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.result
+}
+
+// Request asks for the output to be driven to v, until the next request or Release.
+// The error is the one of writing the output if this changed the result, in which case the
+// request is kept and the write is attempted again at the next change.
+func (s *ArbiterSource) Request(v uint) error {
+	if v != 0 && v != 1 {
+		return &PinError{Kind: ErrInvalidValue, Err: fmt.Errorf("invalid output value %d", v)}
+	}
+	a := s.a
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.seq++
+	s.active, s.value, s.seq = true, v, a.seq
+	return a.resolve()
+}
+
+// High requests the output to be high, so that a source can be used as a Writer
+func (s *ArbiterSource) High() error {
+	return s.Request(1)
+}
+
+// Low requests the output to be low
+func (s *ArbiterSource) Low() error {
+	return s.Request(0)
+}
+
+// Release withdraws the request of the source, handing the output to the others
+func (s *ArbiterSource) Release() error {
+	a := s.a
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s.active = false
+	return a.resolve()
+}
+
+// resolve finds the winning request and applies its value if it changed
+func (a *Arbiter) resolve() error {
+	var win *ArbiterSource
+	for _, s := range a.sources {
+		if !s.active {
+			continue
+		}
+		if win == nil || s.priority > win.priority || (s.priority == win.priority && s.seq > win.seq) {
+			win = s
+		}
+	}
+	result := Arbitration{Value: a.idle}
+	if win != nil {
+		result = Arbitration{Value: win.value, Source: win.name, Priority: win.priority}
+	}
+	changed := !a.applied || result.Value != a.result.Value
+	a.result = result
+	if !changed {
+		return nil
+	}
+	a.applied = false
+	if err := Write(a.w, result.Value); err != nil {
+		return err
+	}
+	a.applied = true
+	return nil
+}
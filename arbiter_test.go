@@ -0,0 +1,82 @@
+package gpio
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestArbiterResolution(t *testing.T) {
+	w := &testWriter{}
+	a, err := NewArbiter(w, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auto, _ := a.Source("auto", PriorityAutomation)
+	safety, _ := a.Source("safety", PrioritySafety)
+	if _, err := a.Source("auto", PriorityOverride); err == nil {
+		t.Fatal("a source name was registered twice")
+	}
+
+	check := func(want Arbitration) {
+		t.Helper()
+		if got := a.Result(); got != want {
+			t.Fatalf("result = %+v, want %+v", got, want)
+		}
+	}
+	auto.High()
+	check(Arbitration{Value: 1, Source: "auto", Priority: PriorityAutomation})
+	// a higher priority wins whatever the order
+	safety.Low()
+	check(Arbitration{Value: 0, Source: "safety", Priority: PrioritySafety})
+	auto.High()
+	check(Arbitration{Value: 0, Source: "safety", Priority: PrioritySafety})
+	safety.Release()
+	check(Arbitration{Value: 1, Source: "auto", Priority: PriorityAutomation})
+	auto.Release()
+	check(Arbitration{Value: 0})
+
+	// the idle value, then only the changes of the result are written
+	if want := []uint{0, 1, 0, 1, 0}; !reflect.DeepEqual(w.values, want) {
+		t.Fatalf("writes = %v, want %v", w.values, want)
+	}
+}
+
+// The latest request wins among requests of the same priority
+func TestArbiterLatestRequestWins(t *testing.T) {
+	a, err := NewArbiter(&testWriter{}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, _ := a.Source("first", PriorityAutomation)
+	second, _ := a.Source("second", PriorityAutomation)
+	second.High()
+	first.Low()
+	if got := a.Result(); got.Source != "first" || got.Value != 0 {
+		t.Fatalf("result = %+v, want the request of first", got)
+	}
+	first.Release()
+	if got := a.Result(); got.Source != "second" || got.Value != 1 {
+		t.Fatalf("result = %+v, want the request of second", got)
+	}
+}
+
+// A failed write is attempted again at the next change of the result
+func TestArbiterRetriesFailedWrites(t *testing.T) {
+	w := &testWriter{}
+	a, err := NewArbiter(w, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, _ := a.Source("auto", PriorityAutomation)
+	w.fail = true
+	if err := s.High(); err == nil {
+		t.Fatal("the failed write wasn't returned")
+	}
+	w.fail = false
+	if err := s.High(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint{0, 1}; !reflect.DeepEqual(w.values, want) {
+		t.Fatalf("writes = %v, want %v", w.values, want)
+	}
+}
@@ -0,0 +1,81 @@
+package gpio
+
+import (
+	"encoding/json"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// AuditSource identifies where a write operation came from
+type AuditSource string
+
+const (
+	// AuditSourceLocal is used for writes made through this package's API
+	AuditSourceLocal AuditSource = "local"
+)
+
+// AuditRecord describes a single write operation on a pin
+// Caller is the function which requested the write, when it is known
+type AuditRecord struct {
+	Time   time.Time   `json:"time"`
+	Pin    uint        `json:"pin"`
+	Value  uint        `json:"value"`
+	Source AuditSource `json:"source"`
+	Caller string      `json:"caller,omitempty"`
+	Err    string      `json:"error,omitempty"`
+}
+
+// AuditHook is called once for every write operation, after the write has been attempted
+type AuditHook func(AuditRecord)
+
+var (
+	auditMu   sync.RWMutex
+	auditHook AuditHook
+)
+
+// SetAuditHook installs a hook which records all write operations.
+// Passing nil disables auditing.
+func SetAuditHook(h AuditHook) {
+	auditMu.Lock()
+	auditHook = h
+	auditMu.Unlock()
+}
+
+// NewJSONAuditHook returns an AuditHook which writes each record to w as one line of JSON
+func NewJSONAuditHook(w io.Writer) AuditHook {
+	var mu sync.Mutex
+	enc := json.NewEncoder(w)
+	return func(r AuditRecord) {
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(r)
+	}
+}
+
+// audit reports a write to the installed hook, if any.
+// skip is the number of stack frames between audit and the public API caller.
+func audit(skip int, source AuditSource, pin uint, value uint, err error) {
+	auditMu.RLock()
+	h := auditHook
+	auditMu.RUnlock()
+	if h == nil {
+		return
+	}
+	r := AuditRecord{
+		Time:   time.Now(),
+		Pin:    pin,
+		Value:  value,
+		Source: source,
+	}
+	if pc, _, _, ok := runtime.Caller(skip + 1); ok {
+		if fn := runtime.FuncForPC(pc); fn != nil {
+			r.Caller = fn.Name()
+		}
+	}
+	if err != nil {
+		r.Err = err.Error()
+	}
+	h(r)
+}
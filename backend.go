@@ -0,0 +1,345 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// Backend selects the kernel interface used to open pins
+type Backend uint
+
+const (
+	// BackendAuto uses the character devices when the system has any, and sysfs otherwise
+	BackendAuto Backend = iota
+	// BackendSysfs uses the deprecated /sys/class/gpio interface
+	BackendSysfs
+	// BackendChardev uses the gpio character devices /dev/gpiochipN through the v2 uAPI.
+	// Pin numbers count the lines of all chips in the order of their device numbers,
+	// so on most boards they match the numbers used with sysfs for the first chip.
+	BackendChardev
+	// BackendGPIOMem drives the pins of the Raspberry Pi 1 to 4 through the registers mapped
+	// from /dev/gpiomem, for bit banging at MHz rates. Pins are numbered by BCM number.
+	// Edges aren't reported, and the kernel doesn't keep anyone else from using the pins.
+	BackendGPIOMem
+)
+
+func (b Backend) String() string {
+	switch b {
+	case BackendAuto:
+		return "auto"
+	case BackendSysfs:
+		return "sysfs"
+	case BackendChardev:
+		return "chardev"
+	case BackendGPIOMem:
+		return "gpiomem"
+	}
+	return fmt.Sprintf("backend %d", uint(b))
+}
+
+var (
+	backendMu sync.RWMutex
+	backend   = BackendAuto
+	mock      *Mock
+)
+
+// SetBackend selects the backend used by the pins opened afterwards. Pins which are already
+// open keep the backend they were opened with. The default is BackendAuto.
+func SetBackend(b Backend) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	backend = b
+}
+
+func installedMock() *Mock {
+	backendMu.RLock()
+	defer backendMu.RUnlock()
+	return mock
+}
+
+func currentBackend() Backend {
+	backendMu.RLock()
+	defer backendMu.RUnlock()
+	return backend
+}
+
+func useChardev() bool {
+	switch currentBackend() {
+	case BackendSysfs:
+		return false
+	case BackendChardev:
+		return true
+	case BackendGPIOMem:
+		return false
+	}
+	if chardevAvailable() {
+		return true
+	}
+	// without either of them opening fails with the error of the character devices
+	_, err := os.Stat(sysfsRoot)
+	return err != nil
+}
+
+// lineKind returns the backend a line was opened with, nil being a sysfs pin. Mock lines
+// stand in for character device lines.
+func lineKind(line lineBackend) Backend {
+	switch line.(type) {
+	case nil:
+		return BackendSysfs
+	case *memLine:
+		return BackendGPIOMem
+	}
+	return BackendChardev
+}
+
+// chardevNumbering reports whether pins are numbered like the lines of the character devices,
+// which the gpiomem backend does too since the SoC's chip comes first
+func chardevNumbering() bool {
+	return useChardev() || currentBackend() == BackendGPIOMem
+}
+
+// errNoChardev is returned when the character device backend is used on a system without it
+var errNoChardev = errors.New("gpio character devices are not supported on this system")
+
+// errNeedsSysfs is returned by operations which only the sysfs backend supports
+var errNeedsSysfs = errors.New("operation needs the sysfs gpio backend")
+
+// lineBackend is a line of a backend other than sysfs. A copy of a Pin shares it, so that
+// the configuration replaced as a whole on reconfiguration stays consistent between copies.
+// The fd returned by request must become readable when an edge event is pending.
+type lineBackend interface {
+	setDirection(d Direction, initialValue uint) error
+	setEdge(e Edge) error
+	setLogicLevel(l LogicLevel) error
+	request() (*os.File, error)
+	reconfigure(f *os.File) error
+	getValue(f *os.File) (uint, error)
+	setValue(f *os.File, v uint) error
+	info() (uint64, error)
+	drain(f *os.File) error
+	events(f *os.File) ([]lineEdge, error)
+	setEventClock(c EventClock) error
+}
+
+// lineEdge is an edge event of a line
+type lineEdge struct {
+	// stamp is the timestamp of the backend's clock, at is the same time on the wall clock
+	stamp  time.Duration
+	at     time.Time
+	rising bool
+}
+
+// lineConfig is the configuration of a line, in the flags of the v2 uAPI
+type lineConfig struct {
+	mu sync.Mutex
+	// flags are the line flags the line is requested with
+	flags uint64
+	// value is the last value set on an output, kept across reconfigurations
+	value uint
+}
+
+// FindLine opens the line with the given name, e.g. "LED_STATUS", configured by opts like
+// NewPin. Line names come from the device tree and stay the same across board revisions
+// which move the lines to other numbers.
+func FindLine(name string, opts ...PinOption) (Pin, error) {
+	n, err := LineNumber(name)
+	if err != nil {
+		return Pin{}, err
+	}
+	return NewPin(n, opts...)
+}
+
+// LineNumber returns the pin number of the line with the given name on the backend in use.
+// When several lines have the name, the first one in the order of the chips is returned.
+func LineNumber(name string) (uint, error) {
+	if m := installedMock(); m != nil {
+		if n, ok := m.findLine(name); ok {
+			return n, nil
+		}
+		return 0, fmt.Errorf("no gpio line is named %q", name)
+	}
+	// names are only reported by the character devices, also when pins are opened with sysfs
+	line, ok, err := findLineName(name)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, fmt.Errorf("no gpio line is named %q", name)
+	}
+	if chardevNumbering() {
+		return line.number, nil
+	}
+	base, err := sysfsChipBase(line.label, line.lines)
+	if err != nil {
+		return 0, err
+	}
+	return base + uint(line.offset), nil
+}
+
+// cdevLine is a line of a gpio character device
+type cdevLine struct {
+	lineConfig
+	chip   string
+	offset uint32
+}
+
+// newPin returns an unopened pin for the given number on the selected backend
+func newPin(n uint) (Pin, error) {
+	pin := Pin{
+		Number: n,
+	}
+	if m := installedMock(); m != nil {
+		pin.line = m.line(n)
+		return pin, nil
+	}
+	if currentBackend() == BackendGPIOMem {
+		line, err := newMemLine(n)
+		if err != nil {
+			return Pin{}, err
+		}
+		pin.line = line
+		return pin, nil
+	}
+	if !useChardev() {
+		return pin, nil
+	}
+	line, err := lookupLine(n)
+	if err != nil {
+		return Pin{}, err
+	}
+	pin.line = line
+	return pin, nil
+}
+
+// lineEvent is struct gpio_v2_line_event, read from a request fd for each edge
+type lineEvent struct {
+	timestampNs uint64
+	id          uint32
+	offset      uint32
+	seqno       uint32
+	lineSeqno   uint32
+	padding     [6]uint32
+}
+
+const lineEventSize = int(unsafe.Sizeof(lineEvent{}))
+
+const (
+	lineEventRising  = 1
+	lineEventFalling = 2
+)
+
+// line flags of the v2 uAPI
+const (
+	lineFlagUsed        uint64 = 1 << 0
+	lineFlagActiveLow   uint64 = 1 << 1
+	lineFlagInput       uint64 = 1 << 2
+	lineFlagOutput      uint64 = 1 << 3
+	lineFlagEdgeRising  uint64 = 1 << 4
+	lineFlagEdgeFalling uint64 = 1 << 5
+	// lineFlagEventClockRealtime timestamps edge events on CLOCK_REALTIME
+	lineFlagEventClockRealtime uint64 = 1 << 11
+)
+
+func flagsDirection(flags uint64) Direction {
+	if flags&lineFlagOutput != 0 {
+		return DirectionOut
+	}
+	return DirectionIn
+}
+
+func flagsEdge(flags uint64) Edge {
+	switch flags & (lineFlagEdgeRising | lineFlagEdgeFalling) {
+	case lineFlagEdgeRising:
+		return EdgeRising
+	case lineFlagEdgeFalling:
+		return EdgeFalling
+	case lineFlagEdgeRising | lineFlagEdgeFalling:
+		return EdgeBoth
+	}
+	return EdgeNone
+}
+
+// lineStampTime converts the timestamp of an edge event to wall clock time, from the clock
+// selected by flags. now and mono are the same time on the wall clock and CLOCK_MONOTONIC.
+func lineStampTime(flags uint64, stamp time.Duration, now time.Time, mono time.Duration) time.Time {
+	if flags&lineFlagEventClockRealtime != 0 {
+		return time.Unix(0, int64(stamp))
+	}
+	return now.Add(stamp - mono)
+}
+
+func flagsLogicLevel(flags uint64) LogicLevel {
+	if flags&lineFlagActiveLow != 0 {
+		return ActiveLow
+	}
+	return ActiveHigh
+}
+
+// setDirection changes the requested direction. Edge detection is only available on inputs
+func (l *lineConfig) setDirection(d Direction, initialValue uint) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case d == DirectionIn:
+		l.flags &^= lineFlagOutput
+		l.flags |= lineFlagInput
+	case d == DirectionOut && initialValue <= 1:
+		l.flags &^= lineFlagInput | lineFlagEdgeRising | lineFlagEdgeFalling
+		l.flags |= lineFlagOutput
+		l.value = initialValue
+	default:
+		return fmt.Errorf("setDirection called with invalid direction or initialValue: %d, %d", d, initialValue)
+	}
+	return nil
+}
+
+func (l *lineConfig) setEdge(e Edge) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.flags &^= lineFlagEdgeRising | lineFlagEdgeFalling
+	switch e {
+	case EdgeNone:
+	case EdgeRising:
+		l.flags |= lineFlagEdgeRising
+	case EdgeFalling:
+		l.flags |= lineFlagEdgeFalling
+	case EdgeBoth:
+		l.flags |= lineFlagEdgeRising | lineFlagEdgeFalling
+	default:
+		return fmt.Errorf("setEdgeTrigger called with invalid edge %d", e)
+	}
+	return nil
+}
+
+func (l *lineConfig) setLogicLevel(level LogicLevel) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch level {
+	case ActiveHigh:
+		l.flags &^= lineFlagActiveLow
+	case ActiveLow:
+		l.flags |= lineFlagActiveLow
+	default:
+		return errors.New("invalid logic level setting")
+	}
+	return nil
+}
+
+// setEventClock selects the clock timestamping edge events
+func (l *lineConfig) setEventClock(c EventClock) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch c {
+	case EventClockMonotonic:
+		l.flags &^= lineFlagEventClockRealtime
+	case EventClockRealtime:
+		l.flags |= lineFlagEventClockRealtime
+	default:
+		return fmt.Errorf("invalid event clock %d", c)
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package gpio
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Board maps the header of a board to the gpio lines of its SoC, so that pins can be opened
+// by their position on the header or the name of the SoC pin instead of kernel numbers,
+// which depend on the backend and the kernel
+type Board struct {
+	Name string
+	pins []BoardPin
+}
+
+// BoardPin is a gpio pin on the header of a Board
+type BoardPin struct {
+	// Header is the position of the pin on the header, e.g. "11" or "P8_3"
+	Header string
+	// Name is the name of the SoC pin, e.g. "BCM17", "GPIO1_6" or "PA1"
+	Name string
+	// Number is the customary number of the pin on the board, e.g. the BCM number. Kernels
+	// which number chips dynamically may not use it, see Resolve. Mock lines are numbered so.
+	Number uint
+
+	board string
+	// chips are the labels the chip of the pin has on the supported SoCs and kernels
+	chips  []string
+	offset uint
+}
+
+// Header returns the gpio pin at a position of the header, e.g. "11" on the Raspberry Pi
+func (b *Board) Header(position string) (BoardPin, error) {
+	for _, p := range b.pins {
+		if p.Header == position {
+			return p, nil
+		}
+	}
+	return BoardPin{}, fmt.Errorf("pin %s of the %s header isn't a gpio", position, b.Name)
+}
+
+// Pin returns the pin with the given SoC name, e.g. "BCM17" on the Raspberry Pi
+func (b *Board) Pin(name string) (BoardPin, error) {
+	for _, p := range b.pins {
+		if strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+	}
+	return BoardPin{}, fmt.Errorf("the %s header has no pin %s", b.Name, name)
+}
+
+// Pins returns the gpio pins of the header in the order of their positions
+func (b *Board) Pins() []BoardPin {
+	return append([]BoardPin(nil), b.pins...)
+}
+
+// Resolve returns the pin number of p on the backend in use, by finding its chip
+func (p BoardPin) Resolve() (uint, error) {
+	if installedMock() != nil {
+		return p.Number, nil
+	}
+	if chardevNumbering() {
+		chips, err := Chips()
+		if err != nil {
+			return 0, err
+		}
+		for _, chip := range chips {
+			if p.onChip(chip.Label) && p.offset < uint(len(chip.Lines)) {
+				return chip.Lines[p.offset].Number, nil
+			}
+		}
+	} else {
+		for _, label := range p.chips {
+			if base, err := sysfsChipBase(label, 0); err == nil {
+				return base + p.offset, nil
+			}
+		}
+	}
+	return 0, fmt.Errorf("the gpio chip of %s %s isn't on this system", p.board, p.Name)
+}
+
+func (p BoardPin) onChip(label string) bool {
+	for _, l := range p.chips {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// Open opens the pin configured by opts like NewPin
+func (p BoardPin) Open(opts ...PinOption) (Pin, error) {
+	n, err := p.Resolve()
+	if err != nil {
+		return Pin{}, err
+	}
+	return NewPin(n, opts...)
+}
+
+// RPiBoard is the 40 pin header of the Raspberry Pi, whose pins are also fields named after
+// their BCM numbers. The header of the Raspberry Pi 5 has the same pins on the RP1.
+type RPiBoard struct {
+	Board
+	BCM0, BCM1, BCM2, BCM3, BCM4, BCM5, BCM6, BCM7, BCM8, BCM9           BoardPin
+	BCM10, BCM11, BCM12, BCM13, BCM14, BCM15, BCM16, BCM17, BCM18, BCM19 BoardPin
+	BCM20, BCM21, BCM22, BCM23, BCM24, BCM25, BCM26, BCM27               BoardPin
+}
+
+// rpiHeader are the gpio pins of the Raspberry Pi header by position and BCM number
+var rpiHeader = [][2]uint{
+	{3, 2}, {5, 3}, {7, 4}, {8, 14}, {10, 15}, {11, 17}, {12, 18}, {13, 27}, {15, 22}, {16, 23},
+	{18, 24}, {19, 10}, {21, 9}, {22, 25}, {23, 11}, {24, 8}, {26, 7}, {27, 0}, {28, 1}, {29, 5},
+	{31, 6}, {32, 12}, {33, 13}, {35, 19}, {36, 16}, {37, 26}, {38, 20}, {40, 21},
+}
+
+// bbHeaders are the gpio pins of the P8 and P9 headers of the BeagleBone, numbered bank*32+bit
+var bbHeaders = []struct {
+	header string
+	number uint
+}{
+	{"P8_3", 38}, {"P8_4", 39}, {"P8_5", 34}, {"P8_6", 35}, {"P8_7", 66}, {"P8_8", 67},
+	{"P8_9", 69}, {"P8_10", 68}, {"P8_11", 45}, {"P8_12", 44}, {"P8_13", 23}, {"P8_14", 26},
+	{"P8_15", 47}, {"P8_16", 46}, {"P8_17", 27}, {"P8_18", 65}, {"P8_19", 22}, {"P8_20", 63},
+	{"P8_21", 62}, {"P8_22", 37}, {"P8_23", 36}, {"P8_24", 33}, {"P8_25", 32}, {"P8_26", 61},
+	{"P8_27", 86}, {"P8_28", 88}, {"P8_29", 87}, {"P8_30", 89}, {"P8_31", 10}, {"P8_32", 11},
+	{"P8_33", 9}, {"P8_34", 81}, {"P8_35", 8}, {"P8_36", 80}, {"P8_37", 78}, {"P8_38", 79},
+	{"P8_39", 76}, {"P8_40", 77}, {"P8_41", 74}, {"P8_42", 75}, {"P8_43", 72}, {"P8_44", 73},
+	{"P8_45", 70}, {"P8_46", 71},
+	{"P9_11", 30}, {"P9_12", 60}, {"P9_13", 31}, {"P9_14", 50}, {"P9_15", 48}, {"P9_16", 51},
+	{"P9_17", 5}, {"P9_18", 4}, {"P9_21", 3}, {"P9_22", 2}, {"P9_23", 49}, {"P9_24", 15},
+	{"P9_25", 117}, {"P9_26", 14}, {"P9_27", 115}, {"P9_28", 113}, {"P9_29", 111}, {"P9_30", 112},
+	{"P9_31", 110}, {"P9_41", 20}, {"P9_42", 7},
+}
+
+// opiHeader are the gpio pins of the Orange Pi PC header by position and port*32+n
+var opiHeader = [][2]uint{
+	{3, 12}, {5, 11}, {7, 6}, {8, 13}, {10, 14}, {11, 1}, {12, 110}, {13, 0}, {15, 3}, {16, 68},
+	{18, 71}, {19, 64}, {21, 65}, {22, 2}, {23, 66}, {24, 67}, {26, 21}, {27, 19}, {28, 18}, {29, 7},
+	{31, 8}, {32, 200}, {33, 9}, {35, 10}, {36, 201}, {37, 20}, {38, 198}, {40, 199},
+}
+
+var (
+	// RPi is the Raspberry Pi, e.g. gpio.RPi.BCM17.Open(options...) or gpio.RPi.Header("11")
+	RPi = newRPi()
+	// BeagleBone is the BeagleBone Black, whose header positions are named like "P8_3"
+	BeagleBone = newBeagleBone()
+	// OrangePiPC is the Orange Pi PC with the Allwinner H3, and the boards sharing its 40 pin
+	// header such as the PC Plus
+	OrangePiPC = newOrangePiPC()
+)
+
+func newRPi() *RPiBoard {
+	b := &RPiBoard{Board: Board{Name: "Raspberry Pi"}}
+	chips := []string{"pinctrl-bcm2835", "pinctrl-bcm2711", "pinctrl-rp1"}
+	bcm := make(map[uint]BoardPin)
+	for _, h := range rpiHeader {
+		p := BoardPin{
+			Header: fmt.Sprint(h[0]),
+			Name:   fmt.Sprintf("BCM%d", h[1]),
+			Number: h[1],
+			board:  b.Name,
+			chips:  chips,
+			offset: h[1],
+		}
+		b.pins = append(b.pins, p)
+		bcm[h[1]] = p
+	}
+	b.BCM0, b.BCM1, b.BCM2, b.BCM3, b.BCM4 = bcm[0], bcm[1], bcm[2], bcm[3], bcm[4]
+	b.BCM5, b.BCM6, b.BCM7, b.BCM8, b.BCM9 = bcm[5], bcm[6], bcm[7], bcm[8], bcm[9]
+	b.BCM10, b.BCM11, b.BCM12, b.BCM13, b.BCM14 = bcm[10], bcm[11], bcm[12], bcm[13], bcm[14]
+	b.BCM15, b.BCM16, b.BCM17, b.BCM18, b.BCM19 = bcm[15], bcm[16], bcm[17], bcm[18], bcm[19]
+	b.BCM20, b.BCM21, b.BCM22, b.BCM23, b.BCM24 = bcm[20], bcm[21], bcm[22], bcm[23], bcm[24]
+	b.BCM25, b.BCM26, b.BCM27 = bcm[25], bcm[26], bcm[27]
+	return b
+}
+
+func newBeagleBone() *Board {
+	b := &Board{Name: "BeagleBone"}
+	for _, h := range bbHeaders {
+		bank, bit := h.number/32, h.number%32
+		b.pins = append(b.pins, BoardPin{
+			Header: h.header,
+			Name:   fmt.Sprintf("GPIO%d_%d", bank, bit),
+			Number: h.number,
+			board:  b.Name,
+			// the label given by the omap gpio driver to each bank
+			chips:  []string{fmt.Sprintf("gpio-%d-%d", bank*32, bank*32+31)},
+			offset: bit,
+		})
+	}
+	return b
+}
+
+func newOrangePiPC() *Board {
+	b := &Board{Name: "Orange Pi PC"}
+	for _, h := range opiHeader {
+		b.pins = append(b.pins, BoardPin{
+			Header: fmt.Sprint(h[0]),
+			Name:   fmt.Sprintf("P%c%d", 'A'+rune(h[1]/32), h[1]%32),
+			Number: h[1],
+			board:  b.Name,
+			chips:  []string{"1c20800.pinctrl"},
+			offset: h[1],
+		})
+	}
+	return b
+}
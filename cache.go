@@ -0,0 +1,72 @@
+package gpio
+
+import (
+	"sync"
+	"time"
+)
+
+// readCache shares reads of an input between callers.
+// A value is reused while less than maxAge has passed since the read returning it started,
+// and callers arriving while a read is in flight wait for it instead of reading again.
+type readCache struct {
+	maxAge time.Duration
+
+	mu       sync.Mutex
+	value    uint
+	at       time.Time
+	valid    bool
+	inflight chan struct{}
+	err      error
+}
+
+// WithReadCache returns a copy of an input pin whose Read calls are served from a cache
+// shared by all copies of the returned pin. A value returned by Read is never older than
+// maxAge, counted from the start of the read which produced it. Errors are not cached.
+// This is meant for hot paths polling the same input from many goroutines.
+func (p Pin) WithReadCache(maxAge time.Duration) Pin {
+	p.cache = &readCache{maxAge: maxAge}
+	return p
+}
+
+func (c *readCache) read(p Pin) (uint, error) {
+	c.mu.Lock()
+	for {
+		if c.valid && time.Since(c.at) < c.maxAge {
+			v := c.value
+			c.mu.Unlock()
+			return v, nil
+		}
+		if c.inflight == nil {
+			break
+		}
+		// wait for the read in flight, whose value is reused unless it started more than
+		// maxAge ago, in which case the loop reads again
+		done := c.inflight
+		c.mu.Unlock()
+		<-done
+		c.mu.Lock()
+		if c.err != nil {
+			err := c.err
+			c.mu.Unlock()
+			return 0, err
+		}
+	}
+	done := make(chan struct{})
+	c.inflight = done
+	c.mu.Unlock()
+
+	start := time.Now()
+	v, err := readPin(p)
+
+	c.mu.Lock()
+	c.inflight = nil
+	c.err = err
+	if err == nil {
+		c.value = v
+		c.at = start
+		c.valid = true
+	}
+	c.mu.Unlock()
+	close(done)
+	return v, err
+}
@@ -0,0 +1,96 @@
+package gpio
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Callback is a handler registered with OnRising, OnFalling or OnChange
+type Callback struct {
+	s       *eventStream
+	edge    Edge
+	fn      func(Event)
+	removed int32
+}
+
+// OnRising runs fn for each rising edge of the input, see OnChange
+func (p Pin) OnRising(fn func(Event)) (*Callback, error) {
+	return p.onEdge(EdgeRising, fn)
+}
+
+// OnFalling runs fn for each falling edge of the input, see OnChange
+func (p Pin) OnFalling(fn func(Event)) (*Callback, error) {
+	return p.onEdge(EdgeFalling, fn)
+}
+
+// OnChange runs fn for each edge of the input, the same edges Events delivers.
+// The callbacks of a pin run one at a time, in the order of the edges, on a goroutine which
+// stops when the pin is closed. A callback which panics is recovered and reported. Edges are
+// dropped when the callbacks fall behind, which shows as a gap in Seq.
+func (p Pin) OnChange(fn func(Event)) (*Callback, error) {
+	return p.onEdge(EdgeBoth, fn)
+}
+
+func (p Pin) onEdge(edge Edge, fn func(Event)) (*Callback, error) {
+	if fn == nil {
+		return nil, fmt.Errorf("no callback given for gpio %d", p.Number)
+	}
+	s, err := p.eventStream()
+	if err != nil {
+		return nil, err
+	}
+	if edge != EdgeBoth && s.edge != EdgeBoth && s.edge != edge {
+		return nil, fmt.Errorf("gpio %d wasn't opened with the edge of the callback", p.Number)
+	}
+	c := &Callback{s: s, edge: edge, fn: fn}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.done {
+		return nil, errClosed(p.Number)
+	}
+	if s.calls == nil {
+		calls := make(chan func(), edgeEventLen)
+		s.calls = calls
+		spawn("Callbacks", []uint{p.Number}, func() {
+			for call := range calls {
+				call()
+			}
+		})
+	}
+	s.callbacks = append(s.callbacks, c)
+	return c, nil
+}
+
+// Unregister stops running the callback. It may still be running when Unregister returns,
+// but isn't started again.
+func (c *Callback) Unregister() {
+	atomic.StoreInt32(&c.removed, 1)
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+	for i, other := range c.s.callbacks {
+		if other == c {
+			c.s.callbacks = append(c.s.callbacks[:i:i], c.s.callbacks[i+1:]...)
+			return
+		}
+	}
+}
+
+// callBack queues the callbacks for ev. s.mu must be held
+func (s *eventStream) callBack(ev Event) {
+	if len(s.callbacks) == 0 {
+		return
+	}
+	callbacks := s.callbacks
+	call := func() {
+		for _, c := range callbacks {
+			if (c.edge == EdgeBoth || c.edge == ev.Edge) && atomic.LoadInt32(&c.removed) == 0 {
+				runHandler(func() { c.fn(ev) })
+			}
+		}
+	}
+	select {
+	case s.calls <- call:
+	default:
+		logger().Warn("pin callbacks fell behind, dropping edge", "pin", ev.Pin, "seq", ev.Seq)
+	}
+}
@@ -0,0 +1,100 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Capabilities is a set of features of a pin, as far as this package can use them on the
+// backend in use
+type Capabilities uint
+
+const (
+	// CapEdges is set for pins which can report edges, to Watch, Watchers and WaitForEdge
+	CapEdges Capabilities = 1 << iota
+	// CapBias is set where SetPull can configure the pull resistor
+	CapBias
+	// CapDebounce is set where the kernel debounces edges. WithDebounce works on every pin.
+	CapDebounce
+	// CapOpenDrain is set where outputs can be configured as open drain. Elsewhere open drain
+	// buses are emulated by switching between SetInput and SetOutput(Inactive).
+	CapOpenDrain
+	// CapFastToggle is set where writes are single ioctls rather than file writes, which
+	// suits bit banging
+	CapFastToggle
+	// CapDriveStrength is set where SetDriveStrength and SetSlewRate are supported
+	CapDriveStrength
+)
+
+var capNames = []string{"edges", "bias", "kernel debounce", "open drain", "fast toggling", "drive strength"}
+
+func (c Capabilities) String() string {
+	var names []string
+	for i, name := range capNames {
+		if c&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// ErrUnsupported is the kind of errors for features a pin lacks, see Require
+var ErrUnsupported = errors.New("gpio feature is not supported")
+
+// LineCapabilities returns the capabilities of the pin numbered pin on the backend which
+// pins opened now would use. The pin doesn't need to be open, but the edge capability of
+// a sysfs pin is only known once it is exported.
+func LineCapabilities(pin uint) (Capabilities, error) {
+	p, err := newPin(pin)
+	if err != nil {
+		return 0, err
+	}
+	return p.Capabilities()
+}
+
+// Capabilities returns the capabilities of p on the backend it was opened with,
+// see LineCapabilities
+func (p Pin) Capabilities() (Capabilities, error) {
+	// character device lines and mock lines report edges and are written with a call, while
+	// gpiomem lines are written with a store
+	c := CapEdges | CapFastToggle
+	if _, ok := p.line.(*memLine); ok {
+		c = CapFastToggle
+	}
+	if p.line == nil {
+		c = 0
+		// sysfs only has an edge file for pins whose chip can raise interrupts
+		if _, err := os.Stat(pinPath(p, "edge")); err == nil || !isExported(p) {
+			c |= CapEdges
+		}
+	}
+	if ctl, err := Pinctrl(); err == nil {
+		c |= CapDriveStrength
+		if _, ok := ctl.(PullProvider); ok {
+			c |= CapBias
+		}
+	}
+	return c, nil
+}
+
+// Require returns an error of kind ErrUnsupported naming the capabilities of needs p lacks,
+// so that drivers can fail at once rather than on first use
+func (p Pin) Require(needs Capabilities) error {
+	c, err := p.Capabilities()
+	if err != nil {
+		return err
+	}
+	if missing := needs &^ c; missing != 0 {
+		return &PinError{
+			Pin:  p.Number,
+			Kind: ErrUnsupported,
+			Err:  fmt.Errorf("gpio %d doesn't support %s", p.Number, missing),
+		}
+	}
+	return nil
+}
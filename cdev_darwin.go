@@ -0,0 +1,72 @@
+package gpio
+
+import (
+	"os"
+)
+
+func chardevAvailable() bool {
+	return false
+}
+
+func lookupLine(n uint) (*cdevLine, error) {
+	return nil, errNoChardev
+}
+
+func (l *cdevLine) request() (*os.File, error) {
+	return nil, errNoChardev
+}
+
+func (l *cdevLine) reconfigure(f *os.File) error {
+	return errNoChardev
+}
+
+func (l *cdevLine) getValue(f *os.File) (uint, error) {
+	return 0, errNoChardev
+}
+
+func (l *cdevLine) setValue(f *os.File, v uint) error {
+	return errNoChardev
+}
+
+func (l *cdevLine) info() (uint64, error) {
+	return 0, errNoChardev
+}
+
+func (l *cdevLine) drain(f *os.File) error {
+	return errNoChardev
+}
+
+func (l *cdevLine) events(f *os.File) ([]lineEdge, error) {
+	return nil, errNoChardev
+}
+
+type namedLine struct {
+	number uint
+	offset uint32
+	label  string
+	lines  uint
+}
+
+func findLineName(name string) (namedLine, bool, error) {
+	return namedLine{}, false, errNoChardev
+}
+
+func chipDevices() []string {
+	return nil
+}
+
+func readChip(dev string, first uint) (Chip, error) {
+	return Chip{}, errNoChardev
+}
+
+func requestBulk(lines []*cdevLine, output bool, initial uint64) (*os.File, error) {
+	return nil, errNoChardev
+}
+
+func bulkGet(f *os.File, n int) (uint64, error) {
+	return 0, errNoChardev
+}
+
+func bulkSet(f *os.File, n int, bits uint64) error {
+	return errNoChardev
+}
@@ -0,0 +1,386 @@
+package gpio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// structures of the gpio v2 uAPI, see include/uapi/linux/gpio.h
+
+type gpiochipInfo struct {
+	name  [32]byte
+	label [32]byte
+	lines uint32
+}
+
+type lineAttribute struct {
+	id      uint32
+	padding uint32
+	value   uint64
+}
+
+type lineConfigAttribute struct {
+	attr lineAttribute
+	mask uint64
+}
+
+type lineConfigV2 struct {
+	flags    uint64
+	numAttrs uint32
+	padding  [5]uint32
+	attrs    [10]lineConfigAttribute
+}
+
+type lineRequest struct {
+	offsets         [64]uint32
+	consumer        [32]byte
+	config          lineConfigV2
+	numLines        uint32
+	eventBufferSize uint32
+	padding         [5]uint32
+	fd              int32
+}
+
+type lineInfo struct {
+	name     [32]byte
+	consumer [32]byte
+	offset   uint32
+	numAttrs uint32
+	flags    uint64
+	attrs    [10]lineAttribute
+	padding  [4]uint32
+}
+
+type lineValues struct {
+	bits uint64
+	mask uint64
+}
+
+const lineAttrOutputValues = 2
+
+// cdevConsumer labels the lines requested by this package
+const cdevConsumer = "gpio"
+
+func gpioIoctl(dir uintptr, nr uintptr, size uintptr) uintptr {
+	return dir<<30 | size<<16 | 0xB4<<8 | nr
+}
+
+const (
+	iocRead      = 2
+	iocReadWrite = 3
+)
+
+var (
+	ioctlChipInfo  = gpioIoctl(iocRead, 0x01, unsafe.Sizeof(gpiochipInfo{}))
+	ioctlLineInfo  = gpioIoctl(iocReadWrite, 0x05, unsafe.Sizeof(lineInfo{}))
+	ioctlGetLine   = gpioIoctl(iocReadWrite, 0x07, unsafe.Sizeof(lineRequest{}))
+	ioctlSetConfig = gpioIoctl(iocReadWrite, 0x0D, unsafe.Sizeof(lineConfigV2{}))
+	ioctlGetValues = gpioIoctl(iocReadWrite, 0x0E, unsafe.Sizeof(lineValues{}))
+	ioctlSetValues = gpioIoctl(iocReadWrite, 0x0F, unsafe.Sizeof(lineValues{}))
+)
+
+func ioctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// chipDevices returns the gpio character devices ordered by their number
+func chipDevices() []string {
+	devs, _ := filepath.Glob("/dev/gpiochip*")
+	num := func(dev string) int {
+		n, _ := strconv.Atoi(strings.TrimPrefix(dev, "/dev/gpiochip"))
+		return n
+	}
+	sort.Slice(devs, func(i, j int) bool { return num(devs[i]) < num(devs[j]) })
+	return devs
+}
+
+// chardevAvailable reports whether the system has gpio character devices
+func chardevAvailable() bool {
+	return len(chipDevices()) != 0
+}
+
+func chipLines(dev string) (uint, error) {
+	chip, err := os.Open(dev)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open gpio chip: %s", err)
+	}
+	defer chip.Close()
+	var info gpiochipInfo
+	if err := ioctl(chip.Fd(), ioctlChipInfo, unsafe.Pointer(&info)); err != nil {
+		return 0, fmt.Errorf("failed to get info of %s: %s", dev, err)
+	}
+	return uint(info.lines), nil
+}
+
+// namedLine is a line found by its name
+type namedLine struct {
+	// number counts the lines across all chips, like the pin numbers of the character device
+	number uint
+	offset uint32
+	// label and lines identify the chip for the sysfs backend
+	label string
+	lines uint
+}
+
+// findLineName scans the chips in order for the first line named name
+func findLineName(name string) (namedLine, bool, error) {
+	chips, err := Chips()
+	if err != nil {
+		return namedLine{}, false, err
+	}
+	for _, chip := range chips {
+		for _, line := range chip.Lines {
+			if line.Name == name {
+				return namedLine{
+					number: line.Number,
+					offset: uint32(line.Offset),
+					label:  chip.Label,
+					lines:  uint(len(chip.Lines)),
+				}, true, nil
+			}
+		}
+	}
+	return namedLine{}, false, nil
+}
+
+// readChip describes the chip dev, whose first line has the pin number first
+func readChip(dev string, first uint) (Chip, error) {
+	f, err := os.Open(dev)
+	if err != nil {
+		return Chip{}, fmt.Errorf("failed to open gpio chip: %s", err)
+	}
+	defer f.Close()
+	var info gpiochipInfo
+	if err := ioctl(f.Fd(), ioctlChipInfo, unsafe.Pointer(&info)); err != nil {
+		return Chip{}, fmt.Errorf("failed to get info of %s: %s", dev, err)
+	}
+	chip := Chip{
+		Name:  cString(info.name[:]),
+		Label: cString(info.label[:]),
+		Lines: make([]LineInfo, info.lines),
+	}
+	for offset := uint32(0); offset < info.lines; offset++ {
+		li := lineInfo{offset: offset}
+		if err := ioctl(f.Fd(), ioctlLineInfo, unsafe.Pointer(&li)); err != nil {
+			return Chip{}, fmt.Errorf("failed to get info of line %d of %s: %s", offset, dev, err)
+		}
+		chip.Lines[offset] = LineInfo{
+			Offset:    uint(offset),
+			Number:    first + uint(offset),
+			Name:      cString(li.name[:]),
+			Consumer:  cString(li.consumer[:]),
+			Used:      li.flags&lineFlagUsed != 0,
+			Direction: flagsDirection(li.flags),
+			ActiveLow: li.flags&lineFlagActiveLow != 0,
+		}
+	}
+	return chip, nil
+}
+
+// lookupLine finds the chip and offset of a pin number counted across all chips
+func lookupLine(n uint) (*cdevLine, error) {
+	offset := n
+	for _, dev := range chipDevices() {
+		lines, err := chipLines(dev)
+		if err != nil {
+			return nil, err
+		}
+		if offset < lines {
+			line := &cdevLine{chip: dev, offset: uint32(offset)}
+			line.flags = lineFlagInput
+			return line, nil
+		}
+		offset -= lines
+	}
+	return nil, fmt.Errorf("gpio %d doesn't exist on any gpio chip", n)
+}
+
+// config returns the line configuration to request. l.mu must be held
+func (l *cdevLine) config() lineConfigV2 {
+	cfg := lineConfigV2{flags: l.flags}
+	if l.flags&lineFlagOutput != 0 {
+		cfg.numAttrs = 1
+		cfg.attrs[0] = lineConfigAttribute{
+			attr: lineAttribute{id: lineAttrOutputValues, value: uint64(l.value)},
+			mask: 1,
+		}
+	}
+	return cfg
+}
+
+// request requests the line from its chip and returns the request fd
+func (l *cdevLine) request() (*os.File, error) {
+	chip, err := os.OpenFile(l.chip, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gpio chip: %s", err)
+	}
+	defer chip.Close()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	req := lineRequest{
+		config:   l.config(),
+		numLines: 1,
+	}
+	req.offsets[0] = l.offset
+	copy(req.consumer[:], cdevConsumer)
+	if err := ioctl(chip.Fd(), ioctlGetLine, unsafe.Pointer(&req)); err != nil {
+		return nil, fmt.Errorf("failed to request line %d of %s: %s", l.offset, l.chip, err)
+	}
+	return os.NewFile(uintptr(req.fd), fmt.Sprintf("%s:%d", l.chip, l.offset)), nil
+}
+
+// reconfigure applies the current configuration to a requested line without releasing it,
+// so that outputs don't glitch and no other process can grab the line in between
+func (l *cdevLine) reconfigure(f *os.File) error {
+	l.mu.Lock()
+	cfg := l.config()
+	l.mu.Unlock()
+	if err := ioctl(f.Fd(), ioctlSetConfig, unsafe.Pointer(&cfg)); err != nil {
+		return fmt.Errorf("failed to reconfigure line %d of %s: %s", l.offset, l.chip, err)
+	}
+	return nil
+}
+
+func (l *cdevLine) getValue(f *os.File) (uint, error) {
+	vals := lineValues{mask: 1}
+	if err := ioctl(f.Fd(), ioctlGetValues, unsafe.Pointer(&vals)); err != nil {
+		return 0, fmt.Errorf("failed to read: %s", err)
+	}
+	return uint(vals.bits & 1), nil
+}
+
+func (l *cdevLine) setValue(f *os.File, v uint) error {
+	vals := lineValues{bits: uint64(v), mask: 1}
+	if err := ioctl(f.Fd(), ioctlSetValues, unsafe.Pointer(&vals)); err != nil {
+		return fmt.Errorf("failed to write: %s", err)
+	}
+	l.mu.Lock()
+	l.value = v
+	l.mu.Unlock()
+	return nil
+}
+
+// info returns the flags of the line as reported by the kernel
+func (l *cdevLine) info() (uint64, error) {
+	chip, err := os.Open(l.chip)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open gpio chip: %s", err)
+	}
+	defer chip.Close()
+	info := lineInfo{offset: l.offset}
+	if err := ioctl(chip.Fd(), ioctlLineInfo, unsafe.Pointer(&info)); err != nil {
+		return 0, fmt.Errorf("failed to get info of line %d of %s: %s", l.offset, l.chip, err)
+	}
+	return info.flags, nil
+}
+
+// drain discards the pending edge events of a requested line, like reading a sysfs value file does
+func (l *cdevLine) drain(f *os.File) error {
+	_, err := l.events(f)
+	return err
+}
+
+// events reads the pending edge events of a requested line without blocking and
+// returns them with their kernel timestamps, on CLOCK_MONOTONIC unless set to CLOCK_REALTIME
+func (l *cdevLine) events(f *os.File) ([]lineEdge, error) {
+	fd := int(f.Fd())
+	buf := make([]byte, 16*lineEventSize)
+	var stamps []lineEdge
+	l.mu.Lock()
+	flags := l.flags
+	l.mu.Unlock()
+	now, mono := time.Now(), monotonicNow()
+	for {
+		fdset := fdHeap{uintptr(fd)}.FdSet()
+		timeval := syscall.Timeval{}
+		ready, err := doSelect(fd+1, fdset, nil, nil, &timeval)
+		if err != nil {
+			return stamps, fmt.Errorf("failed to call syscall.Select, %s", err)
+		}
+		if !ready {
+			return stamps, nil
+		}
+		n, err := syscall.Read(fd, buf)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return stamps, fmt.Errorf("failed to read edge events: %s", err)
+		}
+		for i := 0; i+lineEventSize <= n; i += lineEventSize {
+			ev := (*lineEvent)(unsafe.Pointer(&buf[i]))
+			stamp := time.Duration(ev.timestampNs)
+			stamps = append(stamps, lineEdge{
+				stamp:  stamp,
+				at:     lineStampTime(flags, stamp, now, mono),
+				rising: ev.id == lineEventRising,
+			})
+		}
+	}
+}
+
+// requestBulk requests lines of a single chip together, so that their values are read and
+// written in one ioctl. With output set, bit i of initial is the initial value of lines[i].
+func requestBulk(lines []*cdevLine, output bool, initial uint64) (*os.File, error) {
+	chip, err := os.OpenFile(lines[0].chip, os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open gpio chip: %s", err)
+	}
+	defer chip.Close()
+
+	req := lineRequest{
+		numLines: uint32(len(lines)),
+	}
+	req.config.flags = lineFlagInput
+	if output {
+		req.config.flags = lineFlagOutput
+		req.config.numAttrs = 1
+		req.config.attrs[0] = lineConfigAttribute{
+			attr: lineAttribute{id: lineAttrOutputValues, value: initial},
+			mask: bulkMask(len(lines)),
+		}
+	}
+	for i, l := range lines {
+		req.offsets[i] = l.offset
+	}
+	copy(req.consumer[:], cdevConsumer)
+	if err := ioctl(chip.Fd(), ioctlGetLine, unsafe.Pointer(&req)); err != nil {
+		return nil, fmt.Errorf("failed to request %d lines of %s: %s", len(lines), lines[0].chip, err)
+	}
+	return os.NewFile(uintptr(req.fd), fmt.Sprintf("%s:bulk", lines[0].chip)), nil
+}
+
+func bulkGet(f *os.File, n int) (uint64, error) {
+	vals := lineValues{mask: bulkMask(n)}
+	if err := ioctl(f.Fd(), ioctlGetValues, unsafe.Pointer(&vals)); err != nil {
+		return 0, fmt.Errorf("failed to read: %s", err)
+	}
+	return vals.bits, nil
+}
+
+func bulkSet(f *os.File, n int, bits uint64) error {
+	vals := lineValues{bits: bits, mask: bulkMask(n)}
+	if err := ioctl(f.Fd(), ioctlSetValues, unsafe.Pointer(&vals)); err != nil {
+		return fmt.Errorf("failed to write: %s", err)
+	}
+	return nil
+}
+
+// monotonicNow reads CLOCK_MONOTONIC, the clock of the kernel timestamps of edge events
+func monotonicNow() time.Duration {
+	var ts syscall.Timespec
+	syscall.Syscall(syscall.SYS_CLOCK_GETTIME, 1, uintptr(unsafe.Pointer(&ts)), 0)
+	return time.Duration(ts.Nano())
+}
@@ -0,0 +1,56 @@
+package gpio
+
+import (
+	"bytes"
+)
+
+// Chip describes a gpio character device, see Chips
+type Chip struct {
+	// Name is the name of the device, e.g. "gpiochip0"
+	Name string
+	// Label is the name of the controller, e.g. "pinctrl-bcm2711"
+	Label string
+	Lines []LineInfo
+}
+
+// LineInfo describes a line of a gpio chip as the kernel reports it
+type LineInfo struct {
+	// Offset is the number of the line on its chip
+	Offset uint
+	// Number is the pin number of the line on the character device backend, counted
+	// across all chips
+	Number uint
+	// Name is the name given to the line by the device tree, if any, see FindLine
+	Name string
+	// Consumer is the label of whoever holds the line, e.g. a kernel driver or this package
+	Consumer string
+	// Used is set when the line is held by a consumer, also one without a label
+	Used      bool
+	Direction Direction
+	ActiveLow bool
+}
+
+// Chips returns the gpio chips of the system ordered by their number, with their lines, so
+// that tools and applications can find out what the board provides. It reads the character
+// devices, which also report the lines used through sysfs, and ignores any installed Mock.
+func Chips() ([]Chip, error) {
+	var chips []Chip
+	var number uint
+	for _, dev := range chipDevices() {
+		chip, err := readChip(dev, number)
+		if err != nil {
+			return nil, err
+		}
+		chips = append(chips, chip)
+		number += uint(len(chip.Lines))
+	}
+	return chips, nil
+}
+
+// cString returns the string of a NUL terminated buffer
+func cString(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
@@ -0,0 +1,204 @@
+package gpio
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ErrClaimed is the kind of errors for pins claimed by another process, see SetClaimDir
+var ErrClaimed = errors.New("gpio is claimed by another process")
+
+var (
+	claimMu    sync.Mutex
+	claimDir   string
+	claimOwner string
+)
+
+// SetClaimDir makes the pins opened afterwards be claimed in dir, e.g. /run/gpio, so that
+// processes racing for a pin, typically services starting at boot, get a deterministic
+// outcome: the first to open the pin wins and the others fail with an error of kind
+// ErrClaimed, which unwraps to a *ClaimedError naming the winner. A claim is a lock on a
+// file per pin number, held until the pin is closed or the process exits, and the file
+// describes its owner. The pins a process opens with the same number share its claim.
+// The protocol is cooperative, it only constrains processes which use the same dir and
+// number pins the same way. owner names this process in the claims, the name of its
+// executable by default. An empty dir, the default, disables claims.
+func SetClaimDir(dir string, owner string) {
+	if owner == "" {
+		owner = filepath.Base(os.Args[0])
+	}
+	claimMu.Lock()
+	defer claimMu.Unlock()
+	claimDir = dir
+	claimOwner = owner
+}
+
+// Claimant describes the process holding a claim
+type Claimant struct {
+	Owner string    `json:"owner"`
+	PID   int       `json:"pid"`
+	Since time.Time `json:"since"`
+}
+
+// ClaimedError is the error of a pin claimed by another process
+type ClaimedError struct {
+	Pin      uint
+	Claimant Claimant
+}
+
+func (e *ClaimedError) Error() string {
+	if e.Claimant.PID == 0 {
+		return fmt.Sprintf("gpio %d is claimed by another process", e.Pin)
+	}
+	return fmt.Sprintf("gpio %d is claimed by %s (pid %d) since %s",
+		e.Pin, e.Claimant.Owner, e.Claimant.PID, e.Claimant.Since.Format(time.RFC3339))
+}
+
+// pinClaim is the share of an open pin in a claim of this process
+type pinClaim struct {
+	held *heldClaim
+}
+
+// heldClaim is a claim locked by this process, shared by all the pins it opened with the same
+// number, since a second lock of the claim would fail
+type heldClaim struct {
+	path string
+	f    *os.File
+	refs int
+}
+
+var (
+	heldMu sync.Mutex
+	held   = make(map[string]*heldClaim)
+)
+
+func currentClaimDir() (string, string) {
+	claimMu.Lock()
+	defer claimMu.Unlock()
+	return claimDir, claimOwner
+}
+
+func claimPath(dir string, n uint) string {
+	return fmt.Sprintf("%s/gpio%d", dir, n)
+}
+
+// claimPin claims pin n, or returns nil when claims are disabled. A pin this process already
+// claimed shares the claim.
+func claimPin(n uint) (*pinClaim, error) {
+	dir, owner := currentClaimDir()
+	if dir == "" {
+		return nil, nil
+	}
+	c, busy, err := lockClaim(dir, n, owner)
+	if busy {
+		// read without holding heldMu, since the winner may still be describing the claim
+		return nil, &PinError{
+			Pin:  n,
+			Kind: ErrClaimed,
+			Err:  &ClaimedError{Pin: n, Claimant: readClaimant(dir, n)},
+		}
+	}
+	return c, err
+}
+
+// lockClaim takes a share of the claim of this process on pin n, or locks the claim and
+// describes it. busy is true when another process holds it.
+func lockClaim(dir string, n uint, owner string) (c *pinClaim, busy bool, err error) {
+	path := claimPath(dir, n)
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	if h, ok := held[path]; ok {
+		h.refs++
+		return &pinClaim{held: h}, false, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, false, fmt.Errorf("failed to create gpio claim directory: %s", err)
+	}
+	// the file is never removed: a process could lock the removed file while another
+	// locks a new one
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, false, classFileError(n, err, "failed to open gpio claim: %w")
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if err != syscall.EWOULDBLOCK {
+			return nil, false, fmt.Errorf("failed to lock gpio %d claim: %s", n, err)
+		}
+		return nil, true, nil
+	}
+	b, _ := json.Marshal(Claimant{Owner: owner, PID: os.Getpid(), Since: time.Now()})
+	if err := f.Truncate(0); err == nil {
+		_, err = f.WriteAt(b, 0)
+	}
+	if err != nil {
+		f.Close()
+		return nil, false, fmt.Errorf("failed to write gpio %d claim: %s", n, err)
+	}
+	logger().Debug("claimed gpio", "pin", n, "owner", owner)
+	h := &heldClaim{path: path, f: f, refs: 1}
+	held[path] = h
+	return &pinClaim{held: h}, false, nil
+}
+
+// readClaimant reads the owner of a held claim, waiting briefly for a claim which was just
+// locked to be described. The claimant is left empty when it can't be read.
+func readClaimant(dir string, n uint) Claimant {
+	var c Claimant
+	for i := 0; i < 10; i++ {
+		b, err := ioutil.ReadFile(claimPath(dir, n))
+		if err == nil && json.Unmarshal(b, &c) == nil {
+			return c
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return Claimant{}
+}
+
+// claimHolder returns the owner of the claim on pin n, if another process holds it
+func claimHolder(n uint) (Claimant, bool) {
+	dir, _ := currentClaimDir()
+	if dir == "" {
+		return Claimant{}, false
+	}
+	heldMu.Lock()
+	_, ours := held[claimPath(dir, n)]
+	heldMu.Unlock()
+	if ours {
+		return Claimant{}, false
+	}
+	f, err := os.Open(claimPath(dir, n))
+	if err != nil {
+		return Claimant{}, false
+	}
+	defer f.Close()
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_SH|syscall.LOCK_NB); err == nil {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		return Claimant{}, false
+	}
+	return readClaimant(dir, n), true
+}
+
+// release gives up the share of the pin in the claim. The last share unlocks the claim,
+// clearing its description first so that it never describes the next owner.
+func (c *pinClaim) release() {
+	if c == nil {
+		return
+	}
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	h := c.held
+	if h.refs--; h.refs > 0 {
+		return
+	}
+	delete(held, h.path)
+	h.f.Truncate(0)
+	h.f.Close()
+}
@@ -0,0 +1,185 @@
+package gpio
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PinRequest describes a pin for Manager.Start to open
+type PinRequest struct {
+	Name     string `json:"name"`
+	Number   uint   `json:"number"`
+	Output   bool   `json:"output,omitempty"`
+	InitHigh bool   `json:"init_high,omitempty"`
+}
+
+// PinClaim is what the system reports about a requested pin.
+// Consumer is the kernel consumer holding the line, "sysfs" for exported pins,
+// and is only known when debugfs is readable. Function is only known when the
+// pinctrl provider supports muxing. Conflict is empty when the pin can be claimed.
+type PinClaim struct {
+	PinRequest
+	Exported bool
+	Consumer string
+	Function string
+	Conflict string
+}
+
+// ClaimReport lists the claims of all pins requested at once
+type ClaimReport []PinClaim
+
+// Conflicts returns the claims which can't be satisfied
+func (r ClaimReport) Conflicts() []PinClaim {
+	var conflicts []PinClaim
+	for _, c := range r {
+		if c.Conflict != "" {
+			conflicts = append(conflicts, c)
+		}
+	}
+	return conflicts
+}
+
+func (r ClaimReport) String() string {
+	var b strings.Builder
+	for _, c := range r {
+		status := "ok"
+		if c.Conflict != "" {
+			status = "CONFLICT: " + c.Conflict
+		}
+		fmt.Fprintf(&b, "%s (gpio %d): exported=%t consumer=%q function=%q %s\n",
+			c.Name, c.Number, c.Exported, c.Consumer, c.Function, status)
+	}
+	return b.String()
+}
+
+// ClaimError is returned by Manager.Start when some of the requested pins can't be claimed.
+// It lists all of them rather than only the first one.
+type ClaimError struct {
+	Conflicts []PinClaim
+}
+
+func (e *ClaimError) Error() string {
+	parts := make([]string, 0, len(e.Conflicts))
+	for _, c := range e.Conflicts {
+		parts = append(parts, fmt.Sprintf("%s (gpio %d): %s", c.Name, c.Number, c.Conflict))
+	}
+	return fmt.Sprintf("%d pin conflicts: %s", len(e.Conflicts), strings.Join(parts, "; "))
+}
+
+// debugfsGPIO is the kernel's summary of all gpio lines and their consumers
+const debugfsGPIO = "/sys/kernel/debug/gpio"
+
+// readConsumers returns the consumer of every requested line listed in debugfs.
+// It returns nil when debugfs can't be read.
+func readConsumers() map[uint]string {
+	f, err := os.Open(debugfsGPIO)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	consumers := make(map[uint]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "gpio-") {
+			continue
+		}
+		open := strings.Index(line, "(")
+		closing := strings.LastIndex(line, ")")
+		if open < 0 || closing < open {
+			continue
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(line[len("gpio-"):open]))
+		if err != nil {
+			continue
+		}
+		label := line[open+1 : closing]
+		rest := strings.TrimSpace(line[closing+1:])
+		if i := strings.Index(label, "|"); i >= 0 {
+			// newer kernels print "(name |consumer)"
+			label = label[i+1:]
+		} else if rest == "" {
+			// newer kernels also list lines which nobody requested
+			continue
+		}
+		consumers[uint(n)] = strings.TrimSpace(label)
+	}
+	return consumers
+}
+
+// Check reports what the system says about the requested pins without opening any of them
+func (m *Manager) Check(reqs ...PinRequest) ClaimReport {
+	consumers := readConsumers()
+	names := make(map[string]bool)
+	numbers := make(map[uint]bool)
+	report := make(ClaimReport, 0, len(reqs))
+	for _, req := range reqs {
+		c := PinClaim{PinRequest: req}
+		c.Exported = isExported(Pin{Number: req.Number})
+		c.Consumer = consumers[req.Number]
+		if mux, err := pinmux(); err == nil {
+			c.Function, _ = mux.Function(req.Number)
+		}
+
+		_, registered := m.Pin(req.Name)
+		holder, claimed := claimHolder(req.Number)
+		switch {
+		case names[req.Name]:
+			c.Conflict = "name requested twice"
+		case registered:
+			c.Conflict = "name already registered"
+		case numbers[req.Number]:
+			c.Conflict = "pin requested twice"
+		case claimed:
+			c.Conflict = fmt.Sprintf("pin is claimed by %s (pid %d)", holder.Owner, holder.PID)
+		case c.Consumer != "" && c.Consumer != "sysfs":
+			c.Conflict = fmt.Sprintf("line is held by %q", c.Consumer)
+		case c.Function != "" && c.Function != FunctionGPIO:
+			c.Conflict = fmt.Sprintf("pin is muxed to function %s", c.Function)
+		}
+		names[req.Name] = true
+		numbers[req.Number] = true
+		report = append(report, c)
+	}
+	return report
+}
+
+// Start checks all requested pins and, if none of them conflicts, opens and registers them.
+// Otherwise nothing is opened and a *ClaimError listing every conflict is returned.
+// If opening a pin fails, the pins opened so far by Start are closed again.
+func (m *Manager) Start(reqs ...PinRequest) (ClaimReport, error) {
+	report := m.Check(reqs...)
+	if conflicts := report.Conflicts(); len(conflicts) != 0 {
+		return report, &ClaimError{Conflicts: conflicts}
+	}
+	for i, req := range reqs {
+		if err := m.startPin(req, req.InitHigh); err != nil {
+			for _, done := range reqs[:i] {
+				m.Remove(done.Name)
+			}
+			return report, fmt.Errorf("failed to start %s: %s", req.Name, err)
+		}
+	}
+	return report, nil
+}
+
+// startPin opens and registers a requested pin, initializing an output to high
+func (m *Manager) startPin(req PinRequest, high bool) error {
+	var err error
+	if req.Output {
+		_, err = m.AddOutput(req.Name, req.Number, high)
+	} else {
+		_, err = m.AddInput(req.Name, req.Number)
+	}
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.started[req.Name] = req
+	m.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,174 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Encoding selects how a CodedInput decodes its pins
+type Encoding uint
+
+const (
+	EncodingBinary Encoding = iota
+	EncodingGray
+	// EncodingBCD decodes groups of 4 pins as decimal digits, least significant digit first
+	EncodingBCD
+)
+
+// ErrInvalidCode is returned when the pins don't form a valid code, e.g. a BCD digit above 9
+var ErrInvalidCode = errors.New("pins don't form a valid code")
+
+func decode(enc Encoding, bits uint, n int) (uint, error) {
+	switch enc {
+	case EncodingBinary:
+		return bits, nil
+	case EncodingGray:
+		v := bits
+		for shift := bits >> 1; shift != 0; shift >>= 1 {
+			v ^= shift
+		}
+		return v, nil
+	case EncodingBCD:
+		v, scale := uint(0), uint(1)
+		for i := 0; i < n; i += 4 {
+			digit := (bits >> uint(i)) & 0xf
+			if digit > 9 {
+				return 0, ErrInvalidCode
+			}
+			v += digit * scale
+			scale *= 10
+		}
+		return v, nil
+	}
+	return 0, fmt.Errorf("invalid encoding %d", enc)
+}
+
+// CodedChange is sent by a CodedInput when its decoded value changes
+type CodedChange struct {
+	Value uint
+	Time  time.Time
+}
+
+const codedChangeLen = 16
+
+// codedIdleWait bounds how long the CodedInput goroutine waits for edges before checking for Close
+const codedIdleWait = time.Second
+
+// CodedInput reads a set of input pins as one coded value, e.g. an absolute rotary switch.
+// pins[0] is the least significant bit.
+// A new value is only reported on Changes once all bits have been stable for the
+// debounce time, so intermediate states while switching are not reported.
+type CodedInput struct {
+	Changes chan CodedChange
+
+	sampler  *Sampler
+	enc      Encoding
+	debounce time.Duration
+
+	mu     sync.Mutex
+	value  uint
+	valid  bool
+	sample Sample
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewCodedInput starts decoding the given input pins. The pins' edge settings are changed to both
+func NewCodedInput(enc Encoding, debounce time.Duration, pins ...Pin) (*CodedInput, error) {
+	if len(pins) > 32 {
+		return nil, fmt.Errorf("too many pins for a coded input: %d", len(pins))
+	}
+	if enc == EncodingBCD && len(pins)%4 != 0 {
+		return nil, fmt.Errorf("bcd needs a multiple of 4 pins, got %d", len(pins))
+	}
+	if _, err := decode(enc, 0, len(pins)); err != nil {
+		return nil, err
+	}
+	s, err := NewSampler(pins...)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range pins {
+		if err := setEdgeTrigger(p, EdgeBoth); err != nil {
+			return nil, err
+		}
+	}
+	c := &CodedInput{
+		Changes:  make(chan CodedChange, codedChangeLen),
+		sampler:  s,
+		enc:      enc,
+		debounce: debounce,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	if c.value, err = c.read(); err == nil {
+		c.valid = true
+	}
+	spawn("CodedInput", pinNumbers(pins), c.run)
+	return c, nil
+}
+
+// read samples and decodes the pins, clearing their pending edges
+func (c *CodedInput) read() (uint, error) {
+	if err := c.sampler.SampleInto(&c.sample); err != nil {
+		return 0, err
+	}
+	bits := uint(0)
+	for i, v := range c.sample.Values {
+		bits |= v << uint(i)
+	}
+	return decode(c.enc, bits, len(c.sample.Values))
+}
+
+// Value returns the last stable decoded value.
+// ok is false while no valid code has been read yet.
+func (c *CodedInput) Value() (value uint, ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.value, c.valid
+}
+
+func (c *CodedInput) run() {
+	defer close(c.stopped)
+	for {
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+		raw, err := c.read()
+		c.mu.Lock()
+		settled := err == nil && c.valid && raw == c.value
+		c.mu.Unlock()
+		wait := codedIdleWait
+		if !settled {
+			wait = c.debounce
+		}
+		changed, werr := waitForEdges(c.sampler.pins, wait)
+		if werr != nil {
+			logger().Error("coded input stopped", "err", werr)
+			return
+		}
+		if changed || settled || err != nil {
+			continue
+		}
+		// raw has been stable for the debounce time
+		c.mu.Lock()
+		c.value = raw
+		c.valid = true
+		c.mu.Unlock()
+		select {
+		case c.Changes <- CodedChange{Value: raw, Time: time.Now()}:
+		default:
+		}
+	}
+}
+
+// Close stops decoding. The pins are left open
+func (c *CodedInput) Close() {
+	close(c.stop)
+	<-c.stopped
+}
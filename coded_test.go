@@ -0,0 +1,43 @@
+package gpio
+
+import "testing"
+
+func TestDecode(t *testing.T) {
+	for _, c := range []struct {
+		enc  Encoding
+		bits uint
+		n    int
+		want uint
+		err  error
+	}{
+		{EncodingBinary, 0xb, 4, 11, nil},
+		{EncodingGray, 0, 4, 0, nil},
+		{EncodingGray, 1, 4, 1, nil},
+		{EncodingGray, 3, 4, 2, nil},
+		{EncodingGray, 2, 4, 3, nil},
+		{EncodingGray, 0x8, 4, 15, nil},
+		{EncodingBCD, 0x9, 4, 9, nil},
+		// digits are least significant first
+		{EncodingBCD, 0x42, 8, 42, nil},
+		{EncodingBCD, 0xa, 4, 0, ErrInvalidCode},
+		{EncodingBCD, 0xa1, 8, 0, ErrInvalidCode},
+	} {
+		got, err := decode(c.enc, c.bits, c.n)
+		if err != c.err || got != c.want {
+			t.Errorf("decode(%d, %#x, %d) = %d, %v, want %d, %v", c.enc, c.bits, c.n, got, err, c.want, c.err)
+		}
+	}
+	if _, err := decode(Encoding(9), 0, 4); err == nil {
+		t.Error("an invalid encoding was decoded")
+	}
+}
+
+// Every Gray code of 4 bits decodes back to the value it encodes
+func TestDecodeGrayRoundTrip(t *testing.T) {
+	for v := uint(0); v < 16; v++ {
+		gray := v ^ v>>1
+		if got, _ := decode(EncodingGray, gray, 4); got != v {
+			t.Errorf("decode of gray %#x = %d, want %d", gray, got, v)
+		}
+	}
+}
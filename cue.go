@@ -0,0 +1,151 @@
+package gpio
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Cue is a short burst for an actuator such as a buzzer or a haptic motor.
+// Pattern alternates on and off durations, starting with on.
+// Cues with a higher Priority are played first and preempt a playing cue of lower priority.
+// Two cues are identical when they have the same non empty Name, or no name and the same pattern.
+type Cue struct {
+	Name     string
+	Pattern  []time.Duration
+	Priority int
+}
+
+func (c Cue) same(o Cue) bool {
+	if c.Name != "" || o.Name != "" {
+		return c.Name == o.Name
+	}
+	if len(c.Pattern) != len(o.Pattern) {
+		return false
+	}
+	for i := range c.Pattern {
+		if c.Pattern[i] != o.Pattern[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// CueQueue plays Cues on an output pin one after the other.
+// Identical pending cues are coalesced into one, and a cue more urgent than the one
+// playing interrupts it; the interrupted cue is dropped.
+type CueQueue struct {
+	pin Pin
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []Cue
+	playing *Cue
+	preempt chan struct{}
+	closed  bool
+	stopped chan struct{}
+}
+
+// NewCueQueue starts a queue playing cues on the given output pin
+func NewCueQueue(p Pin) (*CueQueue, error) {
+	if p.dir() != DirectionOut {
+		return nil, errWrongDirection(p, DirectionOut)
+	}
+	q := &CueQueue{
+		pin:     p,
+		stopped: make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	spawn("CueQueue", []uint{p.Number}, q.run)
+	return q, nil
+}
+
+// Play queues c, or starts it right away if it is more urgent than the cue playing
+func (q *CueQueue) Play(c Cue) error {
+	if len(c.Pattern) == 0 {
+		return errors.New("cue has an empty pattern")
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return errors.New("cue queue is closed")
+	}
+	for _, p := range q.pending {
+		if p.same(c) {
+			return nil
+		}
+	}
+	// keep pending sorted by priority, first come first served within a priority
+	i := len(q.pending)
+	for i > 0 && q.pending[i-1].Priority < c.Priority {
+		i--
+	}
+	q.pending = append(q.pending, Cue{})
+	copy(q.pending[i+1:], q.pending[i:])
+	q.pending[i] = c
+
+	if q.playing != nil && c.Priority > q.playing.Priority && q.preempt != nil {
+		close(q.preempt)
+		q.preempt = nil
+	}
+	q.cond.Broadcast()
+	return nil
+}
+
+func (q *CueQueue) next() (Cue, chan struct{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.playing = nil
+	for len(q.pending) == 0 && !q.closed {
+		q.cond.Wait()
+	}
+	if q.closed {
+		return Cue{}, nil, false
+	}
+	c := q.pending[0]
+	q.pending = q.pending[1:]
+	q.playing = &c
+	q.preempt = make(chan struct{})
+	return c, q.preempt, true
+}
+
+func (q *CueQueue) run() {
+	defer close(q.stopped)
+	for {
+		c, preempt, ok := q.next()
+		if !ok {
+			writePin(q.pin, 0)
+			return
+		}
+		q.play(c, preempt)
+	}
+}
+
+func (q *CueQueue) play(c Cue, preempt chan struct{}) {
+	defer writePin(q.pin, 0)
+	for i, d := range c.Pattern {
+		writePin(q.pin, uint(1-i%2))
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-preempt:
+			t.Stop()
+			return
+		}
+	}
+}
+
+// Close drops the pending cues, interrupts the playing one and leaves the pin low.
+// The pin itself is left open
+func (q *CueQueue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.pending = nil
+	if q.preempt != nil {
+		close(q.preempt)
+		q.preempt = nil
+	}
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	<-q.stopped
+}
@@ -0,0 +1,131 @@
+package gpio
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DebounceAlgorithm selects how a debounced input filters out bounces
+type DebounceAlgorithm uint
+
+const (
+	// DebounceWindow reports a change at once and ignores further changes for Window,
+	// which gives the lowest latency
+	DebounceWindow DebounceAlgorithm = iota
+	// DebounceIntegrator counts samples of the raw value up to Samples when it is high
+	// and down to 0 when it is low, and reports a change once the count reaches either end.
+	// Window is the sampling period while the count is in between.
+	DebounceIntegrator
+	// DebounceStable reports a change once the raw value has stayed the same for Window
+	DebounceStable
+)
+
+// Debounce configures the software debouncing of an input, see Pin.WithDebounce
+type Debounce struct {
+	Algorithm DebounceAlgorithm
+	Window    time.Duration
+	// Samples is the count DebounceIntegrator integrates up to
+	Samples int
+}
+
+// debouncer filters the raw samples of an input
+type debouncer struct {
+	cfg Debounce
+
+	mu    sync.Mutex
+	valid bool
+	value uint
+	// changed is when value was last changed, for DebounceWindow
+	changed time.Time
+	// raw and rawSince are the last raw value and since when it is seen, for DebounceStable
+	raw      uint
+	rawSince time.Time
+	// count is the integrator of DebounceIntegrator
+	count int
+}
+
+// WithDebounce returns a copy of an input pin whose Read calls and PinWatch events are
+// debounced in software, sharing the state of all copies of the returned pin.
+// Read only sees the samples it takes, so it settles on a change after enough Reads,
+// while a PinWatch samples the pin again by itself until a change has settled.
+func (p Pin) WithDebounce(cfg Debounce) (Pin, error) {
+	if p.dir() != DirectionIn {
+		return Pin{}, errWrongDirection(p, DirectionIn)
+	}
+	if cfg.Window <= 0 {
+		return Pin{}, fmt.Errorf("invalid debounce window %s", cfg.Window)
+	}
+	switch cfg.Algorithm {
+	case DebounceWindow, DebounceStable:
+	case DebounceIntegrator:
+		if cfg.Samples < 1 {
+			return Pin{}, fmt.Errorf("invalid debounce integrator samples %d", cfg.Samples)
+		}
+	default:
+		return Pin{}, fmt.Errorf("invalid debounce algorithm %d", cfg.Algorithm)
+	}
+	p.debounce = &debouncer{cfg: cfg}
+	return p, nil
+}
+
+// feed takes a raw sample seen at t and returns the debounced value. recheck is how long
+// after t another sample is needed to settle a pending change, or 0 when none is pending.
+func (d *debouncer) feed(raw uint, t time.Time) (value uint, recheck time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.valid {
+		d.valid = true
+		// the initial value isn't a change, so it doesn't start a window
+		d.value = raw
+		d.raw, d.rawSince = raw, t
+		if raw == 1 {
+			d.count = d.cfg.Samples
+		}
+		return raw, 0
+	}
+
+	switch d.cfg.Algorithm {
+	case DebounceWindow:
+		end := d.changed.Add(d.cfg.Window)
+		if raw == d.value {
+			break
+		}
+		if t.Before(end) {
+			return d.value, end.Sub(t)
+		}
+		d.value = raw
+		d.changed = t
+		// confirm the value the input settles on once the window is over
+		return d.value, d.cfg.Window
+
+	case DebounceIntegrator:
+		if raw == 1 && d.count < d.cfg.Samples {
+			d.count++
+		} else if raw == 0 && d.count > 0 {
+			d.count--
+		}
+		switch d.count {
+		case d.cfg.Samples:
+			d.value = 1
+		case 0:
+			d.value = 0
+		default:
+			return d.value, d.cfg.Window
+		}
+
+	case DebounceStable:
+		if raw != d.raw {
+			d.raw, d.rawSince = raw, t
+		}
+		if d.raw == d.value {
+			break
+		}
+		end := d.rawSince.Add(d.cfg.Window)
+		if t.Before(end) {
+			return d.value, end.Sub(t)
+		}
+		d.value = d.raw
+	}
+	return d.value, 0
+}
@@ -0,0 +1,66 @@
+package gpio
+
+import (
+	"testing"
+	"time"
+)
+
+// debounceStep is a raw sample fed at an offset from the start, with the expected result
+type debounceStep struct {
+	at      time.Duration
+	raw     uint
+	value   uint
+	recheck time.Duration
+}
+
+func testDebouncer(t *testing.T, cfg Debounce, steps []debounceStep) {
+	t.Helper()
+	d := &debouncer{cfg: cfg}
+	start := time.Now()
+	for i, s := range steps {
+		value, recheck := d.feed(s.raw, start.Add(s.at))
+		if value != s.value || recheck != s.recheck {
+			t.Errorf("step %d: feed(%d) at %s = %d, %s, want %d, %s", i, s.raw, s.at, value, recheck, s.value, s.recheck)
+		}
+	}
+}
+
+func TestDebounceWindow(t *testing.T) {
+	ms := time.Millisecond
+	testDebouncer(t, Debounce{Algorithm: DebounceWindow, Window: 10 * ms}, []debounceStep{
+		{0, 0, 0, 0},
+		// a change is reported at once, and the window is confirmed afterwards
+		{1 * ms, 1, 1, 10 * ms},
+		// bounces inside the window are ignored
+		{3 * ms, 0, 1, 8 * ms},
+		{5 * ms, 1, 1, 0},
+		{11 * ms, 0, 0, 10 * ms},
+	})
+}
+
+func TestDebounceIntegrator(t *testing.T) {
+	ms := time.Millisecond
+	testDebouncer(t, Debounce{Algorithm: DebounceIntegrator, Window: ms, Samples: 3}, []debounceStep{
+		{0, 0, 0, 0},
+		{1 * ms, 1, 0, ms},
+		{2 * ms, 0, 0, 0},
+		{3 * ms, 1, 0, ms},
+		{4 * ms, 1, 0, ms},
+		{5 * ms, 1, 1, 0},
+		{6 * ms, 0, 1, ms},
+		{7 * ms, 1, 1, 0},
+	})
+}
+
+func TestDebounceStable(t *testing.T) {
+	ms := time.Millisecond
+	testDebouncer(t, Debounce{Algorithm: DebounceStable, Window: 10 * ms}, []debounceStep{
+		{0, 1, 1, 0},
+		{1 * ms, 0, 1, 10 * ms},
+		// a bounce restarts the window
+		{4 * ms, 1, 1, 0},
+		{5 * ms, 0, 1, 10 * ms},
+		{12 * ms, 0, 1, 3 * ms},
+		{15 * ms, 0, 0, 0},
+	})
+}
@@ -0,0 +1,108 @@
+package gpio
+
+import (
+	"sync"
+)
+
+// writeDedup remembers the last value written to an output
+type writeDedup struct {
+	// writeMu keeps the writes in order, mu guards the last value
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	last    uint
+	valid   bool
+}
+
+// WithWriteDedup returns a copy of an output pin whose High, Low and WriteTimeout calls
+// are suppressed when they would write the value last written through any copy of the
+// returned pin. This cuts the traffic of callers which re-assert their outputs every tick.
+// Suppressed writes are not audited. The first write and any write after a failed one
+// always go through.
+func (p Pin) WithWriteDedup() Pin {
+	p.dedup = &writeDedup{}
+	return p
+}
+
+// write calls fn to write v unless v was written last. It reports whether fn was called.
+// fn must call applied once the write is applied, which is later for coalesced writes, and
+// until then no write is suppressed.
+func (d *writeDedup) write(v uint, fn func() error) (bool, error) {
+	d.writeMu.Lock()
+	defer d.writeMu.Unlock()
+	d.mu.Lock()
+	if d.valid && d.last == v {
+		d.mu.Unlock()
+		return false, nil
+	}
+	d.valid = false
+	d.mu.Unlock()
+	return true, fn()
+}
+
+// applied records the result of writing v
+func (d *writeDedup) applied(v uint, err error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.last = v
+	d.valid = err == nil
+}
+
+// lastValue returns the last value written, if the last write succeeded
+func (d *writeDedup) lastValue() (uint, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.last, d.valid
+}
+
+// write writes v to an output, deduplicated if the pin has WithWriteDedup, and audits it
+// unless it was suppressed. skip is the number of stack frames to the public API caller
+func (p Pin) write(skip int, v uint, fn func() error) error {
+	if p.Closed() {
+		// the layers below could otherwise accept it without reaching the file
+		err := errClosed(p.Number)
+		audit(skip+1, AuditSourceLocal, p.Number, v, err)
+		return err
+	}
+	if p.dwell != nil {
+		raw := fn
+		fn = func() error {
+			return p.dwell.write(p, v, raw)
+		}
+	}
+	if p.wear != nil {
+		// count when the write is applied, which is later for coalesced writes
+		apply := fn
+		fn = func() error {
+			err := apply()
+			if err == nil && !p.dryRun() {
+				p.wear.written(p.Number, v)
+			}
+			return err
+		}
+	}
+	if p.dedup != nil {
+		apply := fn
+		fn = func() error {
+			err := apply()
+			p.dedup.applied(v, err)
+			return err
+		}
+	}
+	if p.rate != nil {
+		// writes suppressed by dedup don't count against the rate
+		direct := fn
+		fn = func() error {
+			return p.rate.write(p, direct)
+		}
+	}
+	if p.dedup == nil {
+		err := fn()
+		audit(skip+1, AuditSourceLocal, p.Number, v, err)
+		return err
+	}
+	written, err := p.dedup.write(v, fn)
+	if written {
+		audit(skip+1, AuditSourceLocal, p.Number, v, err)
+	}
+	return err
+}
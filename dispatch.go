@@ -0,0 +1,95 @@
+package gpio
+
+import (
+	"sync"
+	"time"
+)
+
+// Dispatcher runs handlers on a bounded pool of worker goroutines.
+// A handler which panics is recovered and reported, and a handler which runs longer
+// than the timeout is abandoned so that its worker can move on to the next one.
+type Dispatcher struct {
+	jobs    chan func()
+	timeout time.Duration
+	wg      sync.WaitGroup
+
+	mu     sync.Mutex
+	closed bool
+}
+
+// NewDispatcher starts workers goroutines which take handlers from a queue of queueLen.
+// A timeout of 0 lets handlers run for as long as they need.
+func NewDispatcher(workers int, queueLen int, timeout time.Duration) *Dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	d := &Dispatcher{
+		jobs:    make(chan func(), queueLen),
+		timeout: timeout,
+	}
+	d.wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		spawn("Dispatcher", nil, d.work)
+	}
+	return d
+}
+
+// Dispatch queues fn to be run by a worker.
+// It returns false without blocking if the queue is full or the Dispatcher is closed.
+func (d *Dispatcher) Dispatch(fn func()) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return false
+	}
+	select {
+	case d.jobs <- fn:
+		return true
+	default:
+		return false
+	}
+}
+
+func (d *Dispatcher) work() {
+	defer d.wg.Done()
+	for fn := range d.jobs {
+		if d.timeout == 0 {
+			runHandler(fn)
+			continue
+		}
+		done := make(chan struct{})
+		spawn("Dispatcher", nil, func() {
+			defer close(done)
+			runHandler(fn)
+		})
+		t := time.NewTimer(d.timeout)
+		select {
+		case <-done:
+		case <-t.C:
+			logger().Warn("handler did not return in time, abandoning it", "timeout", d.timeout)
+		}
+		t.Stop()
+	}
+}
+
+func runHandler(fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger().Error("handler panicked", "panic", r)
+		}
+	}()
+	fn()
+}
+
+// Close stops accepting handlers and waits for the queued ones to be run
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	close(d.jobs)
+	d.mu.Unlock()
+	d.wg.Wait()
+}
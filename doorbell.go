@@ -0,0 +1,118 @@
+package gpio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Doorbell pokes a coprocessor on a request output and waits for it to answer on an
+// acknowledge input, with a four phase handshake: request is raised, the coprocessor raises
+// ack, request is lowered and the coprocessor lowers ack again.
+type Doorbell struct {
+	request Pin
+	ack     Pin
+	timeout time.Duration
+	retries int
+
+	mu sync.Mutex
+}
+
+// NewDoorbell creates a Doorbell on an output and an input pin.
+// timeout is how long each phase of the handshake may take, and a request which isn't
+// acknowledged in time is made again up to retries times.
+// The edge setting of ack is changed to both and request is set low.
+func NewDoorbell(request Pin, ack Pin, timeout time.Duration, retries int) (*Doorbell, error) {
+	if err := checkDirection(DirectionOut, request); err != nil {
+		return nil, err
+	}
+	if err := checkDirection(DirectionIn, ack); err != nil {
+		return nil, err
+	}
+	if timeout <= 0 {
+		return nil, fmt.Errorf("invalid doorbell timeout %s", timeout)
+	}
+	if retries < 0 {
+		return nil, errors.New("doorbell retries can't be negative")
+	}
+	if err := setEdgeTrigger(ack, EdgeBoth); err != nil {
+		return nil, err
+	}
+	if err := writePin(request, 0); err != nil {
+		return nil, err
+	}
+	return &Doorbell{
+		request: request,
+		ack:     ack,
+		timeout: timeout,
+		retries: retries,
+	}, nil
+}
+
+// Ring makes a request and waits for the coprocessor to acknowledge it, see RingCtx
+func (d *Doorbell) Ring() error {
+	return d.RingCtx(context.Background())
+}
+
+// RingCtx makes a request and waits for the coprocessor to acknowledge it and to release ack.
+// ErrTimeout is returned when the coprocessor didn't acknowledge any attempt, or didn't release
+// ack afterwards, in which case the request isn't made again since it was seen.
+// ctx.Err() is returned if ctx is done first. request is low again whenever RingCtx returns.
+func (d *Doorbell) RingCtx(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	// a previous handshake of the coprocessor must be over
+	if err := d.waitAck(ctx, 0); err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		if err := writePin(d.request, 1); err != nil {
+			return err
+		}
+		err := d.waitAck(ctx, 1)
+		if lerr := writePin(d.request, 0); err == nil {
+			err = lerr
+		}
+		if err == nil {
+			return d.waitAck(ctx, 0)
+		}
+		if err != ErrTimeout || i >= d.retries {
+			return err
+		}
+		// the coprocessor might have raised ack just as it timed out
+		if err := d.waitAck(ctx, 0); err != nil {
+			return err
+		}
+	}
+}
+
+// waitAck waits at most the timeout for ack to read v
+func (d *Doorbell) waitAck(ctx context.Context, v uint) error {
+	deadline := time.Now().Add(d.timeout)
+	for {
+		// reading clears any pending edge
+		cur, err := readPin(d.ack)
+		if err != nil {
+			return err
+		}
+		if cur == v {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return ErrTimeout
+		}
+		if wait > ctxPollInterval {
+			wait = ctxPollInterval
+		}
+		if _, err := waitForEdge(d.ack, wait); err != nil {
+			return err
+		}
+	}
+}
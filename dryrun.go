@@ -0,0 +1,53 @@
+package gpio
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	dryRun int32
+
+	dryRunMu     sync.Mutex
+	dryRunLevels = make(map[uint]uint)
+)
+
+// SetDryRun makes all writes to outputs succeed without being applied while enabled, for
+// rehearsing new control logic on live hardware. Each write which is held back is logged
+// and the value it would have set is kept, see DryRunLevels. Pins are still opened, and
+// outputs opened during a dry run are set to their initial values.
+func SetDryRun(enabled bool) {
+	v := int32(0)
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&dryRun, v)
+}
+
+func isDryRun() bool {
+	return atomic.LoadInt32(&dryRun) != 0
+}
+
+// dryRun reports whether writes to p are held back, globally or by its Manager
+func (p Pin) dryRun() bool {
+	return isDryRun() || (p.gate != nil && p.gate.isDryRun())
+}
+
+// DryRunLevels returns the values the writes held back by dry runs would have set,
+// by pin number
+func DryRunLevels() map[uint]uint {
+	dryRunMu.Lock()
+	defer dryRunMu.Unlock()
+	levels := make(map[uint]uint, len(dryRunLevels))
+	for n, v := range dryRunLevels {
+		levels[n] = v
+	}
+	return levels
+}
+
+func dryRunWrite(p Pin, v uint) {
+	dryRunMu.Lock()
+	dryRunLevels[p.Number] = v
+	dryRunMu.Unlock()
+	logger().Info("dry run, write not applied", "pin", p.Number, "value", v)
+}
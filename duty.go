@@ -0,0 +1,154 @@
+package gpio
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DutyAlarm is sent by a DutyMonitor when the duty cycle crosses one of its thresholds.
+// Above tells whether the duty cycle went above or fell below Threshold.
+type DutyAlarm struct {
+	Threshold float64
+	Above     bool
+	Duty      float64
+	Time      time.Time
+}
+
+const dutyAlarmLen = 16
+
+// DutyMonitor continuously measures the duty cycle of an input, e.g. the status PWM of a
+// charger IC, over consecutive windows and raises alarms on threshold crossings.
+// Alarms are delivered on Alarms and dropped when nobody receives them.
+type DutyMonitor struct {
+	Alarms chan DutyAlarm
+
+	pin        Pin
+	window     time.Duration
+	thresholds []float64
+	above      []bool
+
+	mu       sync.Mutex
+	duty     float64
+	measured bool
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewDutyMonitor starts measuring the duty cycle of an input pin over windows of the
+// given length. The pin's edge setting is changed to both.
+// Thresholds are fractions between 0 and 1.
+func NewDutyMonitor(p Pin, window time.Duration, thresholds ...float64) (*DutyMonitor, error) {
+	if p.dir() != DirectionIn {
+		return nil, errWrongDirection(p, DirectionIn)
+	}
+	if window <= 0 {
+		return nil, fmt.Errorf("invalid duty window %s", window)
+	}
+	for _, t := range thresholds {
+		if t < 0 || t > 1 {
+			return nil, fmt.Errorf("invalid duty threshold %f", t)
+		}
+	}
+	if err := setEdgeTrigger(p, EdgeBoth); err != nil {
+		return nil, err
+	}
+	m := &DutyMonitor{
+		Alarms:     make(chan DutyAlarm, dutyAlarmLen),
+		pin:        p,
+		window:     window,
+		thresholds: thresholds,
+		above:      make([]bool, len(thresholds)),
+		stop:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	spawn("DutyMonitor", []uint{p.Number}, m.run)
+	return m, nil
+}
+
+// Duty returns the duty cycle measured over the last complete window.
+// ok is false until a first window has been measured.
+func (m *DutyMonitor) Duty() (duty float64, ok bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.duty, m.measured
+}
+
+func (m *DutyMonitor) run() {
+	defer close(m.stopped)
+	v, err := readPin(m.pin)
+	if err != nil {
+		logger().Error("failed to read duty monitor pin", "pin", m.pin.Number, "err", err)
+		return
+	}
+	for {
+		start := time.Now()
+		end := start.Add(m.window)
+		last := start
+		var high time.Duration
+		for {
+			select {
+			case <-m.stop:
+				return
+			default:
+			}
+			remaining := time.Until(end)
+			if remaining <= 0 {
+				break
+			}
+			changed, err := waitForEdge(m.pin, remaining)
+			if err != nil {
+				logger().Error("duty monitor stopped", "pin", m.pin.Number, "err", err)
+				return
+			}
+			if !changed {
+				continue
+			}
+			now := time.Now()
+			if v == 1 {
+				high += now.Sub(last)
+			}
+			last = now
+			if v, err = readPin(m.pin); err != nil {
+				logger().Error("duty monitor stopped", "pin", m.pin.Number, "err", err)
+				return
+			}
+		}
+		now := time.Now()
+		if v == 1 {
+			high += now.Sub(last)
+		}
+		m.update(float64(high)/float64(now.Sub(start)), now)
+	}
+}
+
+func (m *DutyMonitor) update(duty float64, now time.Time) {
+	m.mu.Lock()
+	first := !m.measured
+	m.duty = duty
+	m.measured = true
+	m.mu.Unlock()
+
+	for i, t := range m.thresholds {
+		above := duty > t
+		if above == m.above[i] && !first {
+			continue
+		}
+		m.above[i] = above
+		// the first window only establishes which side of the thresholds the signal is on
+		if first {
+			continue
+		}
+		select {
+		case m.Alarms <- DutyAlarm{Threshold: t, Above: above, Duty: duty, Time: now}:
+		default:
+		}
+	}
+}
+
+// Close stops the monitor. The pin is left open
+func (m *DutyMonitor) Close() {
+	close(m.stop)
+	<-m.stopped
+}
@@ -0,0 +1,90 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// DwellPolicy selects what happens to writes which would change an output before its
+// minimum dwell time is over, see WithMinDwell
+type DwellPolicy uint
+
+const (
+	// DwellReject fails the write with a *DwellError
+	DwellReject DwellPolicy = iota
+	// DwellDelay blocks the write until the dwell time is over
+	DwellDelay
+)
+
+// DwellError is returned by writes rejected for changing an output sooner than its minimum
+// dwell time. Remaining is how long the output has to keep its value.
+type DwellError struct {
+	Pin       uint
+	Remaining time.Duration
+}
+
+func (e *DwellError) Error() string {
+	return fmt.Sprintf("gpio %d must keep its value for another %s", e.Pin, e.Remaining.Round(time.Millisecond))
+}
+
+// dwell enforces the minimum time between the changes of an output
+type dwell struct {
+	min    time.Duration
+	policy DwellPolicy
+
+	mu      sync.Mutex
+	value   uint
+	changed time.Time
+}
+
+// WithMinDwell makes an output keep each value for at least d, e.g. to protect compressors
+// and pumps from short cycling. Writes changing the value sooner are rejected or delayed
+// according to policy, while writes of the current value always go through.
+// Opening the output counts as a change, since the previous state of the hardware is unknown.
+func WithMinDwell(d time.Duration, policy DwellPolicy) PinOption {
+	return func(c *pinConfig) {
+		c.minDwell = d
+		c.dwellPolicy = policy
+	}
+}
+
+func newDwell(d time.Duration, policy DwellPolicy) (*dwell, error) {
+	if d <= 0 {
+		return nil, fmt.Errorf("invalid minimum dwell time %s", d)
+	}
+	if policy != DwellReject && policy != DwellDelay {
+		return nil, errors.New("invalid dwell policy")
+	}
+	return &dwell{min: d, policy: policy}, nil
+}
+
+// opened starts the dwell time of the initial value
+func (d *dwell) opened(v uint) {
+	d.mu.Lock()
+	d.value = v
+	d.changed = time.Now()
+	d.mu.Unlock()
+}
+
+// write calls fn to write v once the dwell time allows it. Delayed writes hold back the other
+// writes to the output, so they are applied in order
+func (d *dwell) write(p Pin, v uint, fn func() error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if v != d.value {
+		if wait := time.Until(d.changed.Add(d.min)); wait > 0 {
+			if d.policy == DwellReject {
+				return &DwellError{Pin: p.Number, Remaining: wait}
+			}
+			time.Sleep(wait)
+		}
+	}
+	err := fn()
+	if err == nil && v != d.value {
+		d.value = v
+		d.changed = time.Now()
+	}
+	return err
+}
@@ -0,0 +1,54 @@
+package gpio
+
+import (
+	"time"
+)
+
+// edgePoller waits for edges on a single pin with select, since epoll is linux only
+type edgePoller struct {
+	pin   Pin
+	woken chan struct{}
+}
+
+func newEdgePoller(p Pin) (*edgePoller, error) {
+	return &edgePoller{
+		pin:   p,
+		woken: make(chan struct{}),
+	}, nil
+}
+
+// wait blocks until an edge is pending on the pin, wakeup is called or timeout elapses.
+// A negative timeout waits forever. It reports whether an edge is pending, the pin must be
+// read to clear it, and whether wakeup was called.
+func (e *edgePoller) wait(timeout time.Duration) (pending bool, woken bool, err error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		select {
+		case <-e.woken:
+			return false, true, nil
+		default:
+		}
+		slice := time.Second
+		if timeout >= 0 {
+			remaining := time.Until(deadline)
+			if remaining <= 0 {
+				return false, false, nil
+			}
+			if remaining < slice {
+				slice = remaining
+			}
+		}
+		changed, err := waitForEdge(e.pin, slice)
+		if err != nil || changed {
+			return changed, false, err
+		}
+	}
+}
+
+// wakeup makes the pending and all later waits return. It must only be called once
+func (e *edgePoller) wakeup() {
+	close(e.woken)
+}
+
+func (e *edgePoller) close() {
+}
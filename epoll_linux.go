@@ -0,0 +1,82 @@
+package gpio
+
+import (
+	"fmt"
+	"syscall"
+	"time"
+)
+
+// edgePoller waits for edges on a single pin with epoll.
+// A pipe is registered next to the pin so that wakeup can interrupt a wait at once.
+type edgePoller struct {
+	epfd int
+	wake [2]int
+}
+
+func newEdgePoller(p Pin) (*edgePoller, error) {
+	if p.Closed() {
+		return nil, errClosed(p.Number)
+	}
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create epoll instance, %s", err)
+	}
+	e := &edgePoller{epfd: epfd}
+	if err := syscall.Pipe2(e.wake[:], syscall.O_CLOEXEC); err != nil {
+		syscall.Close(epfd)
+		return nil, fmt.Errorf("failed to create wakeup pipe, %s", err)
+	}
+
+	fd := int(p.f.Fd())
+	// sysfs signals edges as priority data, character device lines queue them as readable events
+	events := uint32(syscall.EPOLLPRI | syscall.EPOLLERR)
+	if p.line != nil {
+		events = syscall.EPOLLIN
+	}
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, fd, &syscall.EpollEvent{Events: events, Fd: int32(fd)}); err != nil {
+		e.close()
+		return nil, fmt.Errorf("failed to add gpio %d to epoll, %s", p.Number, err)
+	}
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, e.wake[0], &syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(e.wake[0])}); err != nil {
+		e.close()
+		return nil, fmt.Errorf("failed to add wakeup pipe to epoll, %s", err)
+	}
+	return e, nil
+}
+
+// wait blocks until an edge is pending on the pin, wakeup is called or timeout elapses.
+// A negative timeout waits forever. It reports whether an edge is pending, the pin must be
+// read to clear it, and whether wakeup was called.
+func (e *edgePoller) wait(timeout time.Duration) (pending bool, woken bool, err error) {
+	msec := -1
+	if timeout >= 0 {
+		msec = int((timeout + time.Millisecond - 1) / time.Millisecond)
+	}
+	events := make([]syscall.EpollEvent, 2)
+	for {
+		n, err := syscall.EpollWait(e.epfd, events, msec)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return false, false, fmt.Errorf("failed to call syscall.EpollWait, %s", err)
+		}
+		for _, ev := range events[:n] {
+			if int(ev.Fd) == e.wake[0] {
+				return false, true, nil
+			}
+		}
+		return n > 0, false, nil
+	}
+}
+
+// wakeup makes the pending and all later waits return
+func (e *edgePoller) wakeup() {
+	syscall.Write(e.wake[1], []byte{0})
+}
+
+func (e *edgePoller) close() {
+	syscall.Close(e.wake[0])
+	syscall.Close(e.wake[1])
+	syscall.Close(e.epfd)
+}
@@ -0,0 +1,143 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Kinds of pin errors, to be tested with errors.Is
+var (
+	// ErrNotExported is the kind of errors for pins which aren't exported
+	ErrNotExported = errors.New("gpio is not exported")
+	// ErrPermission is the kind of errors for pin files this process may not open
+	ErrPermission = errors.New("no permission to access gpio")
+	// ErrWrongDirection is the kind of errors for pins used in the other direction than configured
+	ErrWrongDirection = errors.New("gpio is configured for the other direction")
+	// ErrInvalidValue is the kind of errors for values other than 0 and 1
+	ErrInvalidValue = errors.New("invalid gpio value")
+	// ErrClosed is the kind of errors for pins used after they were closed
+	ErrClosed = errors.New("gpio is closed")
+	// ErrHogged is the kind of errors for pins hogged by the device tree, see Hogs
+	ErrHogged = errors.New("gpio is hogged by the device tree")
+	// ErrMuxed is the kind of errors for pins muxed to a function other than GPIO, see Function
+	ErrMuxed = errors.New("gpio is muxed to another function")
+)
+
+// PinError is an error of an operation on a pin. Kind is one of the Err kinds above, or nil
+// when the error is of no particular kind, and Err is the underlying error.
+// errors.Is matches both Kind and the errors wrapped by Err, e.g. os.ErrPermission.
+type PinError struct {
+	Pin  uint
+	Kind error
+	Err  error
+}
+
+func (e *PinError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PinError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the kind of e
+func (e *PinError) Is(target error) bool {
+	return e.Kind != nil && target == e.Kind
+}
+
+func (d Direction) String() string {
+	switch d {
+	case DirectionIn:
+		return "input"
+	case DirectionOut:
+		return "output"
+	}
+	return fmt.Sprintf("direction %d", uint(d))
+}
+
+// errWrongDirection reports that p isn't configured for d
+func errWrongDirection(p Pin, d Direction) error {
+	return &PinError{
+		Pin:  p.Number,
+		Kind: ErrWrongDirection,
+		Err:  fmt.Errorf("gpio %d is not configured for %s", p.Number, d),
+	}
+}
+
+// checkDirection returns an error for the first of pins which isn't configured for d
+func checkDirection(d Direction, pins ...Pin) error {
+	for _, p := range pins {
+		if p.dir() != d {
+			return errWrongDirection(p, d)
+		}
+	}
+	return nil
+}
+
+// errInvalidValue reports a value other than 0 and 1 for pin
+func errInvalidValue(pin uint, v uint) error {
+	return &PinError{
+		Pin:  pin,
+		Kind: ErrInvalidValue,
+		Err:  fmt.Errorf("invalid output value %d for gpio %d", v, pin),
+	}
+}
+
+// errNotExported reports that pin isn't exported
+func errNotExported(pin uint) error {
+	return &PinError{
+		Pin:  pin,
+		Kind: ErrNotExported,
+		Err:  fmt.Errorf("gpio %d is not exported", pin),
+	}
+}
+
+// errClosed reports that pin was closed
+func errClosed(pin uint) error {
+	return &PinError{
+		Pin:  pin,
+		Kind: ErrClosed,
+		Err:  fmt.Errorf("gpio %d is closed", pin),
+	}
+}
+
+// errNotOpen reports that pin was never opened, which is treated like a closed pin
+func errNotOpen(pin uint) error {
+	return &PinError{
+		Pin:  pin,
+		Kind: ErrClosed,
+		Err:  fmt.Errorf("gpio %d is not open", pin),
+	}
+}
+
+// classFileError is like pinFileError for the export and unexport files of the gpio class,
+// whose absence doesn't tell anything about the pin
+func classFileError(pin uint, err error, format string) error {
+	var kind error
+	if os.IsPermission(err) {
+		kind = ErrPermission
+	}
+	return &PinError{
+		Pin:  pin,
+		Kind: kind,
+		Err:  fmt.Errorf(format, err),
+	}
+}
+
+// pinFileError attaches pin to an error accessing one of its files, wrapping err.
+// format must contain a %w verb for err as its last argument.
+func pinFileError(pin uint, err error, format string, args ...interface{}) error {
+	var kind error
+	switch {
+	case os.IsPermission(err):
+		kind = ErrPermission
+	case os.IsNotExist(err):
+		kind = ErrNotExported
+	}
+	return &PinError{
+		Pin:  pin,
+		Kind: kind,
+		Err:  fmt.Errorf(format, append(args, err)...),
+	}
+}
@@ -0,0 +1,10 @@
+package gpio
+
+import (
+	"errors"
+	"os"
+)
+
+func keyState(f *os.File, code uint16) (uint, error) {
+	return 0, errors.New("input devices are not supported on this system")
+}
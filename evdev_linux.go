@@ -0,0 +1,23 @@
+package gpio
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+)
+
+// keyMax is KEY_MAX of linux/input-event-codes.h
+const keyMax = 0x2ff
+
+// keyState reads whether key code is pressed with EVIOCGKEY
+func keyState(f *os.File, code uint16) (uint, error) {
+	if code > keyMax {
+		return 0, fmt.Errorf("invalid key code %d", code)
+	}
+	var keys [keyMax/8 + 1]byte
+	req := uintptr(iocRead)<<30 | unsafe.Sizeof(keys)<<16 | 'E'<<8 | 0x18
+	if err := ioctl(f.Fd(), req, unsafe.Pointer(&keys)); err != nil {
+		return 0, fmt.Errorf("failed to get the key state of %s: %s", f.Name(), err)
+	}
+	return uint(keys[code/8]>>(code%8)) & 1, nil
+}
@@ -0,0 +1,298 @@
+package gpio
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Event is an edge of an input delivered by Events
+type Event struct {
+	Pin uint
+	// Value is the value after the edge
+	Value uint
+	// Edge is EdgeRising or EdgeFalling
+	Edge Edge
+	Time time.Time
+	// Seq numbers the edges of the pin from 1, including those dropped because nobody
+	// received them, so a gap shows how many were lost
+	Seq uint64
+	// KernelTimestamp is true when Time was taken by the kernel at the edge, which is the
+	// case for character device lines. Otherwise it is when the edge was noticed.
+	KernelTimestamp bool
+	// Stamp is the kernel timestamp of the edge on the clock of the line, see WithEventClock,
+	// when KernelTimestamp is true. Time is converted from it, but the differences of Stamps
+	// are exact to the nanosecond, e.g. for measuring pulses.
+	Stamp time.Duration
+	// Simulated is true for the changes caused by SimulateInput
+	Simulated bool
+	// Coalesced is the number of earlier edges folded into this one, see OverflowCoalesce
+	Coalesced uint64
+}
+
+// EventClock is the kernel clock timestamping the edges of character device lines
+type EventClock uint
+
+const (
+	// EventClockMonotonic is CLOCK_MONOTONIC, which isn't affected by changes of the wall
+	// clock, so that intervals between edges are always right
+	EventClockMonotonic EventClock = iota
+	// EventClockRealtime is CLOCK_REALTIME, the wall clock, so that Stamps can be compared
+	// with those of other machines synchronized e.g. by PTP
+	EventClockRealtime
+)
+
+// WithEventClock selects the clock the kernel timestamps the edges of an input with,
+// EventClockMonotonic by default. It needs the character device backend.
+func WithEventClock(clock EventClock) PinOption {
+	return func(c *pinConfig) {
+		c.eventClock = clock
+		c.setEventClock = true
+	}
+}
+
+// eventStream delivers the edges of a pin on a channel until the pin is closed
+type eventStream struct {
+	// dropped counts the edges lost to a full buffer. It is accessed atomically, so it comes
+	// first to be aligned on 32 bit platforms.
+	dropped uint64
+
+	ch      chan Event
+	pin     Pin
+	edge    Edge
+	poller  *edgePoller
+	sim     *simSub
+	stopped chan struct{}
+	buffer  eventBuffer
+	// quit is closed on stop to unblock the sends waiting for room
+	quit chan struct{}
+	// kick and forwarded are used by the forward goroutine with OverflowCoalesce
+	kick      chan struct{}
+	forwarded chan struct{}
+
+	// mu serializes the physical and simulated events
+	mu   sync.Mutex
+	last uint
+	seq  uint64
+	done bool
+	// overflow is the coalesced event waiting for room
+	overflow *Event
+	// callbacks are run in order by a goroutine started with the first one, see OnChange
+	callbacks []*Callback
+	calls     chan func()
+}
+
+// Events delivers the edges of an input on a channel, with their value, kind and time, in
+// the order they happened. The pin must have been opened with an edge, see WithEdge.
+// The channel is shared by the copies of the pin and closed when the pin is closed.
+// Edges arriving while the buffer of the channel is full are dropped, which shows as a gap in
+// Seq, unless the pin was opened with another policy, see WithEventBuffer.
+// Unlike Watch, the edges aren't debounced, so debounced pins are refused.
+func (p Pin) Events() (<-chan Event, error) {
+	s, err := p.eventStream()
+	if err != nil {
+		return nil, err
+	}
+	return s.ch, nil
+}
+
+// eventStream returns the stream of the pin, starting it on first use
+func (p Pin) eventStream() (*eventStream, error) {
+	if p.dir() != DirectionIn {
+		return nil, errWrongDirection(p, DirectionIn)
+	}
+	if p.debounce != nil {
+		return nil, errors.New("events of debounced pins are only delivered by Watch")
+	}
+	if p.state == nil {
+		return nil, errClosed(p.Number)
+	}
+	p.lock()
+	s := p.state.events
+	p.unlock()
+	if s != nil {
+		return s, nil
+	}
+	edge, err := readEdgeTrigger(p)
+	if err != nil {
+		return nil, err
+	}
+	if edge == EdgeNone {
+		return nil, errors.New("pin events need an edge, see WithEdge")
+	}
+	// reading clears the event pending since the pin was opened
+	v, err := readPin(p)
+	if err != nil {
+		return nil, err
+	}
+	poller, err := newEdgePoller(p)
+	if err != nil {
+		return nil, err
+	}
+	buffer := defaultEventBuffer
+	if p.buffer != nil {
+		buffer = *p.buffer
+	}
+	s = &eventStream{
+		ch:      make(chan Event, buffer.size),
+		pin:     p,
+		edge:    edge,
+		poller:  poller,
+		stopped: make(chan struct{}),
+		buffer:  buffer,
+		quit:    make(chan struct{}),
+		last:    v,
+	}
+	if buffer.policy == OverflowCoalesce {
+		s.kick = make(chan struct{}, 1)
+		s.forwarded = make(chan struct{})
+	}
+	p.lock()
+	if p.state.closed || p.state.events != nil {
+		// closed or raced with another call
+		other := p.state.events
+		p.unlock()
+		poller.close()
+		if other == nil {
+			return nil, errClosed(p.Number)
+		}
+		return other, nil
+	}
+	p.state.events = s
+	p.unlock()
+	if s.forwarded != nil {
+		spawn("Events", []uint{p.Number}, s.forward)
+	}
+	s.sim = subscribeSim(p, func(prev uint, cur uint, simulated bool) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.last = cur
+		if edgeMatches(s.edge, prev, cur) {
+			s.send(cur, valueEdge(cur), time.Now(), 0, simulated)
+		}
+	})
+	spawn("Events", []uint{p.Number}, s.run)
+	return s, nil
+}
+
+func (s *eventStream) run() {
+	defer close(s.stopped)
+	for {
+		_, woken, err := s.poller.wait(-1)
+		if err != nil {
+			logger().Error("pin events stopped", "pin", s.pin.Number, "err", err)
+			return
+		}
+		if woken {
+			return
+		}
+		if err := s.deliver(); err != nil {
+			if !errors.Is(err, ErrClosed) {
+				logger().Error("pin events stopped", "pin", s.pin.Number, "err", err)
+			}
+			return
+		}
+	}
+}
+
+// deliver sends the pending edges of the pin. Lines report each edge with its kind and
+// kernel timestamp, sysfs pins only that the value changed.
+func (s *eventStream) deliver() error {
+	var edges []lineEdge
+	var v uint
+	var err error
+	now := time.Now()
+	if s.pin.line != nil {
+		edges, err = lineEdges(s.pin)
+	} else {
+		v, err = readPhysical(s.pin)
+	}
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := simulatedInput(s.pin.Number); ok {
+		// the physical edges of a simulated input don't change what it reads
+		return nil
+	}
+	if s.pin.line == nil {
+		// with both edges a wakeup may follow an edge which was already undone, while a
+		// wakeup for a single edge is always one
+		edge := s.edge
+		if edge == EdgeBoth {
+			if v == s.last {
+				return nil
+			}
+			edge = valueEdge(v)
+		}
+		s.last = v
+		s.sendPhysical(v, edge, now, 0)
+		return nil
+	}
+	for _, e := range edges {
+		v := uint(0)
+		if e.rising {
+			v = 1
+		}
+		s.last = v
+		s.sendPhysical(v, valueEdge(v), e.at, e.stamp)
+	}
+	return nil
+}
+
+// valueEdge returns the edge leading to v
+func valueEdge(v uint) Edge {
+	if v == 1 {
+		return EdgeRising
+	}
+	return EdgeFalling
+}
+
+// sendPhysical sends a physical edge unless a fault drops it. s.mu must be held
+func (s *eventStream) sendPhysical(v uint, edge Edge, at time.Time, stamp time.Duration) {
+	if injectFault(FaultEvent, s.pin, "value") != nil {
+		return
+	}
+	s.send(v, edge, at, stamp, false)
+}
+
+// send numbers an edge and queues it. stamp is the kernel timestamp of the edge, 0 when it
+// has none. s.mu must be held
+func (s *eventStream) send(v uint, edge Edge, at time.Time, stamp time.Duration, simulated bool) {
+	if s.done {
+		return
+	}
+	s.seq++
+	ev := Event{
+		Pin:             s.pin.Number,
+		Value:           v,
+		Edge:            edge,
+		Time:            at,
+		Seq:             s.seq,
+		KernelTimestamp: stamp != 0,
+		Stamp:           stamp,
+		Simulated:       simulated,
+	}
+	s.queue(ev)
+	s.callBack(ev)
+}
+
+// stop ends the stream and closes its channel, once the pin is closed
+func (s *eventStream) stop() {
+	close(s.quit)
+	s.sim.unsubscribe()
+	s.poller.wakeup()
+	<-s.stopped
+	if s.forwarded != nil {
+		<-s.forwarded
+	}
+	s.poller.close()
+	s.mu.Lock()
+	s.done = true
+	close(s.ch)
+	if s.calls != nil {
+		close(s.calls)
+	}
+	s.mu.Unlock()
+}
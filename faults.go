@@ -0,0 +1,143 @@
+package gpio
+
+import (
+	"errors"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+)
+
+// FaultOp names a sysfs operation that a Fault can be injected into
+type FaultOp string
+
+const (
+	FaultExport     FaultOp = "export"
+	FaultDirection  FaultOp = "direction"
+	FaultEdge       FaultOp = "edge"
+	FaultLogicLevel FaultOp = "active_low"
+	FaultOpen       FaultOp = "open"
+	FaultRead       FaultOp = "read"
+	FaultWrite      FaultOp = "write"
+	// FaultEvent applies to the edges delivered by Watchers and PinWatches
+	FaultEvent FaultOp = "event"
+)
+
+// Fault describes a failure to simulate on a sysfs operation, for testing retry and error handling.
+// The fault applies to the pins listed in Pins, or to all pins when Pins is empty.
+// Delay is waited before the operation, which simulates slow udev rules.
+// Err, when set, makes the operation fail with it (e.g. syscall.EBUSY or syscall.EACCES)
+// wrapped in an *os.PathError. ShortRead makes a read return no data.
+// Drop makes a FaultEvent lose the edge.
+// Rate, when non zero, is the probability that the fault fires on a matching operation, which
+// turns it into chaos for checking that control loops degrade gracefully, e.g. with
+// Fault{Op: FaultRead, Delay: 20 * time.Millisecond, Rate: 0.01}.
+// Count is the number of times the fault fires before it is removed, 0 means forever.
+type Fault struct {
+	Op        FaultOp
+	Pins      []uint
+	Delay     time.Duration
+	Err       error
+	ShortRead bool
+	Drop      bool
+	Rate      float64
+	Count     int
+}
+
+var (
+	faultMu   sync.Mutex
+	faults    []*Fault
+	faultRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// errDropped is injected into events which a fault drops
+var errDropped = errors.New("event dropped")
+
+// SeedFaults seeds the choice of the operations hit by faults with a Rate, so that a failing
+// run can be replayed
+func SeedFaults(seed int64) {
+	faultMu.Lock()
+	faultRand = rand.New(rand.NewSource(seed))
+	faultMu.Unlock()
+}
+
+// InjectFault adds a fault to be simulated. It should only be used in tests and resilience
+// testing, never in production
+func InjectFault(f Fault) {
+	faultMu.Lock()
+	faults = append(faults, &f)
+	faultMu.Unlock()
+}
+
+// ClearFaults removes all injected faults
+func ClearFaults() {
+	faultMu.Lock()
+	faults = nil
+	faultMu.Unlock()
+}
+
+// SetSysfsRoot makes the package use dir instead of /sys/class/gpio.
+// dir should be laid out like the gpio class directory, with a gpioN directory per
+// exported pin; this is meant for running against fixtures in tests.
+func SetSysfsRoot(dir string) {
+	sysfsRoot = dir
+}
+
+func (f *Fault) matches(op FaultOp, pin uint) bool {
+	if f.Op != op {
+		return false
+	}
+	if len(f.Pins) == 0 {
+		return true
+	}
+	for _, p := range f.Pins {
+		if p == pin {
+			return true
+		}
+	}
+	return false
+}
+
+// injectFault simulates the first fault matching op on p, if any.
+// attr is the file of the operation, the path of which is only built for a failing fault.
+func injectFault(op FaultOp, p Pin, attr string) error {
+	faultMu.Lock()
+	var fault *Fault
+	for i, f := range faults {
+		if f.matches(op, p.Number) {
+			if f.Rate != 0 && faultRand.Float64() >= f.Rate {
+				continue
+			}
+			fault = f
+			if f.Count > 0 {
+				f.Count--
+				if f.Count == 0 {
+					faults = append(faults[:i:i], faults[i+1:]...)
+				}
+			}
+			break
+		}
+	}
+	faultMu.Unlock()
+	if fault == nil {
+		return nil
+	}
+
+	if fault.Delay > 0 {
+		time.Sleep(fault.Delay)
+	}
+	if fault.ShortRead {
+		return errShortRead
+	}
+	if fault.Drop {
+		return errDropped
+	}
+	if fault.Err != nil {
+		path := pinPath(p, attr)
+		if op == FaultExport {
+			path = classPath(attr)
+		}
+		return &os.PathError{Op: string(op), Path: path, Err: fault.Err}
+	}
+	return nil
+}
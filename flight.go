@@ -0,0 +1,115 @@
+package gpio
+
+import (
+	"errors"
+	"time"
+)
+
+// Flight is an interval measured by MeasureFlight.
+// KernelTimestamps is true when both edges were timestamped by the kernel, which is only
+// the case for pins opened through the character device backend. Otherwise the edges are
+// timed when this package notices them, which adds the scheduling jitter of both wakeups.
+type Flight struct {
+	Interval         time.Duration
+	KernelTimestamps bool
+}
+
+// MeasureFlight waits for an edge on a and then for the next edge on b, and returns the time
+// between them, e.g. for a pair of light gates used as a speed trap. Both pins are inputs
+// and their edge settings are changed to edge. Edges on b before the one on a are ignored.
+// ErrTimeout is returned if both edges don't happen within timeout.
+func MeasureFlight(a Pin, b Pin, edge Edge, timeout time.Duration) (Flight, error) {
+	if err := checkDirection(DirectionIn, a, b); err != nil {
+		return Flight{}, err
+	}
+	if edge == EdgeNone {
+		return Flight{}, errors.New("measuring a flight needs an edge")
+	}
+	kernel := a.line != nil
+	if kernel != (b.line != nil) {
+		return Flight{}, errors.New("flight gate pins use different backends")
+	}
+	for _, p := range []Pin{a, b} {
+		if err := setEdgeTrigger(p, edge); err != nil {
+			return Flight{}, err
+		}
+	}
+	start := time.Now()
+	deadline := start.Add(timeout)
+	// drop the edges which happened before the measurement
+	for _, p := range []Pin{a, b} {
+		if _, err := edgeStamps(p, start); err != nil {
+			return Flight{}, err
+		}
+	}
+
+	ta, err := nextEdgeStamp(a, start, deadline, 0)
+	if err != nil {
+		return Flight{}, err
+	}
+	if !kernel {
+		// without timestamps, edges pending on b can't be told apart, so drop them now
+		if _, err := edgeStamps(b, start); err != nil {
+			return Flight{}, err
+		}
+	}
+	tb, err := nextEdgeStamp(b, start, deadline, ta)
+	if err != nil {
+		return Flight{}, err
+	}
+	return Flight{Interval: tb - ta, KernelTimestamps: kernel}, nil
+}
+
+// edgeStamps clears the edges pending on p and returns their times. Character device lines
+// report kernel timestamps, sysfs pins report a single edge timed now relative to start.
+func edgeStamps(p Pin, start time.Time) ([]time.Duration, error) {
+	if p.line != nil {
+		edges, err := lineEdges(p)
+		stamps := make([]time.Duration, len(edges))
+		for i, e := range edges {
+			stamps[i] = e.stamp
+		}
+		return stamps, err
+	}
+	pending, err := waitForEdge(p, 0)
+	if err != nil || !pending {
+		return nil, err
+	}
+	now := time.Since(start)
+	if _, err := readPin(p); err != nil {
+		return nil, err
+	}
+	return []time.Duration{now}, nil
+}
+
+// lineEdges clears the edge events pending on a line and returns them
+func lineEdges(p Pin) ([]lineEdge, error) {
+	p.lock()
+	defer p.unlock()
+	if err := p.checkOpen(); err != nil {
+		return nil, err
+	}
+	return p.line.events(p.f)
+}
+
+// nextEdgeStamp waits for the first edge on p at or after the time after
+func nextEdgeStamp(p Pin, start time.Time, deadline time.Time, after time.Duration) (time.Duration, error) {
+	for {
+		stamps, err := edgeStamps(p, start)
+		if err != nil {
+			return 0, err
+		}
+		for _, t := range stamps {
+			if t >= after {
+				return t, nil
+			}
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return 0, ErrTimeout
+		}
+		if _, err := waitForEdge(p, remaining); err != nil {
+			return 0, err
+		}
+	}
+}
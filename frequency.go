@@ -0,0 +1,70 @@
+package gpio
+
+import (
+	"fmt"
+	"time"
+)
+
+// MeasureFrequency counts the rising edges of an input over window and returns their
+// frequency in Hz, e.g. for fan tachometers, flow meters and square wave sensors. The pin's
+// edge setting is changed to rising, and the edges are counted from interrupts rather than
+// by polling. On character device lines the frequency is taken between the kernel
+// timestamps of the first and last edges of the window, which is accurate to microseconds.
+// Sysfs pins count one edge per wakeup, which misses edges above a few kHz, and divide by
+// the window.
+func (p Pin) MeasureFrequency(window time.Duration) (float64, error) {
+	if p.dir() != DirectionIn {
+		return 0, errWrongDirection(p, DirectionIn)
+	}
+	if window <= 0 {
+		return 0, fmt.Errorf("invalid frequency window %s", window)
+	}
+	if err := setEdgeTrigger(p, EdgeRising); err != nil {
+		return 0, err
+	}
+	start := time.Now()
+	// drop the edges which happened before the measurement
+	if _, err := edgeStamps(p, start); err != nil {
+		return 0, err
+	}
+	end := start.Add(window)
+	var n int
+	var first, last time.Duration
+	for {
+		if p.line != nil {
+			edges, err := lineEdges(p)
+			if err != nil {
+				return 0, err
+			}
+			for _, e := range edges {
+				if e.at.After(end) {
+					continue
+				}
+				if n == 0 {
+					first = e.stamp
+				}
+				last = e.stamp
+				n++
+			}
+		} else {
+			stamps, err := edgeStamps(p, start)
+			if err != nil {
+				return 0, err
+			}
+			if time.Now().Before(end) {
+				n += len(stamps)
+			}
+		}
+		remaining := time.Until(end)
+		if remaining <= 0 {
+			break
+		}
+		if _, err := waitForEdge(p, remaining); err != nil {
+			return 0, err
+		}
+	}
+	if p.line != nil && n >= 2 && last > first {
+		return float64(n-1) / (last - first).Seconds(), nil
+	}
+	return float64(n) / window.Seconds(), nil
+}
@@ -0,0 +1,169 @@
+package gpio
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FSMState is a state of an FSM.
+// Enter and Exit map Manager output names to the values they are set to
+// when the state is entered and left.
+type FSMState struct {
+	Name  string
+	Enter map[string]uint
+	Exit  map[string]uint
+}
+
+// FSMTransition moves an FSM from state From to state To when Input sees Edge
+type FSMTransition struct {
+	From  string
+	To    string
+	Input string
+	Edge  Edge
+}
+
+// FSM is a finite state machine driven by edges on the inputs of a Manager
+type FSM struct {
+	m           *Manager
+	states      map[string]FSMState
+	transitions []FSMTransition
+	inputs      map[uint]string
+	last        map[uint]uint
+	watcher     *Watcher
+
+	mu      sync.Mutex
+	current string
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewFSM validates the states and transitions against m, enters initial and starts watching
+// the inputs referred to by transitions
+func NewFSM(m *Manager, initial string, states []FSMState, transitions []FSMTransition) (*FSM, error) {
+	f := &FSM{
+		m:           m,
+		states:      make(map[string]FSMState),
+		transitions: transitions,
+		inputs:      make(map[uint]string),
+		last:        make(map[uint]uint),
+		done:        make(chan struct{}),
+		stopped:     make(chan struct{}),
+	}
+	for _, s := range states {
+		if _, ok := f.states[s.Name]; ok {
+			return nil, fmt.Errorf("duplicate state %q", s.Name)
+		}
+		for _, outputs := range []map[string]uint{s.Enter, s.Exit} {
+			for name, v := range outputs {
+				p, ok := m.Pin(name)
+				if !ok {
+					return nil, fmt.Errorf("state %q refers to unknown output %q", s.Name, name)
+				}
+				if p.dir() != DirectionOut {
+					return nil, fmt.Errorf("state %q output %q is not configured for output", s.Name, name)
+				}
+				if v > 1 {
+					return nil, fmt.Errorf("state %q sets invalid value %d on %q", s.Name, v, name)
+				}
+			}
+		}
+		f.states[s.Name] = s
+	}
+	if _, ok := f.states[initial]; !ok {
+		return nil, fmt.Errorf("unknown initial state %q", initial)
+	}
+	for _, t := range transitions {
+		if _, ok := f.states[t.From]; !ok {
+			return nil, fmt.Errorf("transition from unknown state %q", t.From)
+		}
+		if _, ok := f.states[t.To]; !ok {
+			return nil, fmt.Errorf("transition to unknown state %q", t.To)
+		}
+		p, ok := m.Pin(t.Input)
+		if !ok {
+			return nil, fmt.Errorf("transition refers to unknown input %q", t.Input)
+		}
+		f.inputs[p.Number] = t.Input
+	}
+
+	f.current = initial
+	f.apply(f.states[initial].Enter)
+
+	f.watcher = NewWatcher()
+	var pins []uint
+	for p := range f.inputs {
+		pins = append(pins, p)
+		if err := f.watcher.AddPin(p); err != nil {
+			f.watcher.Close()
+			return nil, fmt.Errorf("failed to watch fsm input: %s", err)
+		}
+	}
+	spawn("FSM", pins, f.run)
+	return f, nil
+}
+
+func (f *FSM) run() {
+	defer close(f.stopped)
+	for {
+		select {
+		case n := <-f.watcher.Notification:
+			prev, seen := f.last[n.Pin]
+			f.last[n.Pin] = n.Value
+			// the first notification only reports the initial value
+			if !seen || prev == n.Value {
+				continue
+			}
+			edge := EdgeFalling
+			if n.Value == 1 {
+				edge = EdgeRising
+			}
+			f.Trigger(f.inputs[n.Pin], edge)
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// Trigger feeds an edge on the named input to the FSM, as if it had been seen on the pin.
+// It returns the state the FSM is in afterwards.
+// This is useful to drive the FSM from tests or from sources other than pins.
+func (f *FSM) Trigger(input string, edge Edge) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, t := range f.transitions {
+		if t.From != f.current || t.Input != input {
+			continue
+		}
+		if t.Edge != EdgeBoth && t.Edge != edge {
+			continue
+		}
+		f.apply(f.states[f.current].Exit)
+		f.current = t.To
+		f.apply(f.states[f.current].Enter)
+		break
+	}
+	return f.current
+}
+
+func (f *FSM) apply(outputs map[string]uint) {
+	for name, v := range outputs {
+		if p, ok := f.m.Pin(name); ok {
+			Write(p, v)
+		}
+	}
+}
+
+// State returns the name of the current state
+func (f *FSM) State() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.current
+}
+
+// Close stops watching the inputs and waits for the FSM's goroutines to exit.
+// Outputs are left as they are
+func (f *FSM) Close() error {
+	close(f.done)
+	<-f.stopped
+	return f.watcher.Shutdown()
+}
@@ -0,0 +1,63 @@
+// Package gpiotest helps testing code which uses github.com/groove-x/gpio without gpio
+// hardware. New installs an in-memory chip in place of the kernel for one test.
+//
+//	func TestBrake(t *testing.T) {
+//		chip := gpiotest.New(t)
+//		runController() // opens gpio 22 as an input and gpio 17 as an output
+//		chip.SetInput(22, 1)
+//		gpiotest.AssertWrites(t, chip, 17, 1)
+//	}
+package gpiotest
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/groove-x/gpio"
+)
+
+// New installs a fresh gpio.Mock until the end of the test.
+// Tests using it must not run in parallel with other tests using the gpio package.
+func New(t testing.TB) *gpio.Mock {
+	m := gpio.NewMock()
+	gpio.SetMock(m)
+	t.Cleanup(func() {
+		gpio.SetMock(nil)
+	})
+	return m
+}
+
+// AssertWrites fails the test unless exactly want have been written to line n so far
+func AssertWrites(t testing.TB, m *gpio.Mock, n uint, want ...uint) {
+	t.Helper()
+	got := m.Writes(n)
+	if len(got) == 0 && len(want) == 0 {
+		return
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("writes to gpio %d = %v, want %v", n, got, want)
+	}
+}
+
+// AssertLevel fails the test unless line n is at the physical level want
+func AssertLevel(t testing.TB, m *gpio.Mock, n uint, want uint) {
+	t.Helper()
+	if got := m.Level(n); got != want {
+		t.Errorf("level of gpio %d = %d, want %d", n, got, want)
+	}
+}
+
+// WaitLevel waits up to timeout for line n to reach the physical level want, for outputs
+// driven from other goroutines, and fails the test if it doesn't
+func WaitLevel(t testing.TB, m *gpio.Mock, n uint, want uint, timeout time.Duration) {
+	t.Helper()
+	deadline := time.Now().Add(timeout)
+	for m.Level(n) != want {
+		if time.Now().After(deadline) {
+			t.Errorf("gpio %d didn't reach level %d within %s", n, want, timeout)
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
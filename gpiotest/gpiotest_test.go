@@ -0,0 +1,69 @@
+package gpiotest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/groove-x/gpio"
+)
+
+// fakeT records the failures of the assertions instead of failing the test
+type fakeT struct {
+	testing.TB
+	failed bool
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.failed = true
+}
+
+func TestAssertWrites(t *testing.T) {
+	chip := New(t)
+	p, err := gpio.NewPin(17, gpio.WithDirection(gpio.DirectionOut))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	ft := &fakeT{TB: t}
+	AssertWrites(ft, chip, 17)
+	if ft.failed {
+		t.Fatal("no writes didn't match no values")
+	}
+	if err := p.High(); err != nil {
+		t.Fatal(err)
+	}
+	AssertWrites(ft, chip, 17, 1)
+	if ft.failed {
+		t.Fatal("a matching write failed the test")
+	}
+	AssertWrites(ft, chip, 17, 0)
+	if !ft.failed {
+		t.Fatal("a wrong write didn't fail the test")
+	}
+}
+
+func TestWaitLevel(t *testing.T) {
+	chip := New(t)
+	p, err := gpio.NewPin(17, gpio.WithDirection(gpio.DirectionOut))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		p.High()
+	}()
+	ft := &fakeT{TB: t}
+	WaitLevel(ft, chip, 17, 1, time.Second)
+	if ft.failed {
+		t.Fatal("the level set by another goroutine wasn't seen")
+	}
+	WaitLevel(ft, chip, 17, 0, 10*time.Millisecond)
+	if !ft.failed {
+		t.Fatal("a level which isn't reached didn't fail the test")
+	}
+}
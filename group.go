@@ -0,0 +1,364 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// PinGroup reads and writes a set of pins as one value, e.g. the data lines of a parallel bus.
+// Bit i of a value is the pin at index i.
+// Groups opened with NewInputGroup or NewOutputGroup on lines of a single gpio character
+// device use one request for all lines, so the values change together. Otherwise the pins
+// are accessed one after the other, in the order set with SetWriteOrder, and the skew
+// between the first and the last change of a write is measured, see Skew.
+type PinGroup struct {
+	numbers []uint
+	output  bool
+	// pins are used when the group isn't a single request
+	pins []Pin
+	// bulk is the request of all lines, if any
+	bulk *os.File
+	// claims are the claims of the lines of bulk, see SetClaimDir
+	claims []*pinClaim
+	// owned is true when the group opened its pins
+	owned bool
+	last  uint64
+	// order is the order in which pins are written, bit order when nil
+	order []int
+
+	mu      sync.Mutex
+	maxSkew time.Duration
+	skew    GroupSkew
+}
+
+// GroupSkew is the skew measured on the writes of a group which isn't atomic: the time from
+// the first to the last pin change of a WriteAll. Exceeded counts the writes whose skew was
+// above the maximum set with SetMaxSkew.
+type GroupSkew struct {
+	Last     time.Duration
+	Max      time.Duration
+	Writes   uint64
+	Exceeded uint64
+}
+
+const maxGroupPins = 64
+
+func bulkMask(n int) uint64 {
+	if n >= 64 {
+		return ^uint64(0)
+	}
+	return 1<<uint(n) - 1
+}
+
+// NewPinGroup groups pins which are already open. They must all be inputs or all outputs.
+// The pins of such a group are always accessed one after the other.
+func NewPinGroup(pins ...Pin) (*PinGroup, error) {
+	if len(pins) == 0 {
+		return nil, errors.New("pin group needs at least one pin")
+	}
+	if len(pins) > maxGroupPins {
+		return nil, fmt.Errorf("too many pins for a group: %d", len(pins))
+	}
+	g := &PinGroup{
+		output: pins[0].dir() == DirectionOut,
+		pins:   pins,
+	}
+	for _, p := range pins {
+		if (p.dir() == DirectionOut) != g.output {
+			return nil, errors.New("pin group mixes inputs and outputs")
+		}
+		g.numbers = append(g.numbers, p.Number)
+		if g.output {
+			v, err := readValue(p)
+			if err != nil {
+				return nil, err
+			}
+			g.last |= uint64(v) << uint(len(g.numbers)-1)
+		}
+	}
+	return g, nil
+}
+
+// NewInputGroup opens the given pin numbers as inputs and groups them
+func NewInputGroup(numbers ...uint) (*PinGroup, error) {
+	return openGroup(numbers, false, 0)
+}
+
+// NewOutputGroup opens the given pin numbers as outputs and groups them.
+// Bit i of initial is the initial value of numbers[i].
+func NewOutputGroup(initial uint64, numbers ...uint) (*PinGroup, error) {
+	return openGroup(numbers, true, initial)
+}
+
+func openGroup(numbers []uint, output bool, initial uint64) (*PinGroup, error) {
+	if len(numbers) == 0 {
+		return nil, errors.New("pin group needs at least one pin")
+	}
+	if len(numbers) > maxGroupPins {
+		return nil, fmt.Errorf("too many pins for a group: %d", len(numbers))
+	}
+	g := &PinGroup{
+		numbers: numbers,
+		output:  output,
+		owned:   true,
+		last:    initial & bulkMask(len(numbers)),
+	}
+	if bulk, claims, err := openBulk(numbers, output, g.last); err != nil {
+		return nil, err
+	} else if bulk != nil {
+		g.bulk = bulk
+		g.claims = claims
+		return g, nil
+	}
+
+	for i, n := range numbers {
+		var p Pin
+		var err error
+		if output {
+			p, err = NewPin(n, WithDirection(DirectionOut), withInitial(initial>>uint(i)&1 == 1))
+		} else {
+			p, err = NewInput(n)
+		}
+		if err != nil {
+			for _, done := range g.pins {
+				done.Cleanup()
+			}
+			return nil, err
+		}
+		g.pins = append(g.pins, p)
+	}
+	return g, nil
+}
+
+// openBulk requests numbers as a single character device request when they all are lines
+// of the same chip, with the claims and checks NewPin makes for each of them. It returns nil
+// without an error when that isn't possible.
+func openBulk(numbers []uint, output bool, initial uint64) (*os.File, []*pinClaim, error) {
+	if installedMock() != nil || !useChardev() {
+		return nil, nil, nil
+	}
+	lines := make([]*cdevLine, len(numbers))
+	for i, n := range numbers {
+		l, err := lookupLine(n)
+		if err != nil {
+			return nil, nil, err
+		}
+		lines[i] = l
+		if l.chip != lines[0].chip {
+			return nil, nil, nil
+		}
+	}
+	var claims []*pinClaim
+	for _, n := range numbers {
+		c, err := claimPin(n)
+		if err == nil {
+			err = checkMux(Pin{Number: n})
+		}
+		if err == nil {
+			err = checkHog(Pin{Number: n})
+		}
+		claims = append(claims, c)
+		if err != nil {
+			releaseClaims(claims)
+			return nil, nil, err
+		}
+	}
+	f, err := requestBulk(lines, output, initial)
+	if err != nil {
+		releaseClaims(claims)
+		return nil, nil, err
+	}
+	return f, claims, nil
+}
+
+func releaseClaims(claims []*pinClaim) {
+	for _, c := range claims {
+		c.release()
+	}
+}
+
+// Len returns the number of pins in the group
+func (g *PinGroup) Len() int {
+	return len(g.numbers)
+}
+
+// Numbers returns the pin numbers of the group in bit order
+func (g *PinGroup) Numbers() []uint {
+	return append([]uint(nil), g.numbers...)
+}
+
+// Atomic reports whether the values of all pins are read and written at once
+func (g *PinGroup) Atomic() bool {
+	return g.bulk != nil
+}
+
+// ReadAll reads all pins of an input group
+func (g *PinGroup) ReadAll() (uint64, error) {
+	if g.output {
+		return 0, errors.New("pin group is not configured for input")
+	}
+	if g.bulk != nil {
+		return bulkGet(g.bulk, len(g.numbers))
+	}
+	var bits uint64
+	for i, p := range g.pins {
+		v, err := readPin(p)
+		if err != nil {
+			return 0, err
+		}
+		bits |= uint64(v) << uint(i)
+	}
+	return bits, nil
+}
+
+// SetWriteOrder sets the order in which WriteAll writes the pins of a group which isn't
+// atomic, e.g. the data lines before the strobe. order lists every bit index once.
+// Atomic groups change all pins together, so their order doesn't matter.
+func (g *PinGroup) SetWriteOrder(order ...int) error {
+	if len(order) != len(g.numbers) {
+		return fmt.Errorf("write order has %d pins, the group has %d", len(order), len(g.numbers))
+	}
+	seen := make([]bool, len(order))
+	for _, i := range order {
+		if i < 0 || i >= len(order) || seen[i] {
+			return fmt.Errorf("write order isn't a permutation of the %d bits of the group", len(order))
+		}
+		seen[i] = true
+	}
+	g.order = append([]int(nil), order...)
+	return nil
+}
+
+// SetMaxSkew sets the skew above which a write of a group which isn't atomic is logged as a
+// warning and counted in GroupSkew.Exceeded. Since sysfs writes take tens of microseconds
+// each and can be preempted, the skew grows with the number of pins changed and has no hard
+// bound, so the writes are still made. 0 disables the check.
+func (g *PinGroup) SetMaxSkew(d time.Duration) {
+	g.mu.Lock()
+	g.maxSkew = d
+	g.mu.Unlock()
+}
+
+// Skew returns the skew measured on the writes of the group, which is always zero for
+// atomic groups
+func (g *PinGroup) Skew() GroupSkew {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.skew
+}
+
+// WriteAll sets every pin of an output group to its bit in bits.
+// Without a single request, only the pins whose value changes are written, in the write
+// order.
+func (g *PinGroup) WriteAll(bits uint64) error {
+	if !g.output {
+		return errors.New("pin group is not configured for output")
+	}
+	bits &= bulkMask(len(g.numbers))
+	if g.bulk != nil {
+		return g.writeBulk(bits)
+	}
+	var first, last time.Time
+	for n := range g.pins {
+		i := n
+		if g.order != nil {
+			i = g.order[n]
+		}
+		p := g.pins[i]
+		v := uint(bits>>uint(i)) & 1
+		if uint(g.last>>uint(i))&1 == v {
+			continue
+		}
+		err := writePin(p, v)
+		audit(1, AuditSourceLocal, p.Number, v, err)
+		if err != nil {
+			return err
+		}
+		last = time.Now()
+		if first.IsZero() {
+			first = last
+		}
+		g.last = g.last&^(1<<uint(i)) | uint64(v)<<uint(i)
+	}
+	if !first.IsZero() {
+		g.measure(last.Sub(first))
+	}
+	return nil
+}
+
+// writeBulk writes the single request of a group with the checks writePin makes for each
+// pin. Such groups are opened by number rather than by a Manager, so they have no gate and
+// only the global dry run holds their writes back.
+func (g *PinGroup) writeBulk(bits uint64) error {
+	changed := bits ^ g.last
+	var err error
+	if isDryRun() {
+		for i, n := range g.numbers {
+			if changed>>uint(i)&1 != 0 {
+				dryRunWrite(Pin{Number: n}, uint(bits>>uint(i))&1)
+			}
+		}
+	} else {
+		for i, n := range g.numbers {
+			if changed>>uint(i)&1 == 0 {
+				continue
+			}
+			if ferr := injectFault(FaultWrite, Pin{Number: n}, "value"); ferr != nil {
+				err = fmt.Errorf("failed to write: %s", ferr)
+				break
+			}
+		}
+		if err == nil {
+			err = bulkSet(g.bulk, len(g.numbers), bits)
+		}
+	}
+	for i, n := range g.numbers {
+		if changed>>uint(i)&1 == 0 {
+			continue
+		}
+		v := uint(bits>>uint(i)) & 1
+		audit(2, AuditSourceLocal, n, v, err)
+		if err == nil && !isDryRun() {
+			watchWrite(Pin{Number: n}, v)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	g.last = bits
+	return nil
+}
+
+func (g *PinGroup) measure(skew time.Duration) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.skew.Last = skew
+	g.skew.Writes++
+	if skew > g.skew.Max {
+		g.skew.Max = skew
+	}
+	if g.maxSkew != 0 && skew > g.maxSkew {
+		g.skew.Exceeded++
+		logger().Warn("pin group write exceeded its maximum skew", "pins", g.numbers, "skew", skew, "max", g.maxSkew)
+	}
+}
+
+// Close closes the pins opened by NewInputGroup or NewOutputGroup and unexports those it
+// exported. Pins given to NewPinGroup are left open.
+func (g *PinGroup) Close() {
+	if g.bulk != nil {
+		g.bulk.Close()
+		releaseClaims(g.claims)
+		g.claims = nil
+		return
+	}
+	if !g.owned {
+		return
+	}
+	for _, p := range g.pins {
+		p.Cleanup()
+	}
+}
@@ -0,0 +1,115 @@
+package gpio
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// dtRoot is the device tree of the running system
+var dtRoot = "/proc/device-tree"
+
+// Hog is a line hogged by the device tree, which the kernel requests at boot to hold it as
+// an input or at a fixed output level. Hogged lines can't be opened.
+type Hog struct {
+	// Name is the name of the hog, its line-name property or node name, which the kernel
+	// also reports as the consumer of the line
+	Name string
+	// Chip is the name of the chip of the line, e.g. "gpiochip0"
+	Chip   string
+	Offset uint
+	// Number is the pin number of the line on the backend in use
+	Number    uint
+	Direction Direction
+}
+
+var (
+	dtHogsOnce sync.Once
+	dtHogs     map[string]bool
+)
+
+// dtHogNames returns the names of the hogs of the device tree, which is read once
+func dtHogNames() map[string]bool {
+	dtHogsOnce.Do(func() {
+		dtHogs = make(map[string]bool)
+		// /proc/device-tree is a link, which Walk wouldn't follow
+		root, err := filepath.EvalSymlinks(dtRoot)
+		if err != nil {
+			return
+		}
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() || info.Name() != "gpio-hog" {
+				return nil
+			}
+			node := filepath.Dir(path)
+			name := strings.SplitN(filepath.Base(node), "@", 2)[0]
+			if b, err := ioutil.ReadFile(node + "/line-name"); err == nil {
+				name = cString(b)
+			}
+			dtHogs[name] = true
+			return nil
+		})
+	})
+	return dtHogs
+}
+
+// Hogs returns the lines hogged by the device tree, found by the consumers of the lines in use
+func Hogs() ([]Hog, error) {
+	names := dtHogNames()
+	if len(names) == 0 {
+		return nil, nil
+	}
+	chips, err := Chips()
+	if err != nil {
+		return nil, err
+	}
+	var hogs []Hog
+	for _, chip := range chips {
+		for _, line := range chip.Lines {
+			if !line.Used || !names[line.Consumer] {
+				continue
+			}
+			n := line.Number
+			if !chardevNumbering() {
+				base, err := sysfsChipBase(chip.Label, uint(len(chip.Lines)))
+				if err != nil {
+					return nil, err
+				}
+				n = base + line.Offset
+			}
+			hogs = append(hogs, Hog{
+				Name:      line.Consumer,
+				Chip:      chip.Name,
+				Offset:    line.Offset,
+				Number:    n,
+				Direction: line.Direction,
+			})
+		}
+	}
+	return hogs, nil
+}
+
+// checkHog returns an error of kind ErrHogged if the pin is hogged, rather than letting the
+// kernel refuse it as busy. When the lines can't be queried the pin is assumed not hogged.
+func checkHog(p Pin) error {
+	if installedMock() != nil {
+		return nil
+	}
+	hogs, err := Hogs()
+	if err != nil {
+		return nil
+	}
+	for _, h := range hogs {
+		if h.Number == p.Number {
+			return &PinError{
+				Pin:  p.Number,
+				Kind: ErrHogged,
+				Err:  fmt.Errorf("gpio %d is hogged by the device tree as %q", p.Number, h.Name),
+			}
+		}
+	}
+	return nil
+}
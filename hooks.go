@@ -0,0 +1,280 @@
+package gpio
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EdgeHook runs a command and/or calls a webhook when Pin sees Edge.
+// Command is executed with GPIO_PIN and GPIO_VALUE set in its environment, as well as
+// GPIO_SIMULATED=1 for changes caused by SimulateInput.
+// URL receives a JSON POST with the pin, value and time of the event.
+// Debounce, when non zero, requires the new value to be stable that long before the hook fires.
+// MinInterval, when non zero, drops events which arrive sooner than that after the last run.
+type EdgeHook struct {
+	Pin         uint
+	Edge        Edge
+	Command     []string
+	URL         string
+	Debounce    time.Duration
+	MinInterval time.Duration
+}
+
+// HookEvent is the body sent to webhooks
+type HookEvent struct {
+	Pin       uint      `json:"pin"`
+	Value     uint      `json:"value"`
+	Time      time.Time `json:"time"`
+	Simulated bool      `json:"simulated,omitempty"`
+}
+
+const webhookTimeout = 5 * time.Second
+
+const (
+	hookWorkers  = 4
+	hookQueueLen = 32
+	hookTimeout  = time.Minute
+)
+
+type hookState struct {
+	hook    EdgeHook
+	stable  uint
+	pending *time.Timer
+	// gen is incremented whenever pending is replaced or stopped, so that a timer which
+	// fired while waiting for h.mu can tell it is stale
+	gen     uint64
+	lastRun time.Time
+}
+
+// HookRunner watches pins and runs the EdgeHooks attached to them
+type HookRunner struct {
+	watcher  *Watcher
+	dispatch *Dispatcher
+	client   *http.Client
+	byPin    map[uint][]*hookState
+	last     map[uint]uint
+
+	mu      sync.Mutex
+	closed  bool
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewHookRunner starts watching the pins referred to by hooks
+func NewHookRunner(hooks ...EdgeHook) (*HookRunner, error) {
+	h := &HookRunner{
+		client:  &http.Client{Timeout: webhookTimeout},
+		byPin:   make(map[uint][]*hookState),
+		last:    make(map[uint]uint),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	for i, hook := range hooks {
+		if hook.Edge == EdgeNone {
+			return nil, fmt.Errorf("hook %d has no edge", i)
+		}
+		if len(hook.Command) == 0 && hook.URL == "" {
+			return nil, fmt.Errorf("hook %d has neither a command nor a URL", i)
+		}
+		h.byPin[hook.Pin] = append(h.byPin[hook.Pin], &hookState{hook: hook})
+	}
+
+	h.watcher = NewWatcher()
+	var pins []uint
+	for p := range h.byPin {
+		pins = append(pins, p)
+		if err := h.watcher.AddPin(p); err != nil {
+			h.watcher.Close()
+			return nil, fmt.Errorf("failed to watch hook pin: %s", err)
+		}
+	}
+	h.dispatch = NewDispatcher(hookWorkers, hookQueueLen, hookTimeout)
+	spawn("HookRunner", pins, h.run)
+	return h, nil
+}
+
+func (h *HookRunner) run() {
+	defer close(h.stopped)
+	for {
+		select {
+		case n := <-h.watcher.Notification:
+			h.handle(n)
+		case <-h.done:
+			return
+		}
+	}
+}
+
+func (h *HookRunner) handle(n WatcherNotification) {
+	_, seen := h.last[n.Pin]
+	h.last[n.Pin] = n.Value
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, s := range h.byPin[n.Pin] {
+		if !seen {
+			// the first notification only reports the initial value
+			s.stable = n.Value
+			continue
+		}
+		if s.hook.Debounce == 0 {
+			h.settle(s, n.Value, n.Simulated)
+			continue
+		}
+		h.debounce(s, n.Value, n.Simulated)
+	}
+}
+
+// debounce is called with h.mu held to settle v once it has been stable for the debounce
+// of the hook, replacing the pending value
+func (h *HookRunner) debounce(s *hookState, v uint, simulated bool) {
+	if s.pending != nil {
+		s.pending.Stop()
+	}
+	s.gen++
+	gen := s.gen
+	s.pending = time.AfterFunc(s.hook.Debounce, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if h.closed || s.gen != gen {
+			return
+		}
+		s.pending = nil
+		h.settle(s, v, simulated)
+	})
+}
+
+// settle is called with h.mu held once v is considered the stable value of the pin
+func (h *HookRunner) settle(s *hookState, v uint, simulated bool) {
+	prev := s.stable
+	s.stable = v
+	if !edgeMatches(s.hook.Edge, prev, v) {
+		return
+	}
+	now := time.Now()
+	if s.hook.MinInterval != 0 && now.Sub(s.lastRun) < s.hook.MinInterval {
+		return
+	}
+	s.lastRun = now
+	ev := HookEvent{
+		Pin:       s.hook.Pin,
+		Value:     v,
+		Time:      now,
+		Simulated: simulated,
+	}
+	hook := s.hook
+	if !h.dispatch.Dispatch(func() { h.runHook(hook, ev) }) {
+		logger().Warn("hook queue is full, dropping event", "pin", hook.Pin)
+	}
+}
+
+func (h *HookRunner) runHook(hook EdgeHook, ev HookEvent) {
+	if len(hook.Command) != 0 {
+		if err := runHookCommand(hook.Pin, hook.Command, ev); err != nil {
+			logger().Error("failed to run hook command", "pin", hook.Pin, "err", err)
+		}
+	}
+	if hook.URL != "" {
+		if err := h.callWebhook(hook.URL, ev); err != nil {
+			logger().Error("failed to call webhook", "pin", hook.Pin, "err", err)
+		}
+	}
+}
+
+// runHookCommand runs command and logs its output. It is killed after hookTimeout, when the
+// dispatcher gives up on it.
+func runHookCommand(pin uint, command []string, ev HookEvent) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = append(os.Environ(),
+		"GPIO_PIN="+strconv.Itoa(int(ev.Pin)),
+		"GPIO_VALUE="+strconv.Itoa(int(ev.Value)),
+	)
+	if ev.Simulated {
+		cmd.Env = append(cmd.Env, "GPIO_SIMULATED=1")
+	}
+	stdout := &hookOutput{pin: pin, stream: "stdout"}
+	stderr := &hookOutput{pin: pin, stream: "stderr"}
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	err := cmd.Run()
+	stdout.flush()
+	stderr.flush()
+	return err
+}
+
+// hookOutput logs each line a hook command writes to one of its outputs
+type hookOutput struct {
+	pin    uint
+	stream string
+	buf    []byte
+}
+
+func (o *hookOutput) Write(b []byte) (int, error) {
+	o.buf = append(o.buf, b...)
+	for {
+		i := bytes.IndexByte(o.buf, '\n')
+		if i < 0 {
+			return len(b), nil
+		}
+		o.log(o.buf[:i])
+		o.buf = o.buf[i+1:]
+	}
+}
+
+// flush logs the last line if it isn't terminated
+func (o *hookOutput) flush() {
+	if len(o.buf) != 0 {
+		o.log(o.buf)
+		o.buf = nil
+	}
+}
+
+func (o *hookOutput) log(line []byte) {
+	logger().Info("hook command output", "pin", o.pin, "stream", o.stream, "line", string(line))
+}
+
+func (h *HookRunner) callWebhook(url string, ev HookEvent) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	resp, err := h.client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// Close stops watching pins and waits for queued hooks to finish
+func (h *HookRunner) Close() error {
+	close(h.done)
+	<-h.stopped
+	err := h.watcher.Shutdown()
+	h.mu.Lock()
+	h.closed = true
+	for _, states := range h.byPin {
+		for _, s := range states {
+			if s.pending != nil {
+				s.pending.Stop()
+				s.pending = nil
+			}
+		}
+	}
+	h.mu.Unlock()
+	h.dispatch.Close()
+	return err
+}
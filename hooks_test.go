@@ -0,0 +1,81 @@
+package gpio
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// The exits of hook commands interrupt the select of the Watcher next to them with SIGCHLD,
+// which must not stop it
+func TestHookCommandsDontStopWatcher(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	m := NewMock()
+	SetMock(m)
+	defer SetMock(nil)
+	out := filepath.Join(t.TempDir(), "runs")
+	h, err := NewHookRunner(EdgeHook{
+		Pin:     5,
+		Edge:    EdgeRising,
+		Command: []string{"sh", "-c", "echo $GPIO_VALUE >> " + out},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	// the watcher picks up its pins once a second
+	time.Sleep(1200 * time.Millisecond)
+	const edges = 20
+	for i := 0; i < edges; i++ {
+		m.SetInput(5, 1)
+		time.Sleep(50 * time.Millisecond)
+		m.SetInput(5, 0)
+		time.Sleep(50 * time.Millisecond)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		b, _ := os.ReadFile(out)
+		if runs := len(b) / 2; runs == edges {
+			return
+		} else if time.Now().After(deadline) {
+			t.Fatalf("hook ran %d times for %d rising edges", runs, edges)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// A debounce timer which fired while the runner was busy with a newer value doesn't settle
+// its stale value, nor does one which fired before Close
+func TestHookStaleDebounceTimers(t *testing.T) {
+	h := &HookRunner{dispatch: NewDispatcher(1, 1, time.Second)}
+	defer h.dispatch.Close()
+	s := &hookState{hook: EdgeHook{Pin: 5, Edge: EdgeBoth, Command: []string{"true"}, Debounce: 20 * time.Millisecond}}
+
+	h.mu.Lock()
+	h.debounce(s, 1, false)
+	// let the timer fire and wait for h.mu
+	time.Sleep(50 * time.Millisecond)
+	h.debounce(s, 0, false)
+	h.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	h.mu.Lock()
+	if s.stable != 0 || s.pending == nil {
+		t.Fatalf("the stale timer settled %d", s.stable)
+	}
+	h.mu.Unlock()
+
+	time.Sleep(50 * time.Millisecond)
+	h.mu.Lock()
+	h.debounce(s, 1, false)
+	time.Sleep(50 * time.Millisecond)
+	h.closed = true
+	h.mu.Unlock()
+	time.Sleep(5 * time.Millisecond)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s.stable != 0 {
+		t.Fatal("a timer settled after Close")
+	}
+}
@@ -0,0 +1,236 @@
+package gpio
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pwmRoot is the directory of the pwm class
+var pwmRoot = "/sys/class/pwm"
+
+// HardwarePWM is a channel of a PWM controller driven through /sys/class/pwm.
+// Unlike SoftPWM the signal is generated by the hardware, so it is suitable for servos and
+// fans which need a stable period. Period and duty are rounded to nanoseconds by the kernel.
+type HardwarePWM struct {
+	Chip    uint
+	Channel uint
+	// exported is true when this process exported the channel
+	exported bool
+}
+
+func (p HardwarePWM) chipPath(attr string) string {
+	return fmt.Sprintf("%s/pwmchip%d/%s", pwmRoot, p.Chip, attr)
+}
+
+func (p HardwarePWM) path(attr string) string {
+	return fmt.Sprintf("%s/pwmchip%d/pwm%d/%s", pwmRoot, p.Chip, p.Channel, attr)
+}
+
+func (p HardwarePWM) write(attr string, value string) error {
+	f, err := os.OpenFile(p.path(attr), os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open pwm %d/%d %s file for writing: %s", p.Chip, p.Channel, attr, err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte(value)); err != nil {
+		return fmt.Errorf("failed to write pwm %d/%d %s file: %s", p.Chip, p.Channel, attr, err)
+	}
+	return nil
+}
+
+func (p HardwarePWM) read(attr string) (string, error) {
+	b, err := ioutil.ReadFile(p.path(attr))
+	if err != nil {
+		return "", fmt.Errorf("failed to read pwm %d/%d %s file: %s", p.Chip, p.Channel, attr, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (p HardwarePWM) readDuration(attr string) (time.Duration, error) {
+	s, err := p.read(attr)
+	if err != nil {
+		return 0, err
+	}
+	ns, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("read invalid %s %q for pwm %d/%d", attr, s, p.Chip, p.Channel)
+	}
+	return time.Duration(ns), nil
+}
+
+func (p HardwarePWM) writeDuration(attr string, d time.Duration) error {
+	return p.write(attr, strconv.FormatInt(int64(d), 10))
+}
+
+func (p HardwarePWM) isExported() bool {
+	_, err := os.Stat(p.path(""))
+	return err == nil
+}
+
+func (p HardwarePWM) writeChip(file string) error {
+	f, err := os.OpenFile(p.chipPath(file), os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open pwm %s file for writing: %s", file, err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte(strconv.Itoa(int(p.Channel)))); err != nil {
+		return fmt.Errorf("failed to write pwm %s file: %s", file, err)
+	}
+	return nil
+}
+
+// NewHardwarePWM exports a channel of a PWM chip, sets its period and enables it with a
+// duty of 0, so the output stays inactive until SetDuty is called
+func NewHardwarePWM(chip uint, channel uint, period time.Duration) (HardwarePWM, error) {
+	p := HardwarePWM{
+		Chip:    chip,
+		Channel: channel,
+	}
+	if period <= 0 {
+		return HardwarePWM{}, fmt.Errorf("invalid pwm period %s", period)
+	}
+	if !p.isExported() {
+		if err := p.writeChip("export"); err != nil {
+			return HardwarePWM{}, err
+		}
+		p.exported = true
+		// udev may need a moment to give the new attributes their permissions
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := p.Disable(); err != nil {
+		p.Cleanup()
+		return HardwarePWM{}, err
+	}
+	if err := p.writeDuration("duty_cycle", 0); err != nil {
+		p.Cleanup()
+		return HardwarePWM{}, err
+	}
+	if err := p.writeDuration("period", period); err != nil {
+		p.Cleanup()
+		return HardwarePWM{}, err
+	}
+	if err := p.Enable(); err != nil {
+		p.Cleanup()
+		return HardwarePWM{}, err
+	}
+	return p, nil
+}
+
+// Period returns the PWM period
+func (p HardwarePWM) Period() (time.Duration, error) {
+	return p.readDuration("period")
+}
+
+// SetPeriod changes the period. A duty longer than the new period is shortened to it
+func (p HardwarePWM) SetPeriod(period time.Duration) error {
+	if period <= 0 {
+		return fmt.Errorf("invalid pwm period %s", period)
+	}
+	duty, err := p.Duty()
+	if err != nil {
+		return err
+	}
+	// the kernel rejects a duty longer than the period, so shorten it first
+	if duty > period {
+		if err := p.writeDuration("duty_cycle", period); err != nil {
+			return err
+		}
+	}
+	return p.writeDuration("period", period)
+}
+
+// Duty returns how long the output is active in every period
+func (p HardwarePWM) Duty() (time.Duration, error) {
+	return p.readDuration("duty_cycle")
+}
+
+// SetDuty sets how long the output is active in every period
+func (p HardwarePWM) SetDuty(duty time.Duration) error {
+	period, err := p.Period()
+	if err != nil {
+		return err
+	}
+	if duty < 0 || duty > period {
+		return fmt.Errorf("invalid pwm duty %s for period %s", duty, period)
+	}
+	return p.writeDuration("duty_cycle", duty)
+}
+
+// SetDutyCycle sets the duty as a fraction of the period between 0 and 1
+func (p HardwarePWM) SetDutyCycle(fraction float64) error {
+	if fraction < 0 || fraction > 1 {
+		return fmt.Errorf("invalid pwm duty cycle %f", fraction)
+	}
+	period, err := p.Period()
+	if err != nil {
+		return err
+	}
+	return p.writeDuration("duty_cycle", time.Duration(float64(period)*fraction))
+}
+
+// SetPolarity selects whether the duty is the high or the low part of a period.
+// Most controllers only change polarity while disabled, so the output is briefly
+// disabled if it was enabled.
+func (p HardwarePWM) SetPolarity(polarity PWMPolarity) error {
+	var s string
+	switch polarity {
+	case PolarityNormal:
+		s = "normal"
+	case PolarityInversed:
+		s = "inversed"
+	default:
+		return fmt.Errorf("invalid pwm polarity %d", polarity)
+	}
+	enabled, err := p.Enabled()
+	if err != nil {
+		return err
+	}
+	if enabled {
+		if err := p.Disable(); err != nil {
+			return err
+		}
+	}
+	if err := p.write("polarity", s); err != nil {
+		return err
+	}
+	if enabled {
+		return p.Enable()
+	}
+	return nil
+}
+
+// Enabled reports whether the PWM output is enabled
+func (p HardwarePWM) Enabled() (bool, error) {
+	s, err := p.read("enable")
+	if err != nil {
+		return false, err
+	}
+	return s == "1", nil
+}
+
+// Enable starts the PWM output
+func (p HardwarePWM) Enable() error {
+	return p.write("enable", "1")
+}
+
+// Disable stops the PWM output, which leaves it inactive
+func (p HardwarePWM) Disable() error {
+	return p.write("enable", "0")
+}
+
+// Close disables the PWM output. This doesn't unexport the channel, use Cleanup() instead
+func (p HardwarePWM) Close() {
+	p.Disable()
+}
+
+// Cleanup disables the PWM output and unexports the channel if it was exported by this process
+func (p HardwarePWM) Cleanup() {
+	p.Close()
+	if p.exported {
+		p.writeChip("unexport")
+	}
+}
@@ -1,134 +1,474 @@
 package gpio
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"os"
 	"time"
 )
 
-// Pin represents a single pin, which can be used either for reading or writing
+// Pin represents a single pin, which can be used either for reading or writing.
+//
+// Pins are values, and the copies returned by the With methods add behaviour to the same
+// open pin. The state of the open pin is shared by all of its copies: SetInput and SetOutput
+// change the direction of every copy, and closing a pin closes all of them, after which
+// their operations fail with ErrClosed.
+//
+// A Pin and its copies may be shared between goroutines: reads, writes, reconfigurations
+// and Close are serialized on the open file, so each of them sees the state left by the
+// previous one. Waiting for edges doesn't hold the pin, so other goroutines may read and
+// write it meanwhile, but it must not be closed until the wait is over.
 type Pin struct {
-	Number    uint
-	direction direction
-	f         *os.File
+	Number uint
+	f      *os.File
+	// state is shared by the copies of an open pin
+	state *pinState
+	// line is set for pins opened through the character device backend
+	line lineBackend
+	// cache is set on pins returned by WithReadCache
+	cache *readCache
+	// dedup is set on pins returned by WithWriteDedup
+	dedup *writeDedup
+	// gate is set on outputs of a Manager
+	gate *outputGate
+	// debounce is set on pins returned by WithDebounce
+	debounce *debouncer
+	// rate is set on outputs opened with WithMaxWriteRate
+	rate *rateLimiter
+	// wear is set on outputs tracked by a WearCounter
+	wear *wearTrack
+	// dwell is set on outputs opened with WithMinDwell
+	dwell *dwell
+	// buffer is set on inputs opened with WithEventBuffer
+	buffer *eventBuffer
 }
 
-func retry(retryN int, retryDuration time.Duration, fn func() error) error {
+// retry calls fn up to retryN times until it succeeds and returns the number of retries made.
+// It gives up with ctx.Err() when ctx is done.
+func retry(ctx context.Context, retryN int, retryDuration time.Duration, fn func() error) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
 	for i := 0; ; i++ {
 		err := fn()
 		if err != nil {
 			if i == retryN-1 {
-				return err
+				return i, err
 			} else {
-				fmt.Println(err.Error())
-				fmt.Printf("retrying...")
-				time.Sleep(retryDuration)
+				logger().Warn("retrying", "attempt", i+1, "attempts", retryN, "err", err)
+				if err := sleepCtx(ctx, retryDuration); err != nil {
+					return i, err
+				}
 			}
 		} else {
-			break
+			return i, nil
 		}
 	}
-	return nil
 }
 
+// sleepCtx sleeps for d and returns ctx.Err() if ctx is done before
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// NewInput opens the given pin number for reading. The number provided should be the pin number known by the kernel
 func NewInput(p uint) (Pin, error) {
-	return NewInputWithRetry(p, 1, 0)
+	return NewPin(p)
 }
 
-// NewInputWithRetry opens the given pin number for reading. The number provided should be the pin number known by the kernel
+// NewInputCtx is like NewInput but gives up when ctx is done, see NewPinCtx
+func NewInputCtx(ctx context.Context, p uint) (Pin, error) {
+	return NewPinCtx(ctx, p)
+}
+
+// NewInputWithRetry opens the given pin number for reading, retrying each setup step.
+//
+// Deprecated: use NewPin(p, WithRetry(retryN, retryDuration)).
 func NewInputWithRetry(p uint, retryN int, retryDuration time.Duration) (Pin, error) {
+	return NewPin(p, WithRetry(retryN, retryDuration))
+}
+
+// NewOutputWithRetry opens the given pin number for writing, initialized high (true) or low (false),
+// retrying each setup step.
+//
+// Deprecated: use NewPin(p, WithDirection(DirectionOut), WithInitialHigh(), WithRetry(retryN, retryDuration)).
+func NewOutputWithRetry(p uint, initHigh bool, retryN int, retryDuration time.Duration) (Pin, error) {
+	return NewPin(p, WithDirection(DirectionOut), withInitial(initHigh), WithRetry(retryN, retryDuration))
+}
+
+// PinState is the configuration of a pin as reported by the kernel
+type PinState struct {
+	Output     bool
+	Value      uint
+	Edge       Edge
+	LogicLevel LogicLevel
+}
+
+// Adopt opens a pin which has already been exported and configured, by this or another process,
+// without changing its direction or value. The pin is opened for reading or writing
+// according to the direction reported by the kernel, so adopting an output doesn't glitch it.
+// Adopting needs the sysfs backend, since character device lines are released with their owner.
+// The pin is claimed like NewPin claims it, see SetClaimDir.
+func Adopt(p uint) (Pin, error) {
 	pin := Pin{
 		Number: p,
 	}
-
-	err := retry(retryN, retryDuration, func() error {
-		err := exportGPIO(pin)
-		return err
-	})
+	if useChardev() || currentBackend() == BackendGPIOMem || installedMock() != nil {
+		return Pin{}, errNeedsSysfs
+	}
+	if !isExported(pin) {
+		return Pin{}, errNotExported(p)
+	}
+	dir, err := readDirection(pin)
 	if err != nil {
 		return Pin{}, err
 	}
+	claim, err := claimPin(p)
+	if err != nil {
+		return Pin{}, err
+	}
+	pin, err = openPin(pin, dir, false)
+	if err != nil {
+		claim.release()
+		return Pin{}, err
+	}
+	pin.state.claim = claim
+	return pin, nil
+}
 
-	time.Sleep(10 * time.Millisecond)
-	pin.direction = inDirection
+// SetInput turns an open pin into an input, e.g. to release an open drain bus such as
+// 1-Wire or I2C to its pull-up. All copies of p see the new direction.
+func (p Pin) SetInput() error {
+	if p.state == nil {
+		return errNotOpen(p.Number)
+	}
+	p.lock()
+	err := p.checkOpen()
+	p.unlock()
+	if err != nil {
+		return err
+	}
+	if err := setDirection(p, DirectionIn, 0); err != nil {
+		return err
+	}
+	p.lock()
+	defer p.unlock()
+	if err := p.checkOpen(); err != nil {
+		return err
+	}
+	// the value file of an output reads just as well
+	p.setDir(DirectionIn)
+	return nil
+}
 
-	err = retry(retryN, retryDuration, func() error {
-		err = setDirection(pin, inDirection, 0)
+// SetOutput turns an open pin into an output driven to initial, without glitching it to the
+// other value first. All copies of p see the new direction.
+func (p Pin) SetOutput(initial Value) error {
+	if initial != Inactive && initial != Active {
+		return errInvalidValue(p.Number, uint(initial))
+	}
+	if p.state == nil {
+		return errNotOpen(p.Number)
+	}
+	raw := uint(initial)
+	if p.line == nil {
+		// sysfs takes the initial value of an output as a raw value, ignoring active_low
+		level, err := readLogicLevel(p)
 		if err != nil {
 			return err
 		}
-		pin, err = openPin(pin, false)
+		if level == ActiveLow {
+			raw ^= 1
+		}
+	}
+	p.lock()
+	err := p.checkOpen()
+	if err == nil {
+		err = makeWritable(p)
+	}
+	p.unlock()
+	if err != nil {
 		return err
-	})
+	}
+	if err := setDirection(p, DirectionOut, raw); err != nil {
+		return err
+	}
+	p.setDir(DirectionOut)
+	return nil
+}
+
+// Probe reads back the current direction, value, edge and logic level of the pin from the kernel
+func (p Pin) Probe() (PinState, error) {
+	var st PinState
+	dir, err := readDirection(p)
 	if err != nil {
-		return Pin{}, err
+		return PinState{}, err
+	}
+	st.Output = dir == DirectionOut
+	if st.Value, err = readValue(p); err != nil {
+		return PinState{}, err
+	}
+	if st.Edge, err = readEdgeTrigger(p); err != nil {
+		return PinState{}, err
+	}
+	if st.LogicLevel, err = readLogicLevel(p); err != nil {
+		return PinState{}, err
 	}
+	return st, nil
+}
 
-	return pin, nil
+// Close releases the resources related to Pin. This doen't unexport Pin, use Cleanup() instead.
+// Closing a pin which was already closed, through any of its copies, does nothing.
+func (p Pin) Close() {
+	p.takeClaim().release()
+	p.close()
 }
 
-// NewOutputWithRetry opens the given pin number for writing. The number provided should be the pin number known by the kernel
-// NewOutputWithRetry also needs to know whether the pin should be initialized high (true) or low (false)
-func NewOutputWithRetry(p uint, initHigh bool, retryN int, retryDuration time.Duration) (Pin, error) {
-	var err error
+func (p Pin) close() {
+	p.lock()
+	var events *eventStream
+	if p.state != nil {
+		if p.state.closed {
+			p.unlock()
+			logger().Debug("gpio closed twice", "pin", p.Number)
+			return
+		}
+		p.state.closed = true
+		events = p.state.events
+	}
+	if p.f != nil {
+		p.f.Close()
+	}
+	p.unlock()
+	// the stream reads the pin, so it is stopped without holding the lock
+	if events != nil {
+		events.stop()
+	}
+}
 
-	pin := Pin{
-		Number: p,
+// takeClaim removes the claim of the pin, for the caller to release
+func (p Pin) takeClaim() *pinClaim {
+	if p.state == nil {
+		return nil
 	}
+	p.lock()
+	defer p.unlock()
+	claim := p.state.claim
+	p.state.claim = nil
+	return claim
+}
 
-	err = retry(retryN, retryDuration, func() error {
-		return exportGPIO(pin)
-	})
-	if err != nil {
-		return Pin{}, err
+// Backend returns the backend the pin was opened with, BackendSysfs, BackendChardev or
+// BackendGPIOMem, e.g. to log which one BackendAuto picked. Pins of a Mock report
+// BackendChardev, whose lines they emulate.
+func (p Pin) Backend() Backend {
+	if p.state == nil {
+		return lineKind(p.line)
 	}
+	return p.state.backend
+}
 
-	time.Sleep(10 * time.Millisecond)
-	initVal := uint(0)
-	if initHigh {
-		initVal = uint(1)
+// Closed reports whether the pin, or one of its copies, was closed
+func (p Pin) Closed() bool {
+	p.lock()
+	defer p.unlock()
+	return p.state != nil && p.state.closed
+}
+
+// Cleanup closes Pin and unexports it if it was exported by this process.
+// Pins which were already exported when they were opened, by another process
+// or by a previous run, are left exported. Use ForceCleanup to always unexport.
+func (p Pin) Cleanup() {
+	// the claim is kept until the pin is unexported, so that the next owner finds it unexported
+	claim := p.takeClaim()
+	p.close()
+	if p.state != nil && p.state.exported {
+		unexportGPIO(p)
+	}
+	claim.release()
+}
+
+// ForceCleanup closes Pin and unexports it regardless of who exported it
+func (p Pin) ForceCleanup() {
+	claim := p.takeClaim()
+	p.close()
+	unexportGPIO(p)
+	claim.release()
+}
+
+// Read returns the value read at the pin as reported by the kernel.
+// For an output this is the value it is driven to, so supervisory code can verify it.
+func (p Pin) Read() (value uint, err error) {
+	if p.cache != nil && !p.Closed() {
+		value, err = p.cache.read(p)
+	} else {
+		value, err = readPin(p)
+	}
+	if err != nil || p.debounce == nil {
+		return value, err
 	}
-	pin.direction = outDirection
+	value, _ = p.debounce.feed(value, time.Now())
+	return value, nil
+}
 
+// ErrTimeout is returned when a pin operation doesn't complete within its timeout
+var ErrTimeout = errors.New("gpio operation timed out")
 
-	err = retry(retryN, retryDuration, func() error {
-		return setDirection(pin, outDirection, initVal)
+// withTimeout runs fn, the operation op on p, and waits at most timeout for it to return.
+// When it times out fn keeps running in the background, since a blocked sysfs access can't be interrupted.
+func withTimeout(op string, p Pin, timeout time.Duration, fn func() error) error {
+	done := make(chan error, 1)
+	spawn(op, []uint{p.Number}, func() {
+		done <- fn()
 	})
-	if err != nil {
-		return Pin{}, err
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-t.C:
+		return ErrTimeout
 	}
+}
 
-	err = retry(retryN, retryDuration, func() error {
-		pin, err = openPin(pin, true)
+// ReadTimeout is like Read but returns ErrTimeout if the kernel doesn't answer within timeout.
+// An access which timed out may still be pending on the pin afterwards.
+func (p Pin) ReadTimeout(timeout time.Duration) (value uint, err error) {
+	err = withTimeout("ReadTimeout", p, timeout, func() error {
+		var err error
+		value, err = readPin(p)
 		return err
 	})
 	if err != nil {
-		return Pin{}, err
+		return 0, err
 	}
-	return pin, nil
+	return value, nil
 }
 
-// Close releases the resources related to Pin. This doen't unexport Pin, use Cleanup() instead
-func (p Pin) Close() {
-	if p.f != nil {
-		p.f.Close()
-		p.f = nil
+// WriteTimeout sets the value of an output pin to v (0 or 1) and returns ErrTimeout
+// if the kernel doesn't answer within timeout.
+// An access which timed out may still be pending on the pin afterwards.
+func (p Pin) WriteTimeout(v uint, timeout time.Duration) error {
+	if p.dir() != DirectionOut {
+		return errWrongDirection(p, DirectionOut)
 	}
+	return p.write(1, v, func() error {
+		return withTimeout("WriteTimeout", p, timeout, func() error {
+			return writePin(p, v)
+		})
+	})
 }
 
-// Cleanup close Pin and unexport it
-func (p Pin) Cleanup() {
-	p.Close()
-	unexportGPIO(p)
+// ReadStable waits until the value of an input pin has stayed the same for settle and returns it.
+// Edges are used to notice changes, so the pin's edge setting is changed to both.
+// ErrTimeout is returned if the value doesn't settle within timeout.
+func (p Pin) ReadStable(timeout time.Duration, settle time.Duration) (uint, error) {
+	if p.dir() != DirectionIn {
+		return 0, errWrongDirection(p, DirectionIn)
+	}
+	if err := setEdgeTrigger(p, EdgeBoth); err != nil {
+		return 0, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		// reading clears any pending edge
+		v, err := readPin(p)
+		if err != nil {
+			return 0, err
+		}
+		wait := settle
+		remaining := time.Until(deadline)
+		if remaining < wait {
+			if remaining <= 0 {
+				return 0, ErrTimeout
+			}
+			wait = remaining
+		}
+		changed, err := waitForEdge(p, wait)
+		if err != nil {
+			return 0, err
+		}
+		if !changed {
+			if wait < settle {
+				return 0, ErrTimeout
+			}
+			return v, nil
+		}
+	}
 }
 
-// Read returns the value read at the pin as reported by the kernel. This should only be used for input pins
-func (p Pin) Read() (value uint, err error) {
-	if p.direction != inDirection {
-		return 0, errors.New("pin is not configured for input")
+// WaitForEdge blocks until the given edge of an input pin or timeout and returns the value read
+// after the edge, which may differ from the edge's if the input has already changed again.
+// The pin's edge setting is changed to edge and edges from before the call are ignored.
+// ErrTimeout is returned if there was no edge within timeout.
+func (p Pin) WaitForEdge(edge Edge, timeout time.Duration) (Value, error) {
+	if p.dir() != DirectionIn {
+		return 0, errWrongDirection(p, DirectionIn)
+	}
+	if edge == EdgeNone {
+		return 0, errors.New("no edge to wait for")
+	}
+	if err := checkEdges(p); err != nil {
+		return 0, err
+	}
+	if err := setEdgeTrigger(p, edge); err != nil {
+		return 0, err
+	}
+	// reading clears any pending edge
+	if _, err := readPin(p); err != nil {
+		return 0, err
+	}
+	changed, err := waitForEdge(p, timeout)
+	if err != nil {
+		return 0, err
+	}
+	if !changed {
+		return 0, ErrTimeout
+	}
+	v, err := readPin(p)
+	if err != nil {
+		return 0, err
+	}
+	return Value(v), nil
+}
+
+// ctxPollInterval is how long WaitForEdgeCtx waits at most before checking its context again,
+// since select can't wait for a context
+const ctxPollInterval = 50 * time.Millisecond
+
+// WaitForEdgeCtx blocks until an edge of an input pin is reported, according to its edge
+// setting, and returns the value read after it. Edges from before the call are ignored.
+// ctx.Err() is returned if ctx is done before an edge.
+func (p Pin) WaitForEdgeCtx(ctx context.Context) (uint, error) {
+	if p.dir() != DirectionIn {
+		return 0, errWrongDirection(p, DirectionIn)
+	}
+	if err := checkEdges(p); err != nil {
+		return 0, err
+	}
+	// reading clears any pending edge
+	if _, err := readPin(p); err != nil {
+		return 0, err
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return 0, err
+		}
+		changed, err := waitForEdge(p, ctxPollInterval)
+		if err != nil {
+			return 0, err
+		}
+		if changed {
+			return readPin(p)
+		}
 	}
-	return readPin(p)
 }
 
 // SetLogicLevel sets the logic level for the Pin. This can be
@@ -137,18 +477,61 @@ func (p Pin) SetLogicLevel(logicLevel LogicLevel) error {
 	return setLogicLevel(p, logicLevel)
 }
 
+// Wakeup reports whether the pin is enabled as a system wakeup source
+func (p Pin) Wakeup() (bool, error) {
+	return readWakeup(p)
+}
+
+// SetWakeup enables or disables the pin as a system wakeup source.
+// The pin should be an input with an edge configured, and the interrupt
+// controller must support wakeup for this to have an effect.
+func (p Pin) SetWakeup(enabled bool) error {
+	if p.dir() != DirectionIn {
+		return errWrongDirection(p, DirectionIn)
+	}
+	return setWakeup(p, enabled)
+}
+
 // High sets the value of an output pin to logic high
 func (p Pin) High() error {
-	if p.direction != outDirection {
-		return errors.New("pin is not configured for output")
+	if p.dir() != DirectionOut {
+		return errWrongDirection(p, DirectionOut)
 	}
-	return writePin(p, 1)
+	return p.write(1, 1, func() error {
+		return writePin(p, 1)
+	})
 }
 
 // Low sets the value of an output pin to logic low
 func (p Pin) Low() error {
-	if p.direction != outDirection {
-		return errors.New("pin is not configured for output")
+	if p.dir() != DirectionOut {
+		return errWrongDirection(p, DirectionOut)
 	}
-	return writePin(p, 0)
+	return p.write(1, 0, func() error {
+		return writePin(p, 0)
+	})
+}
+
+// Toggle flips the value of an output pin. The current value is read back from the kernel,
+// or taken from the last write on pins returned by WithWriteDedup. A write made by another
+// goroutine between reading and writing is overwritten.
+func (p Pin) Toggle() error {
+	if p.dir() != DirectionOut {
+		return errWrongDirection(p, DirectionOut)
+	}
+	var v uint
+	var ok bool
+	if p.dedup != nil {
+		v, ok = p.dedup.lastValue()
+	}
+	if !ok {
+		var err error
+		if v, err = readPin(p); err != nil {
+			return err
+		}
+	}
+	v ^= 1
+	return p.write(1, v, func() error {
+		return writePin(p, v)
+	})
 }
@@ -0,0 +1,58 @@
+package gpio
+
+import (
+	"errors"
+	"testing"
+)
+
+// Changing the direction of a pin changes it for all of its copies
+func TestDirectionSharedByCopies(t *testing.T) {
+	m := NewMock()
+	SetMock(m)
+	defer SetMock(nil)
+	p, err := NewPin(5, WithDirection(DirectionOut))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	copied := p.WithWriteDedup()
+	if err := copied.SetInput(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.High(); err == nil {
+		t.Fatal("wrote an input through a copy made before SetInput")
+	}
+	m.SetInput(5, 1)
+	if v, err := p.Read(); err != nil || v != 1 {
+		t.Fatalf("read %d, %v, want 1", v, err)
+	}
+	if err := p.SetOutput(Inactive); err != nil {
+		t.Fatal(err)
+	}
+	if err := copied.High(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Level(5) != 1 {
+		t.Fatal("the copy didn't drive the output")
+	}
+	p.Close()
+	if err := copied.SetInput(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("SetInput on a closed copy returned %v", err)
+	}
+	if err := (Pin{Number: 5}).SetInput(); !errors.Is(err, ErrClosed) {
+		t.Fatalf("SetInput on a pin which isn't open returned %v", err)
+	}
+}
+
+func TestBackendOfMockPins(t *testing.T) {
+	SetMock(NewMock())
+	defer SetMock(nil)
+	p, err := NewPin(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if b := p.Backend(); b != BackendChardev {
+		t.Fatalf("mock pin reports backend %s", b)
+	}
+}
@@ -0,0 +1,174 @@
+package gpio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// journalSocket is where systemd-journald receives native protocol datagrams
+const journalSocket = "/run/systemd/journal/socket"
+
+// journal priorities, as in syslog
+const (
+	journalErr  = 3
+	journalInfo = 6
+)
+
+// JournalSink forwards pin events to the systemd journal with structured fields, so that
+// they can be filtered with journalctl, e.g. "journalctl PIN=22 EDGE=rising".
+// Edges of the watched pins are logged with PIN, VALUE, EDGE and TS, TS being the time
+// of the event in unix nanoseconds. Faults are logged through the hooks returned by
+// AuditHook and SetupHook, with ERROR set to the error.
+type JournalSink struct {
+	conn       *net.UnixConn
+	identifier string
+	watcher    *Watcher
+	last       map[uint]uint
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewJournalSink connects to the journal and logs the edges of pins, which may be none
+func NewJournalSink(pins ...uint) (*JournalSink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journalSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the journal: %s", err)
+	}
+	j := &JournalSink{
+		conn:       conn,
+		identifier: filepath.Base(os.Args[0]),
+		last:       make(map[uint]uint),
+		done:       make(chan struct{}),
+		stopped:    make(chan struct{}),
+	}
+	j.watcher = NewWatcher()
+	for _, p := range pins {
+		if err := j.watcher.AddPin(p); err != nil {
+			j.watcher.Close()
+			conn.Close()
+			return nil, fmt.Errorf("failed to watch journaled pin: %s", err)
+		}
+	}
+	spawn("JournalSink", pins, j.run)
+	return j, nil
+}
+
+func (j *JournalSink) run() {
+	defer close(j.stopped)
+	for {
+		select {
+		case n := <-j.watcher.Notification:
+			j.edge(n, time.Now())
+		case <-j.done:
+			return
+		}
+	}
+}
+
+func (j *JournalSink) edge(n WatcherNotification, now time.Time) {
+	prev, seen := j.last[n.Pin]
+	j.last[n.Pin] = n.Value
+	// the first notification only reports the initial value
+	if !seen || prev == n.Value {
+		return
+	}
+	edge := "falling"
+	if n.Value == 1 {
+		edge = "rising"
+	}
+	msg := fmt.Sprintf("gpio %d %s", n.Pin, edge)
+	simulated := "0"
+	if n.Simulated {
+		msg += " (simulated)"
+		simulated = "1"
+	}
+	j.send(journalInfo, msg,
+		"PIN", strconv.Itoa(int(n.Pin)),
+		"VALUE", strconv.Itoa(int(n.Value)),
+		"EDGE", edge,
+		"SIMULATED", simulated,
+		"TS", strconv.FormatInt(now.UnixNano(), 10),
+	)
+}
+
+// AuditHook returns a hook for SetAuditHook which logs failed writes
+func (j *JournalSink) AuditHook() AuditHook {
+	return func(r AuditRecord) {
+		if r.Err == "" {
+			return
+		}
+		j.send(journalErr, fmt.Sprintf("failed to write %d to gpio %d: %s", r.Value, r.Pin, r.Err),
+			"PIN", strconv.Itoa(int(r.Pin)),
+			"VALUE", strconv.Itoa(int(r.Value)),
+			"TS", strconv.FormatInt(r.Time.UnixNano(), 10),
+			"ERROR", r.Err,
+			"CALLER", r.Caller,
+		)
+	}
+}
+
+// SetupHook returns a hook for SetSetupHook which logs pins that failed to open
+func (j *JournalSink) SetupHook() SetupHook {
+	return func(s SetupStats) {
+		if s.Err == nil {
+			return
+		}
+		j.send(journalErr, fmt.Sprintf("%s failed for gpio %d: %s", s.Op, s.Pin, s.Err),
+			"PIN", strconv.Itoa(int(s.Pin)),
+			"TS", strconv.FormatInt(time.Now().UnixNano(), 10),
+			"ERROR", s.Err.Error(),
+			"RETRIES", strconv.Itoa(s.Retries),
+		)
+	}
+}
+
+// send writes one entry in the native journal protocol. fields alternate names and values
+func (j *JournalSink) send(priority int, message string, fields ...string) {
+	var b bytes.Buffer
+	writeJournalField(&b, "MESSAGE", message)
+	writeJournalField(&b, "PRIORITY", strconv.Itoa(priority))
+	writeJournalField(&b, "SYSLOG_IDENTIFIER", j.identifier)
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i+1] == "" {
+			continue
+		}
+		writeJournalField(&b, fields[i], fields[i+1])
+	}
+	if _, err := j.conn.Write(b.Bytes()); err != nil {
+		logger().Error("failed to write to the journal", "err", err)
+	}
+}
+
+// writeJournalField encodes a field as "NAME=value\n", or in the binary form with a length
+// prefix when the value contains a newline
+func writeJournalField(b *bytes.Buffer, name string, value string) {
+	if !strings.Contains(value, "\n") {
+		fmt.Fprintf(b, "%s=%s\n", name, value)
+		return
+	}
+	b.WriteString(name)
+	b.WriteByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value)
+	b.WriteByte('\n')
+}
+
+// Close stops watching the pins and disconnects from the journal.
+// Hooks returned by the sink must be uninstalled before.
+func (j *JournalSink) Close() error {
+	close(j.done)
+	<-j.stopped
+	err := j.watcher.Shutdown()
+	if cerr := j.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
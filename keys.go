@@ -0,0 +1,181 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// inputRoot is the directory of the input class
+var inputRoot = "/sys/class/input"
+
+// gpioKeysDrivers are the drivers binding buttons on gpio lines to input devices
+var gpioKeysDrivers = []string{"gpio-keys", "gpio-keys-polled"}
+
+// Key is a button bound to an input device by gpio-keys in the device tree, which holds its
+// line so that it can't be opened as a pin. It is read and watched like an input pin, from
+// the key events of the device. The kernel already debounces it.
+type Key struct {
+	// Code is the key code, e.g. KEY_POWER is 116, see linux/input-event-codes.h
+	Code uint16
+	// Device is the event device of the key, e.g. /dev/input/event0
+	Device string
+}
+
+var _ InputPin = Key{}
+
+// inputEvent is struct input_event of linux/input.h
+type inputEvent struct {
+	time  syscall.Timeval
+	typ   uint16
+	code  uint16
+	value int32
+}
+
+const (
+	evKey = 0x01
+	// keyRepeat is the value of the events repeating a held key
+	keyRepeat = 2
+)
+
+// FindKey returns the key with the given code on the first gpio-keys device which has it
+func FindKey(code uint16) (Key, error) {
+	events, _ := filepath.Glob(inputRoot + "/event*")
+	for _, event := range events {
+		driver, err := filepath.EvalSymlinks(event + "/device/device/driver")
+		if err != nil || !isGPIOKeysDriver(filepath.Base(driver)) {
+			continue
+		}
+		if hasKey(event, code) {
+			return Key{Code: code, Device: "/dev/input/" + filepath.Base(event)}, nil
+		}
+	}
+	return Key{}, fmt.Errorf("no gpio-keys device has key %d", code)
+}
+
+func isGPIOKeysDriver(name string) bool {
+	for _, d := range gpioKeysDrivers {
+		if name == d {
+			return true
+		}
+	}
+	return false
+}
+
+// hasKey reads the key capabilities of an input device, a bitmap in hexadecimal words with
+// the most significant first
+func hasKey(event string, code uint16) bool {
+	b, err := ioutil.ReadFile(event + "/device/capabilities/key")
+	if err != nil {
+		return false
+	}
+	words := strings.Fields(string(b))
+	bits := int(unsafe.Sizeof(uintptr(0))) * 8
+	i := len(words) - 1 - int(code)/bits
+	if i < 0 {
+		return false
+	}
+	w, err := strconv.ParseUint(words[i], 16, 64)
+	return err == nil && w&(1<<(uint(code)%uint(bits))) != 0
+}
+
+// Read returns 1 while the key is pressed
+func (k Key) Read() (uint, error) {
+	f, err := os.Open(k.Device)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open input device: %s", err)
+	}
+	defer f.Close()
+	return keyState(f, k.Code)
+}
+
+// Close does nothing, keys hold no resources until they are watched
+func (k Key) Close() {}
+
+// KeyWatch delivers the presses and releases of a key on Events, like a PinWatch. The Pin of
+// the events is the key code, and their Time is the timestamp of the kernel.
+// Events are dropped when nobody receives them.
+type KeyWatch struct {
+	Events chan EdgeEvent
+
+	key     Key
+	edge    Edge
+	f       *os.File
+	last    uint
+	stopped chan struct{}
+}
+
+// Watch delivers the changes of the key matching edge: EdgeRising for presses, EdgeFalling
+// for releases
+func (k Key) Watch(edge Edge) (*KeyWatch, error) {
+	if edge == EdgeNone {
+		return nil, errors.New("watching a key needs an edge")
+	}
+	f, err := os.Open(k.Device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open input device: %s", err)
+	}
+	v, err := keyState(f, k.Code)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w := &KeyWatch{
+		Events:  make(chan EdgeEvent, edgeEventLen),
+		key:     k,
+		edge:    edge,
+		f:       f,
+		last:    v,
+		stopped: make(chan struct{}),
+	}
+	spawn("KeyWatch", nil, w.run)
+	return w, nil
+}
+
+func (w *KeyWatch) run() {
+	defer close(w.stopped)
+	size := int(unsafe.Sizeof(inputEvent{}))
+	buf := make([]byte, size*16)
+	for {
+		n, err := w.f.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				logger().Error("key watch stopped", "key", w.key.Code, "err", err)
+			}
+			return
+		}
+		for off := 0; off+size <= n; off += size {
+			ev := (*inputEvent)(unsafe.Pointer(&buf[off]))
+			if ev.typ != evKey || ev.code != w.key.Code || ev.value == keyRepeat {
+				continue
+			}
+			v := uint(0)
+			if ev.value != 0 {
+				v = 1
+			}
+			prev := w.last
+			w.last = v
+			if !edgeMatches(w.edge, prev, v) {
+				continue
+			}
+			sec, nsec := ev.time.Unix()
+			select {
+			case w.Events <- EdgeEvent{Pin: uint(w.key.Code), Value: v, Time: time.Unix(sec, nsec)}:
+			default:
+			}
+		}
+	}
+}
+
+// Close stops delivering key events
+func (w *KeyWatch) Close() {
+	w.f.Close()
+	<-w.stopped
+}
@@ -0,0 +1,91 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// LatencyStats is the distribution of interrupt latencies measured by MeasureInterruptLatency.
+// Samples holds every measured latency in ascending order.
+// Missed counts toggles for which no event arrived within a second.
+type LatencyStats struct {
+	Samples []time.Duration
+	Missed  int
+	Min     time.Duration
+	Max     time.Duration
+	Mean    time.Duration
+	Median  time.Duration
+	P99     time.Duration
+}
+
+const latencyEventTimeout = time.Second
+
+// MeasureInterruptLatency toggles out n times and measures how long it takes for the
+// change to be delivered as an edge event on in. out must be wired to in.
+// This is useful to check whether the event path of this package meets the timing
+// needs of an application on a given board.
+func MeasureInterruptLatency(out Pin, in Pin, n int) (LatencyStats, error) {
+	if err := checkDirection(DirectionOut, out); err != nil {
+		return LatencyStats{}, err
+	}
+	if err := checkDirection(DirectionIn, in); err != nil {
+		return LatencyStats{}, err
+	}
+	if n < 1 {
+		return LatencyStats{}, fmt.Errorf("invalid number of latency samples %d", n)
+	}
+	if err := setEdgeTrigger(in, EdgeBoth); err != nil {
+		return LatencyStats{}, err
+	}
+	if err := writePin(out, 0); err != nil {
+		return LatencyStats{}, err
+	}
+	time.Sleep(10 * time.Millisecond)
+	// reading clears the pending event so that the first select waits for a real edge
+	if _, err := readPin(in); err != nil {
+		return LatencyStats{}, err
+	}
+
+	stats := LatencyStats{
+		Samples: make([]time.Duration, 0, n),
+	}
+	v := uint(0)
+	for i := 0; i < n; i++ {
+		v = 1 - v
+		start := time.Now()
+		if err := writePin(out, v); err != nil {
+			return LatencyStats{}, err
+		}
+		changed, err := waitForEdge(in, latencyEventTimeout)
+		elapsed := time.Since(start)
+		if err != nil {
+			return LatencyStats{}, err
+		}
+		if _, err := readPin(in); err != nil {
+			return LatencyStats{}, err
+		}
+		if !changed {
+			stats.Missed++
+			continue
+		}
+		stats.Samples = append(stats.Samples, elapsed)
+	}
+
+	if len(stats.Samples) == 0 {
+		return stats, errors.New("no edge events were received, check that the pins are wired together")
+	}
+	sort.Slice(stats.Samples, func(i, j int) bool { return stats.Samples[i] < stats.Samples[j] })
+	var total time.Duration
+	for _, d := range stats.Samples {
+		total += d
+	}
+	k := len(stats.Samples)
+	stats.Min = stats.Samples[0]
+	stats.Max = stats.Samples[k-1]
+	stats.Mean = total / time.Duration(k)
+	stats.Median = stats.Samples[k/2]
+	stats.P99 = stats.Samples[(k*99)/100]
+	return stats, nil
+}
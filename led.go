@@ -0,0 +1,183 @@
+package gpio
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ledRoot is the directory of the leds class
+var ledRoot = "/sys/class/leds"
+
+// LED is a LED of the leds class in /sys/class/leds, such as the activity LEDs of many boards,
+// which the kernel holds so that their lines can't be opened as pins. It implements
+// OutputPin and InputPin, and its brightness is set like the duty of a HardwarePWM.
+// Writing 0 also stops the LED's trigger, and while a trigger runs it may override other writes.
+type LED struct {
+	Name          string
+	maxBrightness uint
+}
+
+var (
+	_ OutputPin = LED{}
+	_ InputPin  = LED{}
+)
+
+// LEDs returns the names of the LEDs of the leds class
+func LEDs() ([]string, error) {
+	entries, err := ioutil.ReadDir(ledRoot)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list leds: %s", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (l LED) path(attr string) string {
+	return fmt.Sprintf("%s/%s/%s", ledRoot, l.Name, attr)
+}
+
+func (l LED) write(attr string, value string) error {
+	f, err := os.OpenFile(l.path(attr), os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open led %s %s file for writing: %s", l.Name, attr, err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte(value)); err != nil {
+		return fmt.Errorf("failed to write led %s %s file: %s", l.Name, attr, err)
+	}
+	return nil
+}
+
+func (l LED) read(attr string) (string, error) {
+	b, err := ioutil.ReadFile(l.path(attr))
+	if err != nil {
+		return "", fmt.Errorf("failed to read led %s %s file: %s", l.Name, attr, err)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (l LED) readUint(attr string) (uint, error) {
+	s, err := l.read(attr)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("read invalid %s %q for led %s", attr, s, l.Name)
+	}
+	return uint(n), nil
+}
+
+// NewLED opens the LED with the given name, e.g. "led0" or "ACT", leaving its state and trigger
+func NewLED(name string) (LED, error) {
+	if name == "" || strings.Contains(name, "/") {
+		return LED{}, fmt.Errorf("invalid led name %q", name)
+	}
+	l := LED{Name: name}
+	max, err := l.readUint("max_brightness")
+	if err != nil {
+		return LED{}, err
+	}
+	l.maxBrightness = max
+	return l, nil
+}
+
+// MaxBrightness returns the brightness the LED is fully on at, 1 for LEDs on gpio lines
+func (l LED) MaxBrightness() uint {
+	return l.maxBrightness
+}
+
+// Brightness returns the current brightness of the LED
+func (l LED) Brightness() (uint, error) {
+	return l.readUint("brightness")
+}
+
+// SetBrightness sets the brightness between 0 and MaxBrightness
+func (l LED) SetBrightness(b uint) error {
+	if b > l.maxBrightness {
+		return fmt.Errorf("invalid brightness %d for led %s, the maximum is %d", b, l.Name, l.maxBrightness)
+	}
+	return l.write("brightness", strconv.FormatUint(uint64(b), 10))
+}
+
+// SetDutyCycle sets the brightness as a fraction of MaxBrightness between 0 and 1
+func (l LED) SetDutyCycle(fraction float64) error {
+	if fraction < 0 || fraction > 1 {
+		return fmt.Errorf("invalid led duty cycle %f", fraction)
+	}
+	return l.SetBrightness(uint(float64(l.maxBrightness)*fraction + 0.5))
+}
+
+// High turns the LED fully on
+func (l LED) High() error {
+	return l.SetBrightness(l.maxBrightness)
+}
+
+// Low turns the LED off, which also stops its trigger
+func (l LED) Low() error {
+	return l.SetBrightness(0)
+}
+
+// Read returns 1 when the LED is on at any brightness
+func (l LED) Read() (uint, error) {
+	b, err := l.Brightness()
+	if err != nil {
+		return 0, err
+	}
+	if b > 0 {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Triggers returns the triggers the LED can be driven by, e.g. "heartbeat" or "mmc0"
+func (l LED) Triggers() ([]string, error) {
+	s, err := l.read("trigger")
+	if err != nil {
+		return nil, err
+	}
+	var triggers []string
+	for _, t := range strings.Fields(s) {
+		triggers = append(triggers, strings.Trim(t, "[]"))
+	}
+	return triggers, nil
+}
+
+// Trigger returns the trigger driving the LED, "none" when it is only driven by writes
+func (l LED) Trigger() (string, error) {
+	s, err := l.read("trigger")
+	if err != nil {
+		return "", err
+	}
+	for _, t := range strings.Fields(s) {
+		if strings.HasPrefix(t, "[") && strings.HasSuffix(t, "]") {
+			return strings.Trim(t, "[]"), nil
+		}
+	}
+	return "none", nil
+}
+
+// SetTrigger selects the trigger driving the LED, "none" to drive it only by writes
+func (l LED) SetTrigger(trigger string) error {
+	triggers, err := l.Triggers()
+	if err != nil {
+		return err
+	}
+	for _, t := range triggers {
+		if t == trigger {
+			return l.write("trigger", trigger)
+		}
+	}
+	return fmt.Errorf("led %s has no trigger %q", l.Name, trigger)
+}
+
+// Close does nothing, the LED keeps its brightness and trigger
+func (l LED) Close() {}
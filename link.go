@@ -0,0 +1,281 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// A link carries byte frames between two boards over a clock and a data line.
+// The sender drives both lines and the receiver samples data on rising clock edges,
+// most significant bit first. A frame is a sequence number, a length, the payload and
+// a CRC-16/CCITT of all three. After a frame the sender releases data and clocks one more
+// bit, which the receiver drives high to acknowledge a valid frame.
+// Receiving relies on edge events, so the bit period must be well above the edge latency
+// of the boards, see MeasureInterruptLatency; a few milliseconds are safe with sysfs.
+// Both ends briefly drive data around the acknowledge bit, so the line should have a
+// series resistor, and a pull-down so that a missing receiver doesn't acknowledge.
+
+// ErrNoAck is returned when a frame wasn't acknowledged by the receiver
+var ErrNoAck = errors.New("link frame was not acknowledged")
+
+// MaxLinkPayload is the largest payload of a link frame
+const MaxLinkPayload = 255
+
+const (
+	// linkAckDelay is how many bit periods the sender waits before clocking the acknowledge bit
+	linkAckDelay = 4
+	// linkGap is how many idle bit periods make the receiver drop a partial frame
+	linkGap     = 8
+	linkRetries = 3
+)
+
+// crc16 is CRC-16/CCITT-FALSE
+func crc16(data []byte) uint16 {
+	crc := uint16(0xffff)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// LinkSender sends frames over a link
+type LinkSender struct {
+	clock  Pin
+	data   Pin
+	period time.Duration
+	seq    byte
+}
+
+// NewLinkSender creates the sending end of a link on two output pins
+func NewLinkSender(clock Pin, data Pin, bitPeriod time.Duration) (*LinkSender, error) {
+	if err := checkDirection(DirectionOut, clock, data); err != nil {
+		return nil, err
+	}
+	if bitPeriod <= 0 {
+		return nil, fmt.Errorf("invalid link bit period %s", bitPeriod)
+	}
+	if err := writePin(clock, 0); err != nil {
+		return nil, err
+	}
+	return &LinkSender{clock: clock, data: data, period: bitPeriod}, nil
+}
+
+// Send sends payload as one frame and waits for it to be acknowledged.
+// A frame which isn't acknowledged is sent again a few times before ErrNoAck is returned.
+func (s *LinkSender) Send(payload []byte) error {
+	if len(payload) > MaxLinkPayload {
+		return fmt.Errorf("link payload of %d bytes is too long", len(payload))
+	}
+	s.seq++
+	frame := make([]byte, 0, len(payload)+4)
+	frame = append(frame, s.seq, byte(len(payload)))
+	frame = append(frame, payload...)
+	crc := crc16(frame)
+	frame = append(frame, byte(crc>>8), byte(crc))
+
+	var err error
+	for i := 0; i < linkRetries; i++ {
+		if err = s.sendFrame(frame); err != ErrNoAck {
+			return err
+		}
+		// let the receiver notice the gap and drop what it got
+		time.Sleep(linkGap * 2 * s.period)
+	}
+	return err
+}
+
+func (s *LinkSender) clockBit(v uint) error {
+	half := s.period / 2
+	if err := writePin(s.data, v); err != nil {
+		return err
+	}
+	time.Sleep(half)
+	if err := writePin(s.clock, 1); err != nil {
+		return err
+	}
+	time.Sleep(half)
+	return writePin(s.clock, 0)
+}
+
+func (s *LinkSender) sendFrame(frame []byte) error {
+	for _, b := range frame {
+		for i := 7; i >= 0; i-- {
+			if err := s.clockBit(uint(b>>uint(i)) & 1); err != nil {
+				return err
+			}
+		}
+	}
+
+	// turn the data line around for the acknowledge bit
+	if err := setDirection(s.data, DirectionIn, 0); err != nil {
+		return err
+	}
+	time.Sleep(linkAckDelay * s.period)
+	if err := writePin(s.clock, 1); err != nil {
+		return err
+	}
+	time.Sleep(s.period / 2)
+	ack, err := readPin(s.data)
+	if cerr := writePin(s.clock, 0); err == nil {
+		err = cerr
+	}
+	// wait for the receiver to release data before driving it again
+	time.Sleep(linkAckDelay * s.period)
+	if derr := setDirection(s.data, DirectionOut, 0); err == nil {
+		err = derr
+	}
+	if err != nil {
+		return err
+	}
+	if ack != 1 {
+		return ErrNoAck
+	}
+	return nil
+}
+
+// LinkReceiver receives frames from a link and delivers their payloads on Frames.
+// Repeated frames, sent again because an acknowledge was lost, are only delivered once.
+type LinkReceiver struct {
+	Frames chan []byte
+
+	clock  Pin
+	data   Pin
+	period time.Duration
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+const linkFramesLen = 16
+
+// NewLinkReceiver creates the receiving end of a link on two input pins.
+// The clock pin's edge setting is changed to rising.
+func NewLinkReceiver(clock Pin, data Pin, bitPeriod time.Duration) (*LinkReceiver, error) {
+	if err := checkDirection(DirectionIn, clock, data); err != nil {
+		return nil, err
+	}
+	if bitPeriod <= 0 {
+		return nil, fmt.Errorf("invalid link bit period %s", bitPeriod)
+	}
+	if err := setEdgeTrigger(clock, EdgeRising); err != nil {
+		return nil, err
+	}
+	if _, err := readPin(clock); err != nil {
+		return nil, err
+	}
+	r := &LinkReceiver{
+		Frames:  make(chan []byte, linkFramesLen),
+		clock:   clock,
+		data:    data,
+		period:  bitPeriod,
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	spawn("LinkReceiver", []uint{clock.Number, data.Number}, r.run)
+	return r, nil
+}
+
+// nextBit waits for a rising clock edge and reads data.
+// ok is false when the line stayed idle for timeout.
+func (r *LinkReceiver) nextBit(timeout time.Duration) (bit uint, ok bool, err error) {
+	changed, err := waitForEdge(r.clock, timeout)
+	if err != nil || !changed {
+		return 0, false, err
+	}
+	bit, err = readPin(r.data)
+	if err != nil {
+		return 0, false, err
+	}
+	// clear the edge
+	if _, err := readPin(r.clock); err != nil {
+		return 0, false, err
+	}
+	return bit, true, nil
+}
+
+func (r *LinkReceiver) run() {
+	defer close(r.stopped)
+	var frame []byte
+	var cur byte
+	bits := 0
+	lastSeq, haveSeq := byte(0), false
+	for {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+		timeout := time.Second
+		if bits != 0 {
+			timeout = linkGap * r.period
+		}
+		bit, ok, err := r.nextBit(timeout)
+		if err != nil {
+			logger().Error("link receiver stopped", "err", err)
+			return
+		}
+		if !ok {
+			// drop a partial frame after a gap
+			frame, cur, bits = frame[:0], 0, 0
+			continue
+		}
+		cur = cur<<1 | byte(bit)
+		bits++
+		if bits%8 != 0 {
+			continue
+		}
+		frame = append(frame, cur)
+		cur = 0
+		if len(frame) < 2 || len(frame) < int(frame[1])+4 {
+			continue
+		}
+
+		valid := crc16(frame[:len(frame)-2]) == uint16(frame[len(frame)-2])<<8|uint16(frame[len(frame)-1])
+		if err := r.acknowledge(valid); err != nil {
+			logger().Error("link receiver stopped", "err", err)
+			return
+		}
+		if valid && (!haveSeq || frame[0] != lastSeq) {
+			lastSeq, haveSeq = frame[0], true
+			payload := append([]byte(nil), frame[2:len(frame)-2]...)
+			select {
+			case r.Frames <- payload:
+			default:
+			}
+		}
+		frame, bits = frame[:0], 0
+	}
+}
+
+// acknowledge drives the acknowledge bit while the sender clocks it
+func (r *LinkReceiver) acknowledge(valid bool) error {
+	// the sender releases data half a period after the last bit
+	time.Sleep(r.period)
+	ack := uint(0)
+	if valid {
+		ack = 1
+	}
+	if err := setDirection(r.data, DirectionOut, ack); err != nil {
+		return err
+	}
+	_, _, err := r.nextBit(2 * linkAckDelay * r.period)
+	time.Sleep(r.period / 2)
+	if derr := setDirection(r.data, DirectionIn, 0); err == nil {
+		err = derr
+	}
+	return err
+}
+
+// Close stops receiving. The pins are left open
+func (r *LinkReceiver) Close() {
+	close(r.stop)
+	<-r.stopped
+}
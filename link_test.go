@@ -0,0 +1,19 @@
+package gpio
+
+import "testing"
+
+func TestCRC16(t *testing.T) {
+	for _, c := range []struct {
+		data string
+		want uint16
+	}{
+		{"", 0xffff},
+		// the check value of CRC-16/CCITT-FALSE
+		{"123456789", 0x29b1},
+		{"A", 0xb915},
+	} {
+		if got := crc16([]byte(c.data)); got != c.want {
+			t.Errorf("crc16(%q) = %#04x, want %#04x", c.data, got, c.want)
+		}
+	}
+}
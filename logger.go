@@ -0,0 +1,76 @@
+package gpio
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Logger receives what the package logs: debug messages for pins being exported, warnings
+// for retries and errors of background goroutines. args alternate keys and values.
+// A *slog.Logger satisfies Logger, so the package can log through the application's handler.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+var (
+	loggerMu  sync.RWMutex
+	pkgLogger Logger = stdoutLogger{}
+)
+
+// SetLogger makes the package log through l. By default everything but debug messages is
+// printed to stdout. Passing nil disables logging.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = discardLogger{}
+	}
+	loggerMu.Lock()
+	pkgLogger = l
+	loggerMu.Unlock()
+}
+
+func logger() Logger {
+	loggerMu.RLock()
+	defer loggerMu.RUnlock()
+	return pkgLogger
+}
+
+// stdoutLogger prints messages with their arguments as key=value pairs
+type stdoutLogger struct{}
+
+func (stdoutLogger) Debug(msg string, args ...interface{}) {}
+
+func (l stdoutLogger) Info(msg string, args ...interface{}) {
+	l.print(msg, args)
+}
+
+func (l stdoutLogger) Warn(msg string, args ...interface{}) {
+	l.print(msg, args)
+}
+
+func (l stdoutLogger) Error(msg string, args ...interface{}) {
+	l.print(msg, args)
+}
+
+func (stdoutLogger) print(msg string, args []interface{}) {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			fmt.Fprintf(&b, " %v", args[i])
+			break
+		}
+		fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+	}
+	fmt.Println(b.String())
+}
+
+type discardLogger struct{}
+
+func (discardLogger) Debug(msg string, args ...interface{}) {}
+func (discardLogger) Info(msg string, args ...interface{})  {}
+func (discardLogger) Warn(msg string, args ...interface{})  {}
+func (discardLogger) Error(msg string, args ...interface{}) {}
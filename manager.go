@@ -0,0 +1,189 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// Manager holds a set of pins addressed by logical names, so that application code
+// can refer to "bumper_left" rather than to a kernel pin number.
+// Pins may be opened by the Manager itself or opened elsewhere and registered with Add.
+type Manager struct {
+	mu   sync.Mutex
+	pins map[string]Pin
+	// started are the requests of the pins opened by Start and Apply
+	started map[string]PinRequest
+	// gate is shared with the outputs, for safe mode and dry runs
+	gate *outputGate
+}
+
+// ErrNotArmed is returned by writes to outputs of a safe mode Manager before it is armed
+var ErrNotArmed = errors.New("gpio manager is not armed")
+
+// outputGate decides what happens to the writes of the outputs sharing it
+type outputGate struct {
+	armed  int32
+	dryRun int32
+}
+
+func (g *outputGate) isArmed() bool {
+	return atomic.LoadInt32(&g.armed) != 0
+}
+
+func (g *outputGate) isDryRun() bool {
+	return atomic.LoadInt32(&g.dryRun) != 0
+}
+
+// NewManager creates an empty Manager
+func NewManager() *Manager {
+	return &Manager{
+		pins:    make(map[string]Pin),
+		started: make(map[string]PinRequest),
+		gate:    &outputGate{armed: 1},
+	}
+}
+
+// NewSafeManager creates an empty Manager in safe mode: its outputs are opened with their
+// initial values, but any write to them fails with ErrNotArmed until Arm is called, e.g.
+// once the application's self checks passed. This keeps a half initialized service from
+// actuating hardware. Writes made through helpers driving the pins, such as a SoftPWM, are rejected too.
+func NewSafeManager() *Manager {
+	m := NewManager()
+	m.gate.armed = 0
+	return m
+}
+
+// Arm lets the writes to the outputs of a safe mode Manager through
+func (m *Manager) Arm() {
+	atomic.StoreInt32(&m.gate.armed, 1)
+}
+
+// Disarm rejects the writes to the outputs with ErrNotArmed, as in safe mode.
+// The outputs keep their current values.
+func (m *Manager) Disarm() {
+	atomic.StoreInt32(&m.gate.armed, 0)
+}
+
+// Armed reports whether writes to the outputs are let through
+func (m *Manager) Armed() bool {
+	return m.gate.isArmed()
+}
+
+// SetDryRun makes the writes to the outputs succeed without being applied while enabled,
+// see SetDryRun for all pins
+func (m *Manager) SetDryRun(enabled bool) {
+	v := int32(0)
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&m.gate.dryRun, v)
+}
+
+// Add registers an already opened pin under the given name.
+// Only the copy of an output returned by Pin is held back in safe mode and dry runs.
+func (m *Manager) Add(name string, p Pin) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.pins[name]; ok {
+		return fmt.Errorf("pin name %q is already in use", name)
+	}
+	if p.dir() == DirectionOut {
+		p.gate = m.gate
+	}
+	m.pins[name] = p
+	return nil
+}
+
+// AddInput opens the given pin number for reading and registers it under name
+func (m *Manager) AddInput(name string, p uint) (Pin, error) {
+	pin, err := NewInput(p)
+	if err != nil {
+		return Pin{}, err
+	}
+	if err := m.Add(name, pin); err != nil {
+		pin.Close()
+		return Pin{}, err
+	}
+	return pin, nil
+}
+
+// AddOutput opens the given pin number for writing and registers it under name
+func (m *Manager) AddOutput(name string, p uint, initHigh bool) (Pin, error) {
+	pin, err := NewPin(p, WithDirection(DirectionOut), withInitial(initHigh))
+	if err != nil {
+		return Pin{}, err
+	}
+	pin.gate = m.gate
+	if err := m.Add(name, pin); err != nil {
+		pin.Close()
+		return Pin{}, err
+	}
+	return pin, nil
+}
+
+// Pin returns the pin registered under name
+func (m *Manager) Pin(name string) (Pin, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.pins[name]
+	return p, ok
+}
+
+// Names returns the names of all registered pins in sorted order
+func (m *Manager) Names() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	names := make([]string, 0, len(m.pins))
+	for name := range m.pins {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Remove closes the pin registered under name and forgets it
+func (m *Manager) Remove(name string) {
+	if p, ok := m.forget(name); ok {
+		p.Close()
+	}
+}
+
+// forget unregisters the pin registered under name and returns it
+func (m *Manager) forget(name string) (Pin, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	p, ok := m.pins[name]
+	delete(m.pins, name)
+	delete(m.started, name)
+	return p, ok
+}
+
+// Close closes all registered pins. This doesn't unexport them
+func (m *Manager) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, p := range m.pins {
+		p.Close()
+		delete(m.pins, name)
+		delete(m.started, name)
+	}
+}
+
+// CleanupAll cleans up all registered pins and forgets them.
+// Only pins exported by this process are unexported unless force is true.
+func (m *Manager) CleanupAll(force bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name, p := range m.pins {
+		if force {
+			p.ForceCleanup()
+		} else {
+			p.Cleanup()
+		}
+		delete(m.pins, name)
+		delete(m.started, name)
+	}
+}
@@ -0,0 +1,327 @@
+package gpio
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// Mock is an in-memory gpio chip which replaces the kernel while it is installed with
+// SetMock, so that code using this package can be tested off the device.
+// Inputs are driven with SetInput, which raises edge events like the kernel does, so
+// Watchers and everything built on them work unchanged. Values written to outputs are
+// recorded and can be inspected with Writes and Level.
+type Mock struct {
+	mu    sync.Mutex
+	lines map[uint]*mockState
+	start time.Time
+}
+
+// mockState is the state of a mock line, shared by every pin opened on it
+type mockState struct {
+	// name is the line name found by FindLine
+	name string
+	// level is the physical level of the line
+	level    uint
+	writes   []uint
+	requests []*mockRequest
+	// dropped counts the events lost to full pipes
+	dropped uint64
+}
+
+// mockRequest is an opened pin. Edge events are written to a pipe whose read end is the
+// pin's file, so that it becomes readable like a character device line request. The pipe
+// is written without blocking, and the events which don't fit are dropped like the kernel
+// drops them when the queue of a request is full.
+type mockRequest struct {
+	line    *mockLine
+	w       *os.File
+	pending int
+}
+
+type mockLine struct {
+	lineConfig
+	mock *Mock
+	n    uint
+	req  *mockRequest
+}
+
+// NewMock returns a mock chip on which every pin number exists and all lines are low
+func NewMock() *Mock {
+	return &Mock{
+		lines: make(map[uint]*mockState),
+		start: time.Now(),
+	}
+}
+
+// SetMock installs m in place of the kernel for the pins opened afterwards, whatever the
+// selected backend. SetMock(nil) removes it again.
+func SetMock(m *Mock) {
+	backendMu.Lock()
+	defer backendMu.Unlock()
+	mock = m
+}
+
+// state returns the state of line n. m.mu must be held
+func (m *Mock) state(n uint) *mockState {
+	st, ok := m.lines[n]
+	if !ok {
+		st = &mockState{}
+		m.lines[n] = st
+	}
+	return st
+}
+
+// NameLine gives line n a name, like a device tree does, for FindLine
+func (m *Mock) NameLine(n uint, name string) {
+	m.mu.Lock()
+	m.state(n).name = name
+	m.mu.Unlock()
+}
+
+// findLine returns the lowest numbered line with the given name
+func (m *Mock) findLine(name string) (uint, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	found, ok := uint(0), false
+	for n, st := range m.lines {
+		if st.name == name && (!ok || n < found) {
+			found, ok = n, true
+		}
+	}
+	return found, ok
+}
+
+func (m *Mock) line(n uint) *mockLine {
+	l := &mockLine{mock: m, n: n}
+	l.flags = lineFlagInput
+	return l
+}
+
+// SetInput drives line n to the physical level v (0 or 1) from the outside.
+// Pins opened on the line see the new value, and those with a matching edge setting get an edge.
+// Outputs opened on a line drive it the same way, so an output and an input opened on the
+// same number behave like two pins wired together.
+func (m *Mock) SetInput(n uint, v uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.setLevel(m.state(n), v)
+}
+
+// setLevel changes the level of a line and raises the edges it causes. m.mu must be held
+func (m *Mock) setLevel(st *mockState, v uint) {
+	prev := st.level
+	st.level = v & 1
+	if prev == st.level {
+		return
+	}
+	for _, req := range st.requests {
+		flags := req.line.currentFlags()
+		if flags&lineFlagInput == 0 {
+			continue
+		}
+		cur := st.level
+		if flags&lineFlagActiveLow != 0 {
+			cur ^= 1
+		}
+		switch {
+		case cur == 1 && flags&lineFlagEdgeRising != 0:
+			m.raise(st, req, lineEventRising)
+		case cur == 0 && flags&lineFlagEdgeFalling != 0:
+			m.raise(st, req, lineEventFalling)
+		}
+	}
+}
+
+// InjectEdge raises an edge event on every pin opened on line n with an edge setting,
+// without changing the level, like a glitch too short to be read back
+func (m *Mock) InjectEdge(n uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := m.state(n)
+	for _, req := range st.requests {
+		flags := req.line.currentFlags()
+		if flags&lineFlagInput != 0 && flags&(lineFlagEdgeRising|lineFlagEdgeFalling) != 0 {
+			m.raise(st, req, lineEventRising)
+		}
+	}
+}
+
+// raise queues an edge event on req. m.mu must be held
+func (m *Mock) raise(st *mockState, req *mockRequest, id uint32) {
+	// like the kernel, the mock stamps events on a clock of its own unless it is the real time
+	stamp := uint64(time.Since(m.start))
+	if req.line.currentFlags()&lineFlagEventClockRealtime != 0 {
+		stamp = uint64(time.Now().UnixNano())
+	}
+	ev := lineEvent{
+		timestampNs: stamp,
+		id:          id,
+		offset:      uint32(req.line.n),
+	}
+	b := (*[unsafe.Sizeof(lineEvent{})]byte)(unsafe.Pointer(&ev))[:]
+	conn, err := req.w.SyscallConn()
+	if err == nil {
+		// the event is smaller than PIPE_BUF, so it is written whole or not at all
+		cerr := conn.Write(func(fd uintptr) bool {
+			_, err = syscall.Write(int(fd), b)
+			return true
+		})
+		if cerr != nil {
+			err = cerr
+		}
+	}
+	switch {
+	case err == syscall.EAGAIN:
+		st.dropped++
+	case err != nil:
+		// the pin was closed
+		m.release(st, req)
+	default:
+		req.pending++
+	}
+}
+
+// release forgets a closed request. m.mu must be held
+func (m *Mock) release(st *mockState, req *mockRequest) {
+	req.w.Close()
+	for i, r := range st.requests {
+		if r == req {
+			st.requests = append(st.requests[:i], st.requests[i+1:]...)
+			break
+		}
+	}
+}
+
+// Level returns the physical level of line n
+func (m *Mock) Level(n uint) uint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state(n).level
+}
+
+// Writes returns the values written to line n through its pins, in order.
+// The initial value set when opening an output is not a write.
+func (m *Mock) Writes(n uint) []uint {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]uint(nil), m.state(n).writes...)
+}
+
+// Dropped returns the number of edge events lost on line n because a pin opened on it had
+// too many unread events
+func (m *Mock) Dropped(n uint) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state(n).dropped
+}
+
+// ResetWrites forgets the values written to all lines so far
+func (m *Mock) ResetWrites() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, st := range m.lines {
+		st.writes = nil
+	}
+}
+
+func (l *mockLine) currentFlags() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.flags
+}
+
+// drive sets the level of an output from its configuration. l.mock.mu must be held
+func (l *mockLine) drive() {
+	l.mu.Lock()
+	flags, level := l.flags, l.value
+	l.mu.Unlock()
+	if flags&lineFlagOutput == 0 {
+		return
+	}
+	if flags&lineFlagActiveLow != 0 {
+		level ^= 1
+	}
+	l.mock.setLevel(l.mock.state(l.n), level)
+}
+
+func (l *mockLine) request() (*os.File, error) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to request mock line %d: %s", l.n, err)
+	}
+	l.mock.mu.Lock()
+	defer l.mock.mu.Unlock()
+	st := l.mock.state(l.n)
+	l.req = &mockRequest{line: l, w: w}
+	st.requests = append(st.requests, l.req)
+	l.drive()
+	return r, nil
+}
+
+func (l *mockLine) reconfigure(f *os.File) error {
+	l.mock.mu.Lock()
+	defer l.mock.mu.Unlock()
+	l.drive()
+	return nil
+}
+
+func (l *mockLine) getValue(f *os.File) (uint, error) {
+	l.mock.mu.Lock()
+	defer l.mock.mu.Unlock()
+	v := l.mock.state(l.n).level
+	if l.currentFlags()&lineFlagActiveLow != 0 {
+		v ^= 1
+	}
+	return v, nil
+}
+
+func (l *mockLine) setValue(f *os.File, v uint) error {
+	l.mock.mu.Lock()
+	defer l.mock.mu.Unlock()
+	l.mu.Lock()
+	l.value = v
+	l.mu.Unlock()
+	l.drive()
+	st := l.mock.state(l.n)
+	st.writes = append(st.writes, v)
+	return nil
+}
+
+func (l *mockLine) info() (uint64, error) {
+	return l.currentFlags(), nil
+}
+
+func (l *mockLine) drain(f *os.File) error {
+	_, err := l.events(f)
+	return err
+}
+
+func (l *mockLine) events(f *os.File) ([]lineEdge, error) {
+	l.mock.mu.Lock()
+	defer l.mock.mu.Unlock()
+	if l.req == nil || l.req.pending == 0 {
+		return nil, nil
+	}
+	buf := make([]byte, l.req.pending*lineEventSize)
+	l.req.pending = 0
+	if _, err := io.ReadFull(f, buf); err != nil {
+		return nil, fmt.Errorf("failed to read edge events: %s", err)
+	}
+	flags := l.currentFlags()
+	stamps := make([]lineEdge, 0, len(buf)/lineEventSize)
+	for i := 0; i < len(buf); i += lineEventSize {
+		ev := (*lineEvent)(unsafe.Pointer(&buf[i]))
+		stamp := time.Duration(ev.timestampNs)
+		stamps = append(stamps, lineEdge{
+			stamp:  stamp,
+			at:     lineStampTime(flags, stamp, l.mock.start, 0),
+			rising: ev.id == lineEventRising,
+		})
+	}
+	return stamps, nil
+}
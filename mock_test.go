@@ -0,0 +1,86 @@
+package gpio
+
+import (
+	"testing"
+	"time"
+)
+
+// Unread events fill the pipe of a pin, after which they are dropped instead of blocking
+// the Mock
+func TestMockDropsUnreadEvents(t *testing.T) {
+	m := NewMock()
+	SetMock(m)
+	defer SetMock(nil)
+	p, err := NewPin(3, WithEdge(EdgeBoth))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 5000; i++ {
+			m.SetInput(3, uint(i&1^1))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SetInput blocked on unread events")
+	}
+	if m.Dropped(3) == 0 {
+		t.Fatal("no event was dropped")
+	}
+	if m.Level(3) != 0 {
+		t.Fatal("the level wasn't followed")
+	}
+}
+
+// An output and an input opened on the same number behave like two pins wired together,
+// and only the writes after opening are recorded
+func TestMockWiresOutputsToInputs(t *testing.T) {
+	m := NewMock()
+	SetMock(m)
+	defer SetMock(nil)
+	out, err := NewPin(4, WithDirection(DirectionOut))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	in, err := NewPin(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	if err := out.High(); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := in.Read(); err != nil || v != 1 {
+		t.Fatalf("read %d, %v, want 1", v, err)
+	}
+	if err := out.Low(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Level(4) != 0 {
+		t.Fatal("the output didn't drive the line low")
+	}
+	if got := m.Writes(4); len(got) != 2 || got[0] != 1 || got[1] != 0 {
+		t.Fatalf("writes = %v, want [1 0]", got)
+	}
+	m.ResetWrites()
+	if got := m.Writes(4); len(got) != 0 {
+		t.Fatalf("writes = %v after ResetWrites", got)
+	}
+}
+
+func TestMockFindLine(t *testing.T) {
+	m := NewMock()
+	m.NameLine(9, "LED")
+	m.NameLine(7, "LED")
+	if n, ok := m.findLine("LED"); !ok || n != 7 {
+		t.Fatalf("found line %d, %t, want 7", n, ok)
+	}
+	if _, ok := m.findLine("BUTTON"); ok {
+		t.Fatal("found a line which has no name")
+	}
+}
@@ -0,0 +1,120 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Mux drives the select lines of an analog or digital multiplexer such as the 74HC4051
+// (3 select lines) or the 74HC4067 (4 select lines). selects[0] is the least significant line.
+type Mux struct {
+	selects []Pin
+	settle  time.Duration
+
+	mu       sync.Mutex
+	selected int
+}
+
+// NewMux creates a Mux on the given output pins. settle is how long Select waits after
+// switching channels, for the multiplexer and whatever is behind it to settle.
+func NewMux(settle time.Duration, selects ...Pin) (*Mux, error) {
+	if len(selects) == 0 {
+		return nil, errors.New("mux needs at least one select pin")
+	}
+	if len(selects) > 8 {
+		return nil, fmt.Errorf("too many mux select pins: %d", len(selects))
+	}
+	if err := checkDirection(DirectionOut, selects...); err != nil {
+		return nil, err
+	}
+	return &Mux{
+		selects:  selects,
+		settle:   settle,
+		selected: -1,
+	}, nil
+}
+
+// Channels returns the number of channels the select lines can address
+func (m *Mux) Channels() int {
+	return 1 << uint(len(m.selects))
+}
+
+// Select switches the multiplexer to channel ch and waits for it to settle.
+// Only the select lines which change are written, and nothing is done if ch is already selected.
+// Use Do to keep the channel selected while using it.
+func (m *Mux) Select(ch int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.selectLocked(ch)
+}
+
+func (m *Mux) selectLocked(ch int) error {
+	if ch < 0 || ch >= m.Channels() {
+		return fmt.Errorf("invalid mux channel %d", ch)
+	}
+	if ch == m.selected {
+		return nil
+	}
+	for i, p := range m.selects {
+		bit := uint(ch>>uint(i)) & 1
+		if m.selected >= 0 && uint(m.selected>>uint(i))&1 == bit {
+			continue
+		}
+		if err := writePin(p, bit); err != nil {
+			// the select lines are in an unknown state now
+			m.selected = -1
+			return err
+		}
+	}
+	m.selected = ch
+	time.Sleep(m.settle)
+	return nil
+}
+
+// Do selects channel ch and calls fn while no other channel can be selected,
+// e.g. to take an ADC reading of an analog multiplexer
+func (m *Mux) Do(ch int, fn func() error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.selectLocked(ch); err != nil {
+		return err
+	}
+	return fn()
+}
+
+// MuxInput is one channel of a digital multiplexer, read through the multiplexer's common pin
+type MuxInput struct {
+	mux     *Mux
+	common  Pin
+	channel int
+}
+
+// Input returns channel ch of the multiplexer as a virtual input read on the common input pin
+func (m *Mux) Input(common Pin, ch int) (*MuxInput, error) {
+	if common.dir() != DirectionIn {
+		return nil, errWrongDirection(common, DirectionIn)
+	}
+	if ch < 0 || ch >= m.Channels() {
+		return nil, fmt.Errorf("invalid mux channel %d", ch)
+	}
+	return &MuxInput{mux: m, common: common, channel: ch}, nil
+}
+
+// Channel returns the multiplexer channel of the input
+func (in *MuxInput) Channel() int {
+	return in.channel
+}
+
+// Read selects the channel and returns the value read on the common pin
+func (in *MuxInput) Read() (value uint, err error) {
+	err = in.mux.Do(in.channel, func() error {
+		value, err = readPin(in.common)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
@@ -0,0 +1,247 @@
+package gpio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// pinConfig is the configuration NewPin opens a pin with
+type pinConfig struct {
+	direction     Direction
+	initHigh      bool
+	retryN        int
+	retryDuration time.Duration
+	activeLow     bool
+	edge          Edge
+	setEdge       bool
+	maxWriteRate  float64
+	ratePolicy    RateLimitPolicy
+	minDwell      time.Duration
+	dwellPolicy   DwellPolicy
+	eventBuffer   *eventBuffer
+	eventClock    EventClock
+	setEventClock bool
+}
+
+// PinOption configures a pin opened with NewPin
+type PinOption func(*pinConfig)
+
+// WithDirection opens the pin as an input or an output. Pins are inputs by default.
+func WithDirection(d Direction) PinOption {
+	return func(c *pinConfig) {
+		c.direction = d
+	}
+}
+
+// WithInitialHigh initializes an output to logic high instead of low
+func WithInitialHigh() PinOption {
+	return func(c *pinConfig) {
+		c.initHigh = true
+	}
+}
+
+// withInitial initializes an output to high or low
+func withInitial(high bool) PinOption {
+	return func(c *pinConfig) {
+		c.initHigh = high
+	}
+}
+
+// WithRetry makes each setup step be attempted up to retryN times, waiting retryDuration
+// in between, e.g. for udev to give a newly exported pin its permissions. retryN must be at
+// least 1.
+func WithRetry(retryN int, retryDuration time.Duration) PinOption {
+	return func(c *pinConfig) {
+		c.retryN = retryN
+		c.retryDuration = retryDuration
+	}
+}
+
+// WithActiveLow inverts the logic level of the pin, so that 1 is read and written as a low
+// voltage. The initial value of an output is a logic value too.
+func WithActiveLow() PinOption {
+	return func(c *pinConfig) {
+		c.activeLow = true
+	}
+}
+
+// WithEdge sets which edges of an input are reported, e.g. to a Watcher
+func WithEdge(e Edge) PinOption {
+	return func(c *pinConfig) {
+		c.edge = e
+		c.setEdge = true
+	}
+}
+
+// NewPin opens the given pin number, known by the kernel, as configured by opts.
+// Without options the pin is an active high input, set up in a single attempt.
+func NewPin(p uint, opts ...PinOption) (Pin, error) {
+	return NewPinCtx(context.Background(), p, opts...)
+}
+
+// NewPinCtx is like NewPin but stops retrying and returns ctx.Err() when ctx is done,
+// so that a long retry sequence doesn't hold up a shutdown.
+// A pin exported before ctx was done is left exported.
+func NewPinCtx(ctx context.Context, p uint, opts ...PinOption) (Pin, error) {
+	claim, err := claimPin(p)
+	if err != nil {
+		return Pin{}, err
+	}
+	pin, err := newPinCtx(ctx, p, opts...)
+	if err != nil {
+		claim.release()
+		return Pin{}, err
+	}
+	pin.state.claim = claim
+	return pin, nil
+}
+
+func newPinCtx(ctx context.Context, p uint, opts ...PinOption) (Pin, error) {
+	c := pinConfig{
+		direction: DirectionIn,
+		retryN:    1,
+	}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	if c.direction != DirectionIn && c.direction != DirectionOut {
+		return Pin{}, fmt.Errorf("invalid direction %d for gpio %d", c.direction, p)
+	}
+	if c.retryN < 1 {
+		return Pin{}, fmt.Errorf("invalid number of attempts %d for gpio %d", c.retryN, p)
+	}
+	if c.setEdge && c.direction != DirectionIn {
+		return Pin{}, errors.New("edges can only be set on inputs")
+	}
+	if c.setEventClock && c.direction != DirectionIn {
+		return Pin{}, errors.New("event clocks can only be set on inputs")
+	}
+	var rate *rateLimiter
+	if c.maxWriteRate != 0 {
+		if c.direction != DirectionOut {
+			return Pin{}, errors.New("write rates can only be limited on outputs")
+		}
+		var err error
+		if rate, err = newRateLimiter(c.maxWriteRate, c.ratePolicy); err != nil {
+			return Pin{}, err
+		}
+	}
+	var dw *dwell
+	if c.minDwell != 0 {
+		if c.direction != DirectionOut {
+			return Pin{}, errors.New("dwell times can only be set on outputs")
+		}
+		var err error
+		if dw, err = newDwell(c.minDwell, c.dwellPolicy); err != nil {
+			return Pin{}, err
+		}
+	}
+	buffer, err := newEventBuffer(c.eventBuffer, c.direction)
+	if err != nil {
+		return Pin{}, err
+	}
+
+	pin, err := newPin(p)
+	if err != nil {
+		return Pin{}, err
+	}
+
+	if err := checkMux(pin); err != nil {
+		return Pin{}, err
+	}
+	if err := checkHog(pin); err != nil {
+		return Pin{}, err
+	}
+
+	op := "NewInput"
+	if c.direction == DirectionOut {
+		op = "NewOutput"
+	}
+	setup := startSetup(ctx, op, p)
+	var exported bool
+	err = setup.retry(c.retryN, c.retryDuration, func() error {
+		var err error
+		exported, err = exportGPIO(pin)
+		return err
+	})
+	if err != nil {
+		setup.done(err)
+		return Pin{}, err
+	}
+
+	if err := sleepCtx(ctx, 10*time.Millisecond); err != nil {
+		setup.done(err)
+		return Pin{}, err
+	}
+	pin.rate = rate
+	pin.dwell = dw
+	pin.buffer = buffer
+
+	if c.activeLow {
+		err = setup.retry(c.retryN, c.retryDuration, func() error {
+			return setLogicLevel(pin, ActiveLow)
+		})
+		if err != nil {
+			setup.done(err)
+			return Pin{}, err
+		}
+	}
+
+	if c.direction == DirectionIn {
+		err = setup.retry(c.retryN, c.retryDuration, func() error {
+			err := setDirection(pin, DirectionIn, 0)
+			if err != nil {
+				return err
+			}
+			if c.setEdge {
+				if err := setEdgeTrigger(pin, c.edge); err != nil {
+					return err
+				}
+			}
+			if c.setEventClock {
+				if err := setEventClock(pin, c.eventClock); err != nil {
+					return err
+				}
+			}
+			pin, err = openPin(pin, DirectionIn, exported)
+			return err
+		})
+		setup.done(err)
+		if err != nil {
+			return Pin{}, err
+		}
+		return pin, nil
+	}
+
+	value := uint(0)
+	if c.initHigh {
+		value = uint(1)
+	}
+	initVal := value
+	// sysfs takes the initial value of an output as a raw value, ignoring active_low
+	if c.activeLow && pin.line == nil {
+		initVal ^= 1
+	}
+	err = setup.retry(c.retryN, c.retryDuration, func() error {
+		return setDirection(pin, DirectionOut, initVal)
+	})
+	if err != nil {
+		setup.done(err)
+		return Pin{}, err
+	}
+
+	err = setup.retry(c.retryN, c.retryDuration, func() error {
+		pin, err = openPin(pin, DirectionOut, exported)
+		return err
+	})
+	setup.done(err)
+	if err != nil {
+		return Pin{}, err
+	}
+	if dw != nil {
+		dw.opened(value)
+	}
+	return pin, nil
+}
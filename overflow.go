@@ -0,0 +1,161 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// OverflowPolicy selects what happens to the edges of Events arriving while its buffer is
+// full, see WithEventBuffer
+type OverflowPolicy uint
+
+const (
+	// OverflowDropNewest drops the edges arriving while the buffer is full
+	OverflowDropNewest OverflowPolicy = iota
+	// OverflowDropOldest drops the oldest buffered edge to make room for a new one
+	OverflowDropOldest
+	// OverflowBlock waits for the buffer to have room. Meanwhile the edges wait in the
+	// kernel, which drops them once its own buffer is full, and SimulateInput blocks.
+	OverflowBlock
+	// OverflowCoalesce folds the edges arriving while the buffer is full into a single event,
+	// delivered as soon as there is room, which has the value, edge and time of the last of
+	// them and counts the others in Coalesced
+	OverflowCoalesce
+)
+
+// eventBuffer is the buffer of Events set with WithEventBuffer
+type eventBuffer struct {
+	size   int
+	policy OverflowPolicy
+}
+
+// defaultEventBuffer is the buffer of pins opened without WithEventBuffer
+var defaultEventBuffer = eventBuffer{size: edgeEventLen, policy: OverflowDropNewest}
+
+// WithEventBuffer sets how many edges of an input Events buffers for its receivers, 32 by
+// default, and what happens to edges arriving while the buffer is full, OverflowDropNewest
+// by default. DroppedEvents counts the edges which were lost.
+func WithEventBuffer(size int, policy OverflowPolicy) PinOption {
+	return func(c *pinConfig) {
+		c.eventBuffer = &eventBuffer{size: size, policy: policy}
+	}
+}
+
+func newEventBuffer(b *eventBuffer, d Direction) (*eventBuffer, error) {
+	if b == nil {
+		return nil, nil
+	}
+	if d != DirectionIn {
+		return nil, errors.New("event buffers can only be set on inputs")
+	}
+	if b.size < 1 {
+		return nil, fmt.Errorf("invalid event buffer size %d", b.size)
+	}
+	if b.policy > OverflowCoalesce {
+		return nil, fmt.Errorf("invalid overflow policy %d", b.policy)
+	}
+	return b, nil
+}
+
+// DroppedEvents returns how many edges Events dropped or coalesced because its buffer was
+// full, 0 before Events was called. Edges dropped by callbacks falling behind aren't counted.
+func (p Pin) DroppedEvents() uint64 {
+	if p.state == nil {
+		return 0
+	}
+	p.lock()
+	s := p.state.events
+	p.unlock()
+	if s == nil {
+		return 0
+	}
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// queue puts ev in the buffer according to the overflow policy. s.mu must be held
+func (s *eventStream) queue(ev Event) {
+	switch s.buffer.policy {
+	case OverflowDropOldest:
+		select {
+		case s.ch <- ev:
+			return
+		default:
+		}
+		select {
+		case <-s.ch:
+			atomic.AddUint64(&s.dropped, 1)
+		default:
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	case OverflowBlock:
+		select {
+		case s.ch <- ev:
+		case <-s.quit:
+		}
+	case OverflowCoalesce:
+		if s.overflow != nil {
+			ev.Coalesced = s.overflow.Coalesced + 1
+			s.overflow = &ev
+			atomic.AddUint64(&s.dropped, 1)
+			return
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			s.overflow = &ev
+			select {
+			case s.kick <- struct{}{}:
+			default:
+			}
+		}
+	default:
+		select {
+		case s.ch <- ev:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+		}
+	}
+}
+
+// forward delivers the coalesced event once the buffer has room. The edges coalesced while
+// it waited are delivered once it was sent.
+func (s *eventStream) forward() {
+	defer close(s.forwarded)
+	for {
+		select {
+		case <-s.kick:
+		case <-s.quit:
+			return
+		}
+		for {
+			s.mu.Lock()
+			if s.overflow == nil {
+				s.mu.Unlock()
+				break
+			}
+			ev := *s.overflow
+			s.mu.Unlock()
+			select {
+			case s.ch <- ev:
+			case <-s.quit:
+				return
+			}
+			s.mu.Lock()
+			if s.overflow.Seq == ev.Seq {
+				s.overflow = nil
+			} else {
+				// the event sent is one of those coalesced since, and wasn't lost
+				rest := *s.overflow
+				rest.Coalesced -= ev.Coalesced + 1
+				s.overflow = &rest
+				atomic.AddUint64(&s.dropped, ^uint64(0))
+			}
+			s.mu.Unlock()
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package gpio
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrSessionEnded is returned for operations on a manual override session which ended
+var ErrSessionEnded = errors.New("manual override session ended")
+
+// overrideSourceName is the name of the sources a ManualOverride registers on its arbiters
+const overrideSourceName = "manual"
+
+// ManualOverride lets an operator take control of outputs for a bounded time, e.g. to test
+// an actuator during maintenance. Each output is driven through an Arbiter, on which the
+// override requests with PriorityOverride, so programmatic control resumes on its own when
+// the session ends or times out.
+type ManualOverride struct {
+	maxDuration time.Duration
+
+	mu       sync.Mutex
+	outputs  map[string]*overrideOutput
+	sessions map[string]*OverrideSession
+}
+
+type overrideOutput struct {
+	arbiter *Arbiter
+	source  *ArbiterSource
+	// session holds the output, nil when it isn't overridden
+	session *OverrideSession
+}
+
+// OverrideSession is the control of an operator over some outputs of a ManualOverride
+type OverrideSession struct {
+	m       *ManualOverride
+	id      string
+	outputs []string
+	expires time.Time
+	timer   *time.Timer
+	ended   bool
+}
+
+// NewManualOverride creates a ManualOverride for the arbiters of the given outputs, by name.
+// Sessions last at most maxDuration.
+func NewManualOverride(maxDuration time.Duration, outputs map[string]*Arbiter) (*ManualOverride, error) {
+	if maxDuration <= 0 {
+		return nil, fmt.Errorf("invalid maximum override duration %s", maxDuration)
+	}
+	m := &ManualOverride{
+		maxDuration: maxDuration,
+		outputs:     make(map[string]*overrideOutput),
+		sessions:    make(map[string]*OverrideSession),
+	}
+	for name, a := range outputs {
+		s, err := a.Source(overrideSourceName, PriorityOverride)
+		if err != nil {
+			return nil, fmt.Errorf("failed to override output %q: %s", name, err)
+		}
+		m.outputs[name] = &overrideOutput{arbiter: a, source: s}
+	}
+	return m, nil
+}
+
+// Begin starts a session controlling outputs for duration. The outputs keep their current
+// values until the session sets them, and none of them may be held by another session.
+func (m *ManualOverride) Begin(duration time.Duration, outputs ...string) (*OverrideSession, error) {
+	if duration <= 0 || duration > m.maxDuration {
+		return nil, fmt.Errorf("override duration must be between 0 and %s", m.maxDuration)
+	}
+	if len(outputs) == 0 {
+		return nil, errors.New("no outputs to override")
+	}
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, fmt.Errorf("failed to create session id: %s", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, name := range outputs {
+		o, ok := m.outputs[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown output %q", name)
+		}
+		if o.session != nil {
+			return nil, fmt.Errorf("output %q is already overridden", name)
+		}
+		for _, other := range outputs[:i] {
+			if other == name {
+				return nil, fmt.Errorf("output %q is listed twice", name)
+			}
+		}
+	}
+	s := &OverrideSession{
+		m:       m,
+		id:      hex.EncodeToString(b[:]),
+		outputs: append([]string(nil), outputs...),
+		expires: time.Now().Add(duration),
+	}
+	for i, name := range outputs {
+		o := m.outputs[name]
+		if err := o.source.Request(o.arbiter.Result().Value); err != nil {
+			for _, taken := range outputs[:i+1] {
+				m.outputs[taken].source.Release()
+			}
+			return nil, err
+		}
+	}
+	// the outputs are only taken once all of them are, so that a failure leaves none taken
+	for _, name := range outputs {
+		m.outputs[name].session = s
+	}
+	m.sessions[s.id] = s
+	s.timer = time.AfterFunc(duration, s.expire)
+	return s, nil
+}
+
+// Session returns the ongoing session with the given id
+func (m *ManualOverride) Session(id string) (*OverrideSession, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.sessions[id]
+	return s, ok
+}
+
+// ID identifies the session, e.g. for a remote operator
+func (s *OverrideSession) ID() string {
+	return s.id
+}
+
+// Outputs returns the names of the outputs controlled by the session
+func (s *OverrideSession) Outputs() []string {
+	return append([]string(nil), s.outputs...)
+}
+
+// Expires returns when the session times out
+func (s *OverrideSession) Expires() time.Time {
+	return s.expires
+}
+
+// Set drives one of the outputs of the session to v
+func (s *OverrideSession) Set(output string, v uint) error {
+	m := s.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.ended {
+		return ErrSessionEnded
+	}
+	o, ok := m.outputs[output]
+	if !ok || o.session != s {
+		return fmt.Errorf("output %q isn't controlled by the session", output)
+	}
+	return o.source.Request(v)
+}
+
+// End hands the outputs of the session back to programmatic control
+func (s *OverrideSession) End() error {
+	m := s.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.ended {
+		return ErrSessionEnded
+	}
+	s.timer.Stop()
+	return s.endLocked()
+}
+
+func (s *OverrideSession) expire() {
+	m := s.m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s.ended {
+		return
+	}
+	logger().Info("manual override session timed out", "session", s.id)
+	if err := s.endLocked(); err != nil {
+		logger().Error("failed to end manual override session", "session", s.id, "err", err)
+	}
+}
+
+// endLocked releases the outputs of the session, all of them even if one fails
+func (s *OverrideSession) endLocked() error {
+	s.ended = true
+	delete(s.m.sessions, s.id)
+	var err error
+	for _, name := range s.outputs {
+		o := s.m.outputs[name]
+		o.session = nil
+		if rerr := o.source.Release(); err == nil {
+			err = rerr
+		}
+	}
+	return err
+}
+
+// overrideStatus is the body of GET requests to the ManualOverride handler
+type overrideStatus struct {
+	Outputs  map[string]overrideOutputStatus `json:"outputs"`
+	Sessions []overrideSessionStatus         `json:"sessions"`
+}
+
+type overrideOutputStatus struct {
+	Value    uint   `json:"value"`
+	Source   string `json:"source,omitempty"`
+	Priority string `json:"priority,omitempty"`
+}
+
+type overrideSessionStatus struct {
+	ID      string    `json:"id"`
+	Outputs []string  `json:"outputs"`
+	Expires time.Time `json:"expires"`
+}
+
+type overrideBegin struct {
+	Outputs  []string `json:"outputs"`
+	Duration string   `json:"duration"`
+}
+
+// valueBody is the body of requests setting a value
+type valueBody struct {
+	Value *uint `json:"value"`
+}
+
+// ServeHTTP exposes the ManualOverride to remote operators, relative to where it is mounted:
+//
+//	GET    /                        the arbitration of each output and the ongoing sessions
+//	POST   /sessions                {"outputs": [...], "duration": "5m"} begins a session
+//	PUT    /sessions/{id}/{output}  {"value": 1} sets an output
+//	DELETE /sessions/{id}           ends a session
+//
+// Access control is left to the application, e.g. by wrapping the handler.
+func (m *ManualOverride) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, m.status())
+	case len(parts) == 1 && parts[0] == "sessions" && r.Method == http.MethodPost:
+		var req overrideBegin
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		d, err := time.ParseDuration(req.Duration)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s, err := m.Begin(d, req.Outputs...)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		writeJSON(w, http.StatusCreated, sessionStatus(s))
+	case len(parts) == 3 && parts[0] == "sessions" && r.Method == http.MethodPut:
+		s, ok := m.Session(parts[1])
+		if !ok {
+			http.Error(w, ErrSessionEnded.Error(), http.StatusNotFound)
+			return
+		}
+		var req valueBody
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Value == nil {
+			http.Error(w, "expected a value", http.StatusBadRequest)
+			return
+		}
+		if err := s.Set(parts[2], *req.Value); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && parts[0] == "sessions" && r.Method == http.MethodDelete:
+		s, ok := m.Session(parts[1])
+		if !ok {
+			http.Error(w, ErrSessionEnded.Error(), http.StatusNotFound)
+			return
+		}
+		if err := s.End(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (m *ManualOverride) status() overrideStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	st := overrideStatus{
+		Outputs:  make(map[string]overrideOutputStatus),
+		Sessions: []overrideSessionStatus{},
+	}
+	for name, o := range m.outputs {
+		res := o.arbiter.Result()
+		out := overrideOutputStatus{Value: res.Value, Source: res.Source}
+		if res.Source != "" {
+			out.Priority = res.Priority.String()
+		}
+		st.Outputs[name] = out
+	}
+	for _, s := range m.sessions {
+		st.Sessions = append(st.Sessions, sessionStatus(s))
+	}
+	sort.Slice(st.Sessions, func(i, j int) bool {
+		return st.Sessions[i].Expires.Before(st.Sessions[j].Expires)
+	})
+	return st
+}
+
+func sessionStatus(s *OverrideSession) overrideSessionStatus {
+	return overrideSessionStatus{ID: s.id, Outputs: s.Outputs(), Expires: s.expires}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger().Warn("failed to write response", "err", err)
+	}
+}
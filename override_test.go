@@ -0,0 +1,60 @@
+package gpio
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// testWriter records the values written to it and fails while fail is set
+type testWriter struct {
+	values []uint
+	fail   bool
+}
+
+func (w *testWriter) High() error { return w.write(1) }
+func (w *testWriter) Low() error  { return w.write(0) }
+
+func (w *testWriter) write(v uint) error {
+	if w.fail {
+		return errors.New("write failed")
+	}
+	w.values = append(w.values, v)
+	return nil
+}
+
+// A session which fails to take one of its outputs leaves the others free
+func TestOverrideBeginRollsBack(t *testing.T) {
+	var pump, valve testWriter
+	a, err := NewArbiter(&pump, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewArbiter(&valve, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mo, err := NewManualOverride(time.Minute, map[string]*Arbiter{"pump": a, "valve": b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the failed write leaves the valve to be written again by the next request
+	auto, err := b.Source("auto", PriorityAutomation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	valve.fail = true
+	if err := auto.Request(1); err == nil {
+		t.Fatal("request succeeded on a failing output")
+	}
+	if _, err := mo.Begin(time.Second, "pump", "valve"); err == nil {
+		t.Fatal("session began on a failing output")
+	}
+	s, err := mo.Begin(time.Second, "pump")
+	if err != nil {
+		t.Fatalf("output of the failed session is still taken: %s", err)
+	}
+	if err := s.End(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,194 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// DriveStrength is the output current of a pad in milliamps
+type DriveStrength uint
+
+// SlewRate selects how fast a pad's output switches
+type SlewRate uint
+
+const (
+	SlewDefault SlewRate = iota
+	SlewSlow
+	SlewFast
+)
+
+// PinctrlProvider configures the pads of one family of SoCs.
+// Providers are registered with RegisterPinctrl and the first one whose Detect
+// returns true is used for all pins. The built in providers, for the Raspberry Pi 1 to 4,
+// are only considered after the registered ones.
+// Pin numbers are the numbers known by the kernel.
+type PinctrlProvider interface {
+	// Name identifies the provider, e.g. "bcm2835"
+	Name() string
+	// Detect reports whether the provider supports the running system
+	Detect() bool
+	SetDriveStrength(pin uint, strength DriveStrength) error
+	SetSlewRate(pin uint, rate SlewRate) error
+}
+
+// ErrNoPinctrl is returned when no registered PinctrlProvider supports the running system
+var ErrNoPinctrl = errors.New("no pinctrl provider for this system")
+
+var (
+	pinctrlMu        sync.Mutex
+	pinctrlProviders []PinctrlProvider
+	pinctrlActive    PinctrlProvider
+	pinctrlDetected  bool
+	builtinPinctrl   = []PinctrlProvider{&bcmPads{}}
+)
+
+// RegisterPinctrl adds a provider to the ones considered for the running system
+func RegisterPinctrl(p PinctrlProvider) {
+	pinctrlMu.Lock()
+	defer pinctrlMu.Unlock()
+	pinctrlProviders = append(pinctrlProviders, p)
+	// let the new provider be considered if detection has already failed
+	if pinctrlActive == nil {
+		pinctrlDetected = false
+	}
+}
+
+// Pinctrl returns the provider in use for the running system
+func Pinctrl() (PinctrlProvider, error) {
+	pinctrlMu.Lock()
+	defer pinctrlMu.Unlock()
+	if !pinctrlDetected {
+		pinctrlDetected = true
+		providers := append(pinctrlProviders[:len(pinctrlProviders):len(pinctrlProviders)], builtinPinctrl...)
+		for _, p := range providers {
+			if p.Detect() {
+				pinctrlActive = p
+				break
+			}
+		}
+	}
+	if pinctrlActive == nil {
+		return nil, ErrNoPinctrl
+	}
+	return pinctrlActive, nil
+}
+
+// SetDriveStrength sets the output current of the pin's pad, where the SoC supports it.
+// The gpio character device has no such setting, so this needs a PinctrlProvider for the SoC.
+// On the Raspberry Pi the pads are configured for banks of pins, see the provider's Name "bcm2835".
+func (p Pin) SetDriveStrength(strength DriveStrength) error {
+	ctl, err := Pinctrl()
+	if err != nil {
+		return err
+	}
+	return ctl.SetDriveStrength(p.Number, strength)
+}
+
+// SetSlewRate sets how fast the pin's pad switches, where the SoC supports it
+func (p Pin) SetSlewRate(rate SlewRate) error {
+	ctl, err := Pinctrl()
+	if err != nil {
+		return err
+	}
+	return ctl.SetSlewRate(p.Number, rate)
+}
+
+// FunctionGPIO is the function reported by a PinmuxProvider for pins muxed to GPIO
+const FunctionGPIO = "gpio"
+
+// PinmuxProvider is implemented by PinctrlProviders which can report and change
+// the function a pin is muxed to
+type PinmuxProvider interface {
+	// Function returns the function the pin is muxed to, FunctionGPIO when it is a GPIO
+	Function(pin uint) (string, error)
+	// SetFunction muxes the pin to the named function
+	SetFunction(pin uint, function string) error
+}
+
+// ErrNoPinmux is returned when the pinctrl provider in use can't report or change pin functions
+var ErrNoPinmux = errors.New("pinctrl provider doesn't support pin muxing")
+
+func pinmux() (PinmuxProvider, error) {
+	ctl, err := Pinctrl()
+	if err != nil {
+		return nil, err
+	}
+	mux, ok := ctl.(PinmuxProvider)
+	if !ok {
+		return nil, ErrNoPinmux
+	}
+	return mux, nil
+}
+
+// Function returns the function the pin is currently muxed to
+func (p Pin) Function() (string, error) {
+	mux, err := pinmux()
+	if err != nil {
+		return "", err
+	}
+	return mux.Function(p.Number)
+}
+
+// SetFunction muxes the pin to the named function, FunctionGPIO to use it as a GPIO again
+func (p Pin) SetFunction(function string) error {
+	mux, err := pinmux()
+	if err != nil {
+		return err
+	}
+	return mux.SetFunction(p.Number, function)
+}
+
+// checkMux returns an error of kind ErrMuxed if the pin is known to be muxed away from GPIO.
+// When muxing can't be queried on this system the pin is assumed to be a GPIO.
+func checkMux(p Pin) error {
+	if installedMock() != nil {
+		return nil
+	}
+	mux, err := pinmux()
+	if err != nil {
+		return nil
+	}
+	function, err := mux.Function(p.Number)
+	if err != nil {
+		return nil
+	}
+	if function != FunctionGPIO {
+		return &PinError{
+			Pin:  p.Number,
+			Kind: ErrMuxed,
+			Err:  fmt.Errorf("gpio %d is muxed to function %s", p.Number, function),
+		}
+	}
+	return nil
+}
+
+// Pull selects the internal pull resistor of a pin
+type Pull uint
+
+const (
+	PullNone Pull = iota
+	PullUp
+	PullDown
+)
+
+// PullProvider is implemented by PinctrlProviders which can configure pull resistors
+type PullProvider interface {
+	SetPull(pin uint, pull Pull) error
+}
+
+// ErrNoPull is returned when the pinctrl provider in use can't configure pull resistors
+var ErrNoPull = errors.New("pinctrl provider doesn't support pull resistors")
+
+// SetPull configures the internal pull resistor of the pin, where the SoC supports it
+func (p Pin) SetPull(pull Pull) error {
+	ctl, err := Pinctrl()
+	if err != nil {
+		return err
+	}
+	pp, ok := ctl.(PullProvider)
+	if !ok {
+		return ErrNoPull
+	}
+	return pp.SetPull(p.Number, pull)
+}
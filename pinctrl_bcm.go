@@ -0,0 +1,293 @@
+package gpio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// bcmPads configures the pads of the Broadcom SoCs of the Raspberry Pi 1 to 4 through their
+// pad control registers, which needs access to /dev/mem. Each register is shared by a bank
+// of pins, 0-27, 28-45 and 46-53, so setting one pin changes its whole bank. The functions of
+// the pins are reported and muxed through the function select registers of /dev/gpiomem,
+// and their pulls set through the pull registers there.
+// The Raspberry Pi 5 drives its header through the RP1, which isn't supported.
+type bcmPads struct {
+	mu   sync.Mutex
+	regs []byte
+	// base is the number of the first pin of the SoC's gpio chip
+	base uint
+}
+
+const (
+	// bcmPadsOffset is the offset of the power management block, which holds the pad
+	// control registers, from the peripheral base
+	bcmPadsOffset = 0x100000
+	// bcmPadsPassword must be written in the top byte of a register for the write to apply
+	bcmPadsPassword = 0x5a << 24
+	bcmPadsSlew     = 1 << 4
+	bcmPadsDrive    = 0x7
+)
+
+// bcmSoCs are the compatible strings of the supported SoCs and their default peripheral base
+var bcmSoCs = []struct {
+	compatible string
+	base       int64
+}{
+	{"brcm,bcm2835", 0x20000000},
+	{"brcm,bcm2836", 0x3f000000},
+	{"brcm,bcm2837", 0x3f000000},
+	{"brcm,bcm2711", 0xfe000000},
+}
+
+func (b *bcmPads) Name() string {
+	return "bcm2835"
+}
+
+func (b *bcmPads) Detect() bool {
+	_, ok := bcmDefaultBase()
+	return ok
+}
+
+// bcmDefaultBase returns the peripheral base of the running SoC if it is supported
+func bcmDefaultBase() (int64, bool) {
+	_, base, ok := bcmSoC()
+	return base, ok
+}
+
+// bcmSoC returns the compatible string and default peripheral base of the running SoC if it
+// is supported
+func bcmSoC() (string, int64, bool) {
+	compatible, err := ioutil.ReadFile("/proc/device-tree/compatible")
+	if err != nil {
+		return "", 0, false
+	}
+	for _, c := range bytes.Split(compatible, []byte{0}) {
+		for _, soc := range bcmSoCs {
+			if string(c) == soc.compatible {
+				return soc.compatible, soc.base, true
+			}
+		}
+	}
+	return "", 0, false
+}
+
+// bcmPeripheralBase reads the peripheral base from the device tree like bcm_host does,
+// falling back to the default of the SoC
+func bcmPeripheralBase() (int64, error) {
+	base, ok := bcmDefaultBase()
+	if !ok {
+		return 0, ErrNoPinctrl
+	}
+	ranges, err := ioutil.ReadFile("/proc/device-tree/soc/ranges")
+	if err != nil || len(ranges) < 12 {
+		return base, nil
+	}
+	if addr := binary.BigEndian.Uint32(ranges[4:8]); addr != 0 {
+		return int64(addr), nil
+	}
+	// the BCM2711 has 64 bit parent addresses
+	return int64(binary.BigEndian.Uint32(ranges[8:12])), nil
+}
+
+// bcmChipBase returns the number of the first pin of the SoC's chip. Character device numbers
+// start with the first chip, as do gpiomem numbers, while recent kernels number sysfs pins
+// from 512.
+func bcmChipBase() uint {
+	if chardevNumbering() {
+		return 0
+	}
+	chips, _ := filepath.Glob(classPath("gpiochip*"))
+	for _, chip := range chips {
+		label, err := ioutil.ReadFile(chip + "/label")
+		if err != nil || !strings.HasPrefix(string(label), "pinctrl-bcm") {
+			continue
+		}
+		base, err := ioutil.ReadFile(chip + "/base")
+		if err != nil {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(string(base))); err == nil {
+			return uint(n)
+		}
+	}
+	return 0
+}
+
+// register returns the pad control register of pin, mapping the registers on first use
+func (b *bcmPads) register(pin uint) (*uint32, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.regs == nil {
+		base, err := bcmPeripheralBase()
+		if err != nil {
+			return nil, err
+		}
+		mem, err := os.OpenFile("/dev/mem", os.O_RDWR|syscall.O_SYNC, 0)
+		if err != nil {
+			return nil, classFileError(pin, err, "failed to open pad control registers: %w")
+		}
+		defer mem.Close()
+		regs, err := syscall.Mmap(int(mem.Fd()), base+bcmPadsOffset, os.Getpagesize(), syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+		if err != nil {
+			return nil, fmt.Errorf("failed to map pad control registers: %s", err)
+		}
+		b.regs = regs
+		b.base = bcmChipBase()
+	}
+	if pin < b.base {
+		return nil, fmt.Errorf("gpio %d isn't a pin of the SoC", pin)
+	}
+	var off uint
+	switch n := pin - b.base; {
+	case n < 28:
+		off = 0x2c
+	case n < 46:
+		off = 0x30
+	case n < 54:
+		off = 0x34
+	default:
+		return nil, fmt.Errorf("gpio %d isn't a pin of the SoC", pin)
+	}
+	return (*uint32)(unsafe.Pointer(&b.regs[off])), nil
+}
+
+// update changes the bits of mask in the register of pin to v
+func (b *bcmPads) update(pin uint, mask uint32, v uint32) error {
+	reg, err := b.register(pin)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cur := atomic.LoadUint32(reg) & 0xff
+	atomic.StoreUint32(reg, bcmPadsPassword|cur&^mask|v)
+	return nil
+}
+
+// SetDriveStrength takes 2 to 16mA in steps of 2mA, the default is 8mA
+func (b *bcmPads) SetDriveStrength(pin uint, strength DriveStrength) error {
+	if strength < 2 || strength > 16 || strength%2 != 0 {
+		return fmt.Errorf("invalid drive strength %dmA, the pads take 2 to 16mA in steps of 2mA", strength)
+	}
+	return b.update(pin, bcmPadsDrive, uint32(strength/2-1))
+}
+
+// SetSlewRate limits the slew rate with SlewSlow, the pads aren't limited by default
+func (b *bcmPads) SetSlewRate(pin uint, rate SlewRate) error {
+	switch rate {
+	case SlewDefault, SlewFast:
+		return b.update(pin, bcmPadsSlew, bcmPadsSlew)
+	case SlewSlow:
+		return b.update(pin, bcmPadsSlew, 0)
+	}
+	return fmt.Errorf("invalid slew rate %d", rate)
+}
+
+// registers of the pull resistors in the gpio block. The BCM2835 to 2837 clock a pull set in
+// GPPUD into the pins selected in GPPUDCLK0 and 1, while the BCM2711 has 2 bits per pin.
+const (
+	bcmGPPUD     = 0x94
+	bcmGPPUDClk  = 0x98
+	bcm2711Pulls = 0xe4
+	// bcmPullSetup is comfortably more than the 150 cycles GPPUD needs to settle
+	bcmPullSetup = 10 * time.Microsecond
+)
+
+// SetPull configures the pull resistor of pin. The BCM2835 to 2837 can't read the pull back,
+// so it is only known once set.
+func (b *bcmPads) SetPull(pin uint, pull Pull) error {
+	if pull > PullDown {
+		return fmt.Errorf("invalid pull %d", pull)
+	}
+	if err := mapGPIOMem(); err != nil {
+		return err
+	}
+	base := bcmChipBase()
+	if pin < base || pin-base >= memLines {
+		return fmt.Errorf("gpio %d isn't a pin of the SoC", pin)
+	}
+	n := pin - base
+	memMu.Lock()
+	defer memMu.Unlock()
+	if soc, _, _ := bcmSoC(); soc == "brcm,bcm2711" {
+		// 0 is none, 1 up and 2 down
+		v := [...]uint32{PullNone: 0, PullUp: 1, PullDown: 2}[pull]
+		reg := memReg(bcm2711Pulls + n/16*4)
+		shift := n % 16 * 2
+		atomic.StoreUint32(reg, atomic.LoadUint32(reg)&^(3<<shift)|v<<shift)
+		return nil
+	}
+	// 0 is none, 1 down and 2 up
+	v := [...]uint32{PullNone: 0, PullUp: 2, PullDown: 1}[pull]
+	clk := memReg(bcmGPPUDClk + n/32*4)
+	atomic.StoreUint32(memReg(bcmGPPUD), v)
+	time.Sleep(bcmPullSetup)
+	atomic.StoreUint32(clk, 1<<(n%32))
+	time.Sleep(bcmPullSetup)
+	atomic.StoreUint32(memReg(bcmGPPUD), 0)
+	atomic.StoreUint32(clk, 0)
+	return nil
+}
+
+// bcmFunctions are the functions selected by the values of the 3 bit fields of the function
+// select registers. Inputs and outputs are both GPIO.
+var bcmFunctions = [8]string{FunctionGPIO, FunctionGPIO, "alt5", "alt4", "alt0", "alt1", "alt2", "alt3"}
+
+// fsel returns the function select register of pin and the shift of its field. The registers
+// are those of the gpio block mapped from /dev/gpiomem, like the gpiomem backend does.
+func (b *bcmPads) fsel(pin uint) (*uint32, uint, error) {
+	if err := mapGPIOMem(); err != nil {
+		return nil, 0, err
+	}
+	base := bcmChipBase()
+	if pin < base || pin-base >= memLines {
+		return nil, 0, fmt.Errorf("gpio %d isn't a pin of the SoC", pin)
+	}
+	n := pin - base
+	return memReg(memFsel + n/10*4), n % 10 * 3, nil
+}
+
+// Function returns FunctionGPIO or one of the alternate functions "alt0" to "alt5"
+func (b *bcmPads) Function(pin uint) (string, error) {
+	reg, shift, err := b.fsel(pin)
+	if err != nil {
+		return "", err
+	}
+	return bcmFunctions[atomic.LoadUint32(reg)>>shift&7], nil
+}
+
+// SetFunction takes FunctionGPIO, which leaves the pin an input until it is opened, or one of
+// the alternate functions "alt0" to "alt5"
+func (b *bcmPads) SetFunction(pin uint, function string) error {
+	v := -1
+	if function == FunctionGPIO {
+		v = 0
+	}
+	for i := 2; i < len(bcmFunctions) && v < 0; i++ {
+		if bcmFunctions[i] == function {
+			v = i
+		}
+	}
+	if v < 0 {
+		return fmt.Errorf("unknown function %q for gpio %d", function, pin)
+	}
+	reg, shift, err := b.fsel(pin)
+	if err != nil {
+		return err
+	}
+	memMu.Lock()
+	defer memMu.Unlock()
+	atomic.StoreUint32(reg, atomic.LoadUint32(reg)&^(7<<shift)|uint32(v)<<shift)
+	return nil
+}
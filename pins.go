@@ -0,0 +1,47 @@
+package gpio
+
+import (
+	"fmt"
+)
+
+// Reader is anything a pin value can be read from, such as a Pin or a MuxInput
+type Reader interface {
+	Read() (value uint, err error)
+}
+
+// Writer is anything which can be driven high or low like an output Pin
+type Writer interface {
+	High() error
+	Low() error
+}
+
+// InputPin is an input which is released with Close. Application code can accept
+// InputPin and OutputPin instead of Pin, so that pins behind expanders, remote pins or
+// test doubles can be used in place of the kernel's.
+type InputPin interface {
+	Reader
+	Close()
+}
+
+// OutputPin is an output which is released with Close
+type OutputPin interface {
+	Writer
+	Close()
+}
+
+var (
+	_ InputPin  = Pin{}
+	_ OutputPin = Pin{}
+	_ Reader    = (*MuxInput)(nil)
+)
+
+// Write drives w to v, which is 0 or 1
+func Write(w Writer, v uint) error {
+	switch v {
+	case 0:
+		return w.Low()
+	case 1:
+		return w.High()
+	}
+	return &PinError{Kind: ErrInvalidValue, Err: fmt.Errorf("invalid output value %d", v)}
+}
@@ -0,0 +1,134 @@
+package gpio
+
+import (
+	"errors"
+	"time"
+)
+
+// EdgeEvent is an edge delivered by a PinWatch.
+// Value is the value read right after the edge and Time is when the edge was noticed.
+// Simulated is true for the changes caused by SimulateInput.
+type EdgeEvent struct {
+	Pin       uint
+	Value     uint
+	Time      time.Time
+	Simulated bool
+}
+
+const edgeEventLen = 32
+
+// PinWatch delivers the edges of a single input pin on Events.
+// Events are dropped when nobody receives them.
+type PinWatch struct {
+	Events chan EdgeEvent
+
+	pin  Pin
+	edge Edge
+	// last is the last debounced value
+	last    uint
+	poller  *edgePoller
+	sim     *simSub
+	stopped chan struct{}
+}
+
+// Watch configures an input pin to trigger on edge and delivers its edges on the Events
+// channel of the returned PinWatch, without polling the pin. Unlike a Watcher, the
+// kernel is waited on through epoll and only for this pin, and Close returns at once.
+// The events of a pin returned by WithDebounce are the debounced changes matching edge.
+func (p Pin) Watch(edge Edge) (*PinWatch, error) {
+	if p.dir() != DirectionIn {
+		return nil, errWrongDirection(p, DirectionIn)
+	}
+	if edge == EdgeNone {
+		return nil, errors.New("watching a pin needs an edge")
+	}
+	if err := setEdgeTrigger(p, edge); err != nil {
+		return nil, err
+	}
+	// reading clears the event pending since the pin was opened
+	v, err := readPin(p)
+	if err != nil {
+		return nil, err
+	}
+	if p.debounce != nil {
+		v, _ = p.debounce.feed(v, time.Now())
+	}
+	poller, err := newEdgePoller(p)
+	if err != nil {
+		return nil, err
+	}
+	w := &PinWatch{
+		Events:  make(chan EdgeEvent, edgeEventLen),
+		pin:     p,
+		edge:    edge,
+		last:    v,
+		poller:  poller,
+		stopped: make(chan struct{}),
+	}
+	w.sim = subscribeSim(p, func(prev uint, cur uint, simulated bool) {
+		if !edgeMatches(edge, prev, cur) {
+			return
+		}
+		select {
+		case w.Events <- EdgeEvent{Pin: p.Number, Value: cur, Time: time.Now(), Simulated: simulated}:
+		default:
+		}
+	})
+	spawn("PinWatch", []uint{p.Number}, w.run)
+	return w, nil
+}
+
+func (w *PinWatch) run() {
+	defer close(w.stopped)
+	timeout := time.Duration(-1)
+	for {
+		_, woken, err := w.poller.wait(timeout)
+		if err != nil {
+			logger().Error("pin watch stopped", "pin", w.pin.Number, "err", err)
+			return
+		}
+		if woken {
+			return
+		}
+		// without debouncing the wait only ends on an edge
+		now := time.Now()
+		v, err := readPin(w.pin)
+		if err != nil {
+			logger().Error("pin watch stopped", "pin", w.pin.Number, "err", err)
+			return
+		}
+		if _, ok := simulatedInput(w.pin.Number); ok {
+			// the physical edges of a simulated input don't change what it reads
+			timeout = -1
+			continue
+		}
+		if w.pin.debounce != nil {
+			var recheck time.Duration
+			v, recheck = w.pin.debounce.feed(v, now)
+			timeout = -1
+			if recheck > 0 {
+				timeout = recheck
+			}
+			changed := v != w.last
+			w.last = v
+			if !changed || (w.edge == EdgeRising && v != 1) || (w.edge == EdgeFalling && v != 0) {
+				continue
+			}
+		}
+		if injectFault(FaultEvent, w.pin, "value") != nil {
+			continue
+		}
+		select {
+		case w.Events <- EdgeEvent{Pin: w.pin.Number, Value: v, Time: now}:
+		default:
+		}
+	}
+}
+
+// Close stops delivering edges. The pin is left open with its edge setting
+func (w *PinWatch) Close() {
+	w.sim.unsubscribe()
+	w.poller.wakeup()
+	<-w.stopped
+	w.poller.close()
+}
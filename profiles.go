@@ -0,0 +1,71 @@
+package gpio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// ProfileEnv is the environment variable which selects a profile by name, overriding detection
+const ProfileEnv = "GPIO_PROFILE"
+
+// DefaultProfile is used when no profile is selected by ProfileEnv or by detection
+const DefaultProfile = "default"
+
+// Profiles holds named pin maps, typically one per board revision, so that a single
+// binary can serve several hardware revisions.
+type Profiles map[string][]PinRequest
+
+// LoadProfiles reads profiles from a JSON file mapping profile names to lists of pins:
+//
+//	{"rev-a": [{"name": "led", "number": 17, "output": true}], "rev-b": [...]}
+func LoadProfiles(path string) (Profiles, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles: %s", err)
+	}
+	var p Profiles
+	if err := json.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles %s: %s", path, err)
+	}
+	return p, nil
+}
+
+// Names returns the profile names in sorted order
+func (p Profiles) Names() []string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Select picks a profile: the one named by ProfileEnv if it is set, else detected if it
+// isn't empty, else DefaultProfile. It returns the chosen name and its pins.
+func (p Profiles) Select(detected string) (string, []PinRequest, error) {
+	name := os.Getenv(ProfileEnv)
+	if name == "" {
+		name = detected
+	}
+	if name == "" {
+		name = DefaultProfile
+	}
+	pins, ok := p[name]
+	if !ok {
+		return "", nil, fmt.Errorf("unknown profile %q, have %v", name, p.Names())
+	}
+	return name, pins, nil
+}
+
+// StartProfile selects a profile as Profiles.Select does and starts its pins on m
+func (m *Manager) StartProfile(p Profiles, detected string) (string, ClaimReport, error) {
+	name, pins, err := p.Select(detected)
+	if err != nil {
+		return "", nil, err
+	}
+	report, err := m.Start(pins...)
+	return name, report, err
+}
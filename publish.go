@@ -0,0 +1,131 @@
+package gpio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+)
+
+// PublishedEvent is a pin change sent by an EventPublisher.
+// Seq counts the datagrams of a publisher, so listeners can tell when some were lost.
+type PublishedEvent struct {
+	Seq   uint32
+	Pin   uint
+	Value uint
+	Time  time.Time
+}
+
+const (
+	publishVersion = 1
+	// PublishedEventSize is the size of the datagrams sent by an EventPublisher
+	PublishedEventSize = 16
+)
+
+// MarshalBinary encodes e as a datagram: a version byte, the value byte, the pin as a
+// big endian uint16, the sequence number as a uint32 and the time in unix nanoseconds as an int64
+func (e PublishedEvent) MarshalBinary() ([]byte, error) {
+	if e.Pin > 0xffff {
+		return nil, fmt.Errorf("gpio %d doesn't fit in an event datagram", e.Pin)
+	}
+	b := make([]byte, PublishedEventSize)
+	b[0] = publishVersion
+	b[1] = byte(e.Value)
+	binary.BigEndian.PutUint16(b[2:], uint16(e.Pin))
+	binary.BigEndian.PutUint32(b[4:], e.Seq)
+	binary.BigEndian.PutUint64(b[8:], uint64(e.Time.UnixNano()))
+	return b, nil
+}
+
+// UnmarshalBinary decodes a datagram sent by an EventPublisher
+func (e *PublishedEvent) UnmarshalBinary(b []byte) error {
+	if len(b) < PublishedEventSize {
+		return errors.New("event datagram is too short")
+	}
+	if b[0] != publishVersion {
+		return fmt.Errorf("unknown event datagram version %d", b[0])
+	}
+	e.Value = uint(b[1])
+	e.Pin = uint(binary.BigEndian.Uint16(b[2:]))
+	e.Seq = binary.BigEndian.Uint32(b[4:])
+	e.Time = time.Unix(0, int64(binary.BigEndian.Uint64(b[8:])))
+	return nil
+}
+
+// EventPublisher watches pins and sends each of their changes as a UDP datagram to a
+// multicast group, so that several listeners on the LAN can follow them without a broker.
+// The first datagram of each pin reports its initial value.
+type EventPublisher struct {
+	watcher *Watcher
+	conn    *net.UDPConn
+	seq     uint32
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewEventPublisher starts publishing the changes of pins to group, e.g. "239.0.0.1:5353"
+func NewEventPublisher(group string, pins ...uint) (*EventPublisher, error) {
+	addr, err := net.ResolveUDPAddr("udp", group)
+	if err != nil {
+		return nil, err
+	}
+	if !addr.IP.IsMulticast() {
+		return nil, fmt.Errorf("%s is not a multicast address", addr.IP)
+	}
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	p := &EventPublisher{
+		conn:    conn,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	p.watcher = NewWatcher()
+	for _, pin := range pins {
+		if err := p.watcher.AddPin(pin); err != nil {
+			p.watcher.Close()
+			conn.Close()
+			return nil, fmt.Errorf("failed to watch published pin: %s", err)
+		}
+	}
+	spawn("EventPublisher", pins, p.run)
+	return p, nil
+}
+
+func (p *EventPublisher) run() {
+	defer close(p.stopped)
+	for {
+		select {
+		case n := <-p.watcher.Notification:
+			p.publish(n)
+		case <-p.done:
+			return
+		}
+	}
+}
+
+func (p *EventPublisher) publish(n WatcherNotification) {
+	p.seq++
+	b, err := PublishedEvent{Seq: p.seq, Pin: n.Pin, Value: n.Value, Time: time.Now()}.MarshalBinary()
+	if err != nil {
+		logger().Error("failed to publish event", "err", err)
+		return
+	}
+	if _, err := p.conn.Write(b); err != nil {
+		logger().Error("failed to publish event", "err", err)
+	}
+}
+
+// Close stops watching the pins and closes the socket
+func (p *EventPublisher) Close() error {
+	close(p.done)
+	<-p.stopped
+	err := p.watcher.Shutdown()
+	if cerr := p.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,146 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// spinThreshold is how long before a deadline sleepUntil stops sleeping and starts spinning,
+// since the scheduler can't be trusted to wake up more precisely than that
+const spinThreshold = 200 * time.Microsecond
+
+// sleepUntil waits until deadline, sleeping for most of the wait and spinning for the end of it
+func sleepUntil(deadline time.Time) {
+	if d := time.Until(deadline) - spinThreshold; d > 0 {
+		time.Sleep(d)
+	}
+	for time.Now().Before(deadline) {
+	}
+}
+
+// JitterStats describes how far edges were from their scheduled times
+type JitterStats struct {
+	Edges int
+	Mean  time.Duration
+	Max   time.Duration
+}
+
+type jitterAccumulator struct {
+	stats JitterStats
+	total time.Duration
+}
+
+func (j *jitterAccumulator) add(scheduled time.Time, actual time.Time) {
+	d := actual.Sub(scheduled)
+	if d < 0 {
+		d = -d
+	}
+	j.stats.Edges++
+	j.total += d
+	if d > j.stats.Max {
+		j.stats.Max = d
+	}
+}
+
+func (j *jitterAccumulator) result() JitterStats {
+	if j.stats.Edges != 0 {
+		j.stats.Mean = j.total / time.Duration(j.stats.Edges)
+	}
+	return j.stats
+}
+
+// PulseTrain emits exactly n pulses on an output pin, each high for high and then low for low.
+// Edges are scheduled against the start of the train so that timing errors don't accumulate,
+// and the returned stats report how far each edge was from its schedule.
+// The pin is left low. Timing is best effort: the calling goroutine spins for the
+// last part of every wait, and sysfs writes take several microseconds each.
+func (p Pin) PulseTrain(n int, high time.Duration, low time.Duration) (JitterStats, error) {
+	if p.dir() != DirectionOut {
+		return JitterStats{}, errWrongDirection(p, DirectionOut)
+	}
+	if n < 0 {
+		return JitterStats{}, fmt.Errorf("invalid pulse count %d", n)
+	}
+	if high <= 0 || low <= 0 {
+		return JitterStats{}, errors.New("pulse durations must be positive")
+	}
+
+	var jitter jitterAccumulator
+	period := high + low
+	start := time.Now()
+	for i := 0; i < n; i++ {
+		rise := start.Add(time.Duration(i) * period)
+		sleepUntil(rise)
+		jitter.add(rise, time.Now())
+		if err := writePin(p, 1); err != nil {
+			return jitter.result(), err
+		}
+
+		fall := rise.Add(high)
+		sleepUntil(fall)
+		jitter.add(fall, time.Now())
+		if err := writePin(p, 0); err != nil {
+			return jitter.result(), err
+		}
+	}
+	return jitter.result(), nil
+}
+
+// WriteBatch drives an output pin through values, one every interval from the start of the
+// batch, e.g. to generate a precomputed waveform. The pin is checked and locked once for the
+// whole batch and each value is a single write, so other operations on the pin wait until it
+// is done. An interval of 0 writes the values back to back. The pin is left at the last value.
+func (p Pin) WriteBatch(values []Value, interval time.Duration) (JitterStats, error) {
+	if p.dir() != DirectionOut {
+		return JitterStats{}, errWrongDirection(p, DirectionOut)
+	}
+	if interval < 0 {
+		return JitterStats{}, fmt.Errorf("invalid batch interval %s", interval)
+	}
+	for _, v := range values {
+		if v != Inactive && v != Active {
+			return JitterStats{}, errInvalidValue(p.Number, uint(v))
+		}
+	}
+	if p.gate != nil && !p.gate.isArmed() {
+		return JitterStats{}, ErrNotArmed
+	}
+	if p.dryRun() {
+		for _, v := range values {
+			dryRunWrite(p, uint(v))
+		}
+		return JitterStats{}, nil
+	}
+	if err := injectFault(FaultWrite, p, "value"); err != nil {
+		return JitterStats{}, fmt.Errorf("failed to write: %s", err)
+	}
+	p.lock()
+	defer p.unlock()
+	if err := p.checkOpen(); err != nil {
+		return JitterStats{}, err
+	}
+	bufs := [][]byte{{'0'}, {'1'}}
+	var jitter jitterAccumulator
+	start := time.Now()
+	for i, v := range values {
+		if interval > 0 {
+			at := start.Add(time.Duration(i) * interval)
+			sleepUntil(at)
+			jitter.add(at, time.Now())
+		}
+		var err error
+		if p.line != nil {
+			err = p.line.setValue(p.f, uint(v))
+		} else {
+			_, err = p.f.Write(bufs[v])
+		}
+		if err != nil {
+			return jitter.result(), fmt.Errorf("failed to write value %d of batch: %s", i, err)
+		}
+	}
+	if len(values) > 0 {
+		watchWrite(p, uint(values[len(values)-1]))
+	}
+	return jitter.result(), nil
+}
@@ -0,0 +1,93 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// RateLimitPolicy selects what happens to writes beyond the rate set with WithMaxWriteRate
+type RateLimitPolicy uint
+
+const (
+	// RateReject fails writes beyond the rate with ErrWriteRate
+	RateReject RateLimitPolicy = iota
+	// RateCoalesce delays writes beyond the rate until they are allowed, and only the last of
+	// the writes delayed together is applied
+	RateCoalesce
+)
+
+// ErrWriteRate is returned by writes rejected for exceeding the rate set with WithMaxWriteRate
+var ErrWriteRate = errors.New("gpio write rate exceeded")
+
+// rateLimiter spaces the writes of an output
+type rateLimiter struct {
+	interval time.Duration
+	policy   RateLimitPolicy
+
+	mu      sync.Mutex
+	last    time.Time
+	pending func() error
+	timer   *time.Timer
+}
+
+// WithMaxWriteRate limits an output to hz writes per second, to protect relays and
+// contactors from code which would cycle them destructively fast. Writes beyond the rate
+// are rejected or coalesced according to policy. Coalesced writes are audited when they are
+// made and logged if they fail when they are finally applied.
+// The limit applies to High, Low, Toggle and WriteTimeout, not to helpers such as a SoftPWM.
+func WithMaxWriteRate(hz float64, policy RateLimitPolicy) PinOption {
+	return func(c *pinConfig) {
+		c.maxWriteRate = hz
+		c.ratePolicy = policy
+	}
+}
+
+func newRateLimiter(hz float64, policy RateLimitPolicy) (*rateLimiter, error) {
+	if hz <= 0 {
+		return nil, fmt.Errorf("invalid write rate %f", hz)
+	}
+	if policy != RateReject && policy != RateCoalesce {
+		return nil, fmt.Errorf("invalid rate limit policy %d", policy)
+	}
+	return &rateLimiter{
+		interval: time.Duration(float64(time.Second) / hz),
+		policy:   policy,
+	}, nil
+}
+
+// write calls fn now if the rate allows it, and otherwise rejects it or delays it
+func (r *rateLimiter) write(p Pin, fn func() error) error {
+	r.mu.Lock()
+	now := time.Now()
+	if r.pending == nil && (r.last.IsZero() || now.Sub(r.last) >= r.interval) {
+		r.last = now
+		r.mu.Unlock()
+		return fn()
+	}
+	defer r.mu.Unlock()
+	if r.policy == RateReject {
+		return ErrWriteRate
+	}
+	r.pending = fn
+	if r.timer == nil {
+		r.timer = time.AfterFunc(r.last.Add(r.interval).Sub(now), func() {
+			r.flush(p)
+		})
+	}
+	return nil
+}
+
+// flush applies the last delayed write
+func (r *rateLimiter) flush(p Pin) {
+	r.mu.Lock()
+	fn := r.pending
+	r.pending = nil
+	r.timer = nil
+	r.last = time.Now()
+	r.mu.Unlock()
+	if err := fn(); err != nil {
+		logger().Error("failed to apply coalesced write", "pin", p.Number, "err", err)
+	}
+}
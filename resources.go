@@ -0,0 +1,58 @@
+package gpio
+
+import (
+	"context"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// goroutines counts the background goroutines started by this package which are still running
+var goroutines int64
+
+// spawn runs fn on a new goroutine which is accounted for by Goroutines and labeled with
+// the feature it serves and its pins, see labelGoroutine
+func spawn(feature string, pins []uint, fn func()) {
+	atomic.AddInt64(&goroutines, 1)
+	go func() {
+		defer atomic.AddInt64(&goroutines, -1)
+		labelGoroutine(feature, pins)
+		fn()
+	}()
+}
+
+// labelGoroutine sets the pprof labels of the current goroutine, so that CPU profiles
+// attribute its load: "gpio" is the feature, e.g. "Watcher", and "gpio_pins" lists the pins,
+// e.g. "17,22", when there are any. The goroutines it starts inherit them.
+func labelGoroutine(feature string, pins []uint) {
+	labels := []string{"gpio", feature}
+	if len(pins) > 0 {
+		sorted := append([]uint(nil), pins...)
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		numbers := make([]string, len(sorted))
+		for i, n := range sorted {
+			numbers[i] = strconv.FormatUint(uint64(n), 10)
+		}
+		labels = append(labels, "gpio_pins", strings.Join(numbers, ","))
+	}
+	pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels(labels...)))
+}
+
+// pinNumbers returns the numbers of pins
+func pinNumbers(pins []Pin) []uint {
+	numbers := make([]uint, len(pins))
+	for i, p := range pins {
+		numbers[i] = p.Number
+	}
+	return numbers
+}
+
+// Goroutines returns the number of background goroutines started by this package which are
+// still running. Once every Watcher, engine, queue and generator of the package has been
+// closed this drops back to 0, except for handlers and pin accesses which timed out and are
+// still blocked. A value which keeps growing across reconfigurations is a leak.
+func Goroutines() int {
+	return int(atomic.LoadInt64(&goroutines))
+}
@@ -0,0 +1,148 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PackedSample is a fixed size sample of up to 64 pins, for long captures which must not
+// allocate. Bit i of Bits is the value of the pin at index i of the Sampler.
+// Time is the midpoint of the reads in unix nanoseconds and Skew is the time it took to read all pins.
+type PackedSample struct {
+	Time int64
+	Skew time.Duration
+	Bits uint64
+}
+
+// Value returns the value of the pin at index i
+func (s PackedSample) Value(i int) uint {
+	return uint(s.Bits>>uint(i)) & 1
+}
+
+// SampleRing is a ring buffer of PackedSamples over a buffer provided by the caller.
+// When it is full, new samples overwrite the oldest ones. It is safe to drain the ring
+// from one goroutine while a capture fills it from another.
+type SampleRing struct {
+	mu          sync.Mutex
+	buf         []PackedSample
+	start       int
+	n           int
+	overwritten uint64
+}
+
+// NewSampleRing returns an empty ring using buf as its storage
+func NewSampleRing(buf []PackedSample) (*SampleRing, error) {
+	if len(buf) == 0 {
+		return nil, errors.New("sample ring needs a non empty buffer")
+	}
+	return &SampleRing{buf: buf}, nil
+}
+
+// Len returns the number of samples in the ring
+func (r *SampleRing) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.n
+}
+
+// Cap returns the number of samples the ring can hold
+func (r *SampleRing) Cap() int {
+	return len(r.buf)
+}
+
+// Overwritten returns how many samples were overwritten before being drained
+func (r *SampleRing) Overwritten() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.overwritten
+}
+
+// At returns the i-th oldest sample in the ring
+func (r *SampleRing) At(i int) PackedSample {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if i < 0 || i >= r.n {
+		panic(fmt.Sprintf("sample ring index %d out of range [0, %d)", i, r.n))
+	}
+	return r.buf[(r.start+i)%len(r.buf)]
+}
+
+// Drain moves the oldest samples of the ring into dst and returns how many were moved
+func (r *SampleRing) Drain(dst []PackedSample) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k := 0
+	for k < len(dst) && r.n > 0 {
+		dst[k] = r.buf[r.start]
+		r.start = (r.start + 1) % len(r.buf)
+		r.n--
+		k++
+	}
+	return k
+}
+
+// Reset empties the ring
+func (r *SampleRing) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.start = 0
+	r.n = 0
+	r.overwritten = 0
+}
+
+func (r *SampleRing) push(s PackedSample) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.n == len(r.buf) {
+		r.buf[r.start] = s
+		r.start = (r.start + 1) % len(r.buf)
+		r.overwritten++
+		return
+	}
+	r.buf[(r.start+r.n)%len(r.buf)] = s
+	r.n++
+}
+
+// SamplePacked reads all pins once into smp without allocating. The sampler can have at most 64 pins
+func (s *Sampler) SamplePacked(smp *PackedSample) error {
+	if len(s.pins) > 64 {
+		return fmt.Errorf("too many pins for a packed sample: %d", len(s.pins))
+	}
+	var bits uint64
+	start := time.Now()
+	for i, p := range s.pins {
+		v, err := readPin(p)
+		if err != nil {
+			return fmt.Errorf("failed to sample gpio %d: %s", p.Number, err)
+		}
+		bits |= uint64(v) << uint(i)
+	}
+	smp.Skew = time.Since(start)
+	smp.Time = start.Add(smp.Skew / 2).UnixNano()
+	smp.Bits = bits
+	return nil
+}
+
+// CaptureRing samples the pins every interval into r until stop is closed or a read fails.
+// Samples are scheduled like with Capture, and no memory is allocated per sample.
+func (s *Sampler) CaptureRing(r *SampleRing, interval time.Duration, stop <-chan struct{}) error {
+	if interval <= 0 {
+		return fmt.Errorf("invalid sample interval %s", interval)
+	}
+	var smp PackedSample
+	start := time.Now()
+	for i := int64(0); ; i++ {
+		select {
+		case <-stop:
+			return nil
+		default:
+		}
+		sleepUntil(start.Add(time.Duration(i) * interval))
+		if err := s.SamplePacked(&smp); err != nil {
+			return err
+		}
+		r.push(smp)
+	}
+}
@@ -0,0 +1,208 @@
+package gpio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+)
+
+// Rule describes a piece of input to output logic evaluated by a RuleEngine.
+// When any of Inputs sees Edge, Value is written to Output.
+// If For is non zero, Output is set back to the opposite value once For has elapsed
+// without the rule firing again.
+type Rule struct {
+	Inputs []string
+	Edge   Edge
+	Output string
+	Value  uint
+	For    time.Duration
+}
+
+// ruleConfig is a Rule as written in a rules file
+type ruleConfig struct {
+	Inputs []string `json:"inputs"`
+	Edge   string   `json:"edge"`
+	Output string   `json:"output"`
+	Value  uint     `json:"value"`
+	For    string   `json:"for,omitempty"`
+}
+
+// LoadRules reads rules from a JSON file holding a list of rules, whose edges are "rising",
+// "falling" or "both" and whose hold times are parsed with time.ParseDuration:
+//
+//	[{"inputs": ["bumper_left", "bumper_right"], "edge": "rising", "output": "brake", "value": 1, "for": "500ms"}]
+func LoadRules(path string) ([]Rule, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules: %s", err)
+	}
+	var configs []ruleConfig
+	if err := json.Unmarshal(b, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse rules %s: %s", path, err)
+	}
+	rules := make([]Rule, len(configs))
+	for i, c := range configs {
+		r := Rule{Inputs: c.Inputs, Output: c.Output, Value: c.Value}
+		switch c.Edge {
+		case "rising":
+			r.Edge = EdgeRising
+		case "falling":
+			r.Edge = EdgeFalling
+		case "both":
+			r.Edge = EdgeBoth
+		default:
+			return nil, fmt.Errorf("rule %d in %s has unknown edge %q", i, path, c.Edge)
+		}
+		if c.For != "" {
+			if r.For, err = time.ParseDuration(c.For); err != nil {
+				return nil, fmt.Errorf("rule %d in %s has invalid hold time: %s", i, path, err)
+			}
+		}
+		rules[i] = r
+	}
+	return rules, nil
+}
+
+// RuleEngine evaluates a set of Rules against the pins of a Manager
+type RuleEngine struct {
+	m       *Manager
+	rules   []Rule
+	watcher *Watcher
+	byPin   map[uint][]int
+	last    map[uint]uint
+
+	mu      sync.Mutex
+	timers  map[int]*time.Timer
+	actions sync.WaitGroup
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewRuleEngine validates rules against the pins registered in m
+// and starts evaluating them. Inputs and outputs are referred to by their names in m.
+func NewRuleEngine(m *Manager, rules ...Rule) (*RuleEngine, error) {
+	e := &RuleEngine{
+		m:       m,
+		rules:   rules,
+		byPin:   make(map[uint][]int),
+		last:    make(map[uint]uint),
+		timers:  make(map[int]*time.Timer),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	for i, r := range rules {
+		if r.Edge == EdgeNone {
+			return nil, fmt.Errorf("rule %d has no edge", i)
+		}
+		if r.Value > 1 {
+			return nil, fmt.Errorf("rule %d has invalid output value %d", i, r.Value)
+		}
+		out, ok := m.Pin(r.Output)
+		if !ok {
+			return nil, fmt.Errorf("rule %d refers to unknown output %q", i, r.Output)
+		}
+		if out.dir() != DirectionOut {
+			return nil, fmt.Errorf("rule %d output %q is not configured for output", i, r.Output)
+		}
+		for _, name := range r.Inputs {
+			in, ok := m.Pin(name)
+			if !ok {
+				return nil, fmt.Errorf("rule %d refers to unknown input %q", i, name)
+			}
+			e.byPin[in.Number] = append(e.byPin[in.Number], i)
+		}
+	}
+
+	e.watcher = NewWatcher()
+	var pins []uint
+	for p := range e.byPin {
+		pins = append(pins, p)
+		if err := e.watcher.AddPin(p); err != nil {
+			e.watcher.Close()
+			return nil, fmt.Errorf("failed to watch rule input: %s", err)
+		}
+	}
+	spawn("RuleEngine", pins, e.run)
+	return e, nil
+}
+
+func (e *RuleEngine) run() {
+	defer close(e.stopped)
+	for {
+		select {
+		case n := <-e.watcher.Notification:
+			e.handle(n)
+		case <-e.done:
+			return
+		}
+	}
+}
+
+func (e *RuleEngine) handle(n WatcherNotification) {
+	prev, seen := e.last[n.Pin]
+	e.last[n.Pin] = n.Value
+	// the first notification only reports the initial value
+	if !seen {
+		return
+	}
+	for _, i := range e.byPin[n.Pin] {
+		if edgeMatches(e.rules[i].Edge, prev, n.Value) {
+			e.fire(i)
+		}
+	}
+}
+
+func (e *RuleEngine) fire(i int) {
+	r := e.rules[i]
+	out, ok := e.m.Pin(r.Output)
+	if !ok {
+		return
+	}
+	Write(out, r.Value)
+	if r.For == 0 {
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if t, ok := e.timers[i]; ok && t.Stop() {
+		t.Reset(r.For)
+		return
+	}
+	// a timer which fired already is replaced, and skips its write
+	e.actions.Add(1)
+	var t *time.Timer
+	t = time.AfterFunc(r.For, func() {
+		defer e.actions.Done()
+		e.mu.Lock()
+		current := e.timers[i] == t
+		if current {
+			delete(e.timers, i)
+		}
+		e.mu.Unlock()
+		if current {
+			Write(out, 1-r.Value)
+		}
+	})
+	e.timers[i] = t
+}
+
+// Close stops evaluating rules, cancels the pending reverts and waits for the engine's
+// goroutines and the writes in progress to finish. Outputs are left in their current state
+func (e *RuleEngine) Close() error {
+	close(e.done)
+	<-e.stopped
+	err := e.watcher.Shutdown()
+	e.mu.Lock()
+	for i, t := range e.timers {
+		if t.Stop() {
+			e.actions.Done()
+		}
+		delete(e.timers, i)
+	}
+	e.mu.Unlock()
+	e.actions.Wait()
+	return err
+}
@@ -0,0 +1,66 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Sample holds the values of a set of pins read together.
+// Values are in the order the pins were given to NewSampler.
+// Time is the midpoint of the reads and Skew is the time it took to read all pins.
+type Sample struct {
+	Time   time.Time
+	Skew   time.Duration
+	Values []uint
+}
+
+// Sampler reads a fixed set of input pins as close to simultaneously as possible
+type Sampler struct {
+	pins []Pin
+}
+
+// NewSampler creates a Sampler for the given input pins
+func NewSampler(pins ...Pin) (*Sampler, error) {
+	if len(pins) == 0 {
+		return nil, errors.New("sampler needs at least one pin")
+	}
+	if err := checkDirection(DirectionIn, pins...); err != nil {
+		return nil, err
+	}
+	return &Sampler{pins: pins}, nil
+}
+
+// Len returns the number of pins read by each sample
+func (s *Sampler) Len() int {
+	return len(s.pins)
+}
+
+// Sample reads all pins once
+func (s *Sampler) Sample() (Sample, error) {
+	smp := Sample{
+		Values: make([]uint, len(s.pins)),
+	}
+	err := s.SampleInto(&smp)
+	return smp, err
+}
+
+// SampleInto reads all pins once into smp, reusing smp.Values when it is large enough
+func (s *Sampler) SampleInto(smp *Sample) error {
+	if cap(smp.Values) < len(s.pins) {
+		smp.Values = make([]uint, len(s.pins))
+	}
+	smp.Values = smp.Values[:len(s.pins)]
+
+	start := time.Now()
+	for i, p := range s.pins {
+		v, err := readPin(p)
+		if err != nil {
+			return fmt.Errorf("failed to sample gpio %d: %s", p.Number, err)
+		}
+		smp.Values[i] = v
+	}
+	smp.Skew = time.Since(start)
+	smp.Time = start.Add(smp.Skew / 2)
+	return nil
+}
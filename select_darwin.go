@@ -4,10 +4,24 @@ import (
 	"syscall"
 )
 
+// doSelect calls select, again when a signal interrupts it, such as the SIGCHLD of a hook
+// command or the SIGPROF of the profiler
 func doSelect(nfd int, r *syscall.FdSet, w *syscall.FdSet, e *syscall.FdSet, timeout *syscall.Timeval) (changed bool, err error) {
-	err = syscall.Select(nfd, r, w, e, timeout)
-	if err != nil {
-		return false, err
+	sets := selectSets(r, w, e)
+	for {
+		err = syscall.Select(nfd, r, w, e, timeout)
+		if err == syscall.EINTR {
+			sets.restore(r, w, e)
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		return true, nil
 	}
-	return true, nil
+}
+
+// dupFd makes newfd refer to the open file of oldfd
+func dupFd(oldfd int, newfd int) error {
+	return syscall.Dup2(oldfd, newfd)
 }
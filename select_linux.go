@@ -4,13 +4,27 @@ import (
 	"syscall"
 )
 
+// doSelect calls select, again when a signal interrupts it, such as the SIGCHLD of a hook
+// command or the SIGPROF of the profiler. Linux updates timeout to the time left.
 func doSelect(nfd int, r *syscall.FdSet, w *syscall.FdSet, e *syscall.FdSet, timeout *syscall.Timeval) (changed bool, err error) {
-	n, err := syscall.Select(nfd, r, w, e, timeout)
-	if err != nil {
-		return false, err
+	sets := selectSets(r, w, e)
+	for {
+		n, err := syscall.Select(nfd, r, w, e, timeout)
+		if err == syscall.EINTR {
+			sets.restore(r, w, e)
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if n != 0 {
+			return true, nil
+		}
+		return false, nil
 	}
-	if n != 0 {
-		return true, nil
-	}
-	return false, nil
+}
+
+// dupFd makes newfd refer to the open file of oldfd
+func dupFd(oldfd int, newfd int) error {
+	return syscall.Dup3(oldfd, newfd, syscall.O_CLOEXEC)
 }
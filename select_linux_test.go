@@ -0,0 +1,90 @@
+package gpio
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// A select interrupted by a signal keeps waiting for the rest of its timeout
+func TestSelectRetriesInterrupted(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	const timeout = 300 * time.Millisecond
+	tids := make(chan int)
+	type result struct {
+		changed bool
+		err     error
+		took    time.Duration
+	}
+	results := make(chan result)
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		tids <- syscall.Gettid()
+		fd := r.Fd()
+		rfds := fdHeap{fd}.FdSet()
+		timeval := syscall.NsecToTimeval(int64(timeout))
+		start := time.Now()
+		changed, err := doSelect(int(fd)+1, rfds, nil, nil, &timeval)
+		results <- result{changed, err, time.Since(start)}
+	}()
+	tid := <-tids
+	for i := 0; i < 5; i++ {
+		time.Sleep(20 * time.Millisecond)
+		// SIGCHLD is caught and ignored by the runtime, like the exit of a hook command
+		syscall.Tgkill(os.Getpid(), tid, syscall.SIGCHLD)
+	}
+	res := <-results
+	if res.err != nil {
+		t.Fatalf("interrupted select failed: %s", res.err)
+	}
+	if res.changed {
+		t.Fatal("interrupted select reported a ready fd")
+	}
+	if res.took < timeout-10*time.Millisecond {
+		t.Fatalf("interrupted select returned after %s of %s", res.took, timeout)
+	}
+}
+
+// The edge waits of the long running helpers outlast signals too
+func TestWaitForEdgeRetriesInterrupted(t *testing.T) {
+	m := NewMock()
+	SetMock(m)
+	defer SetMock(nil)
+	p, err := NewPin(5, WithEdge(EdgeBoth))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if _, err := readPin(p); err != nil {
+		t.Fatal(err)
+	}
+	tids := make(chan int)
+	errs := make(chan error)
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		tids <- syscall.Gettid()
+		changed, err := waitForEdge(p, time.Second)
+		if err == nil && !changed {
+			err = ErrTimeout
+		}
+		errs <- err
+	}()
+	tid := <-tids
+	for i := 0; i < 5; i++ {
+		time.Sleep(20 * time.Millisecond)
+		syscall.Tgkill(os.Getpid(), tid, syscall.SIGCHLD)
+	}
+	m.SetInput(5, 1)
+	if err := <-errs; err != nil {
+		t.Fatalf("interrupted edge wait failed: %s", err)
+	}
+}
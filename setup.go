@@ -0,0 +1,69 @@
+package gpio
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// SetupStats describes how opening a pin went.
+// Op names the constructor, Retries is the total number of retries over all setup steps
+// and Duration is the time from the start of the constructor until it returned.
+type SetupStats struct {
+	Op       string
+	Pin      uint
+	Retries  int
+	Duration time.Duration
+	Err      error
+}
+
+// SetupHook is called once every time a pin constructor returns
+type SetupHook func(SetupStats)
+
+var (
+	setupMu   sync.RWMutex
+	setupHook SetupHook
+)
+
+// SetSetupHook installs a hook which receives SetupStats for every pin constructor call.
+// Passing nil disables it.
+func SetSetupHook(h SetupHook) {
+	setupMu.Lock()
+	setupHook = h
+	setupMu.Unlock()
+}
+
+type setupTracker struct {
+	ctx   context.Context
+	stats SetupStats
+	start time.Time
+}
+
+func startSetup(ctx context.Context, op string, p uint) *setupTracker {
+	return &setupTracker{
+		ctx: ctx,
+		stats: SetupStats{
+			Op:  op,
+			Pin: p,
+		},
+		start: time.Now(),
+	}
+}
+
+func (t *setupTracker) retry(retryN int, retryDuration time.Duration, fn func() error) error {
+	retries, err := retry(t.ctx, retryN, retryDuration, fn)
+	t.stats.Retries += retries
+	return err
+}
+
+func (t *setupTracker) done(err error) {
+	setupMu.RLock()
+	h := setupHook
+	setupMu.RUnlock()
+	if h == nil {
+		return
+	}
+	t.stats.Duration = time.Since(t.start)
+	t.stats.Err = err
+	h(t.stats)
+}
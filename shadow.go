@@ -0,0 +1,150 @@
+package gpio
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// Divergence is a period during which the value written by the shadow source of a
+// ShadowOutput differed from the primary's. Ongoing is true when it hasn't ended yet,
+// in which case Duration is how long it has lasted so far.
+type Divergence struct {
+	Pin      uint
+	Primary  uint
+	Shadow   uint
+	Start    time.Time
+	Duration time.Duration
+	Ongoing  bool
+}
+
+// maxDivergences is how many of the last divergences a ShadowOutput keeps
+const maxDivergences = 256
+
+// ShadowOutput runs a rewritten controller in the shadow of the one it replaces on the same
+// output: only the writes of the primary source are applied, and periods during which the
+// shadow source wants another value are recorded as divergences. Since two controllers never
+// write at exactly the same time, disagreements shorter than the tolerance are ignored.
+type ShadowOutput struct {
+	pin       Pin
+	tolerance time.Duration
+
+	mu       sync.Mutex
+	primary  uint
+	shadow   uint
+	pValid   bool
+	sValid   bool
+	diverged time.Time
+	// dPrimary and dShadow are the values when the ongoing divergence started
+	dPrimary    uint
+	dShadow     uint
+	divergences []Divergence
+	total       int
+}
+
+// NewShadowOutput creates a ShadowOutput on an output pin
+func NewShadowOutput(p Pin, tolerance time.Duration) (*ShadowOutput, error) {
+	if p.dir() != DirectionOut {
+		return nil, errWrongDirection(p, DirectionOut)
+	}
+	if tolerance < 0 {
+		return nil, errors.New("shadow tolerance can't be negative")
+	}
+	return &ShadowOutput{pin: p, tolerance: tolerance}, nil
+}
+
+// shadowSource is one of the write sources of a ShadowOutput
+type shadowSource struct {
+	s       *ShadowOutput
+	primary bool
+}
+
+// Primary returns the source whose writes are applied to the pin
+func (s *ShadowOutput) Primary() Writer {
+	return shadowSource{s: s, primary: true}
+}
+
+// Shadow returns the source whose writes are only compared with the primary's
+func (s *ShadowOutput) Shadow() Writer {
+	return shadowSource{s: s}
+}
+
+func (w shadowSource) High() error {
+	return w.s.write(w.primary, 1)
+}
+
+func (w shadowSource) Low() error {
+	return w.s.write(w.primary, 0)
+}
+
+func (s *ShadowOutput) write(primary bool, v uint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if primary {
+		if err := Write(s.pin, v); err != nil {
+			return err
+		}
+		s.primary, s.pValid = v, true
+	} else {
+		s.shadow, s.sValid = v, true
+	}
+	s.compare(time.Now())
+	return nil
+}
+
+// compare starts or ends a divergence after a write
+func (s *ShadowOutput) compare(now time.Time) {
+	if !s.pValid || !s.sValid {
+		return
+	}
+	if s.primary != s.shadow {
+		if s.diverged.IsZero() {
+			s.diverged = now
+			s.dPrimary, s.dShadow = s.primary, s.shadow
+		}
+		return
+	}
+	if s.diverged.IsZero() {
+		return
+	}
+	if d := now.Sub(s.diverged); d > s.tolerance {
+		s.total++
+		if len(s.divergences) == maxDivergences {
+			s.divergences = append(s.divergences[:0], s.divergences[1:]...)
+		}
+		s.divergences = append(s.divergences, s.divergence(d, false))
+	}
+	s.diverged = time.Time{}
+}
+
+func (s *ShadowOutput) divergence(d time.Duration, ongoing bool) Divergence {
+	return Divergence{
+		Pin:      s.pin.Number,
+		Primary:  s.dPrimary,
+		Shadow:   s.dShadow,
+		Start:    s.diverged,
+		Duration: d,
+		Ongoing:  ongoing,
+	}
+}
+
+// Divergences returns the last divergences, oldest first, followed by the ongoing one if it
+// already lasted longer than the tolerance
+func (s *ShadowOutput) Divergences() []Divergence {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	divergences := append([]Divergence(nil), s.divergences...)
+	if !s.diverged.IsZero() {
+		if d := time.Since(s.diverged); d > s.tolerance {
+			divergences = append(divergences, s.divergence(d, true))
+		}
+	}
+	return divergences
+}
+
+// Total returns the number of divergences which ended, including those no longer kept
+func (s *ShadowOutput) Total() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.total
+}
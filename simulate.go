@@ -0,0 +1,170 @@
+package gpio
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// simSub is told about the simulated value changes of an input
+type simSub struct {
+	pin Pin
+	// fn receives the changes of the value read on pin, and whether the new one is simulated
+	fn func(prev uint, cur uint, simulated bool)
+}
+
+var (
+	simMu   sync.Mutex
+	sims    = make(map[uint]uint)
+	simSubs = make(map[*simSub]struct{})
+)
+
+// SimulateInput makes every reading of input pin return v instead of its physical level,
+// until ClearSimulation is called, e.g. to exercise the logic downstream of a sensor on a
+// deployed unit. Watchers and PinWatches deliver the simulated changes right away, flagged
+// as Simulated, as are the hooks and journal entries they cause. Outputs aren't affected.
+func SimulateInput(pin uint, v uint) error {
+	if v != 0 && v != 1 {
+		return errInvalidValue(pin, v)
+	}
+	simMu.Lock()
+	prev, was := sims[pin]
+	sims[pin] = v
+	subs := simSubsOf(pin)
+	simMu.Unlock()
+	logger().Warn("simulating input", "pin", pin, "value", v)
+	for _, s := range subs {
+		s.changed(prev, was, v, true)
+	}
+	return nil
+}
+
+// ClearSimulation makes the readings of pin return its physical level again
+func ClearSimulation(pin uint) {
+	simMu.Lock()
+	prev, was := sims[pin]
+	delete(sims, pin)
+	subs := simSubsOf(pin)
+	simMu.Unlock()
+	if !was {
+		return
+	}
+	logger().Warn("stopped simulating input", "pin", pin)
+	for _, s := range subs {
+		s.changed(prev, true, 0, false)
+	}
+}
+
+// SimulatedInputs returns the simulated values by pin number
+func SimulatedInputs() map[uint]uint {
+	simMu.Lock()
+	defer simMu.Unlock()
+	m := make(map[uint]uint, len(sims))
+	for pin, v := range sims {
+		m[pin] = v
+	}
+	return m
+}
+
+// simulatedInput returns the value simulated for pin, if any
+func simulatedInput(pin uint) (uint, bool) {
+	simMu.Lock()
+	defer simMu.Unlock()
+	v, ok := sims[pin]
+	return v, ok
+}
+
+// simSubsOf returns the subscriptions to pin, simMu must be held
+func simSubsOf(pin uint) []*simSub {
+	var subs []*simSub
+	for s := range simSubs {
+		if s.pin.Number == pin {
+			subs = append(subs, s)
+		}
+	}
+	return subs
+}
+
+// subscribeSim calls fn with the value changes of p caused by starting or clearing a simulation
+func subscribeSim(p Pin, fn func(prev uint, cur uint, simulated bool)) *simSub {
+	s := &simSub{pin: p, fn: fn}
+	simMu.Lock()
+	simSubs[s] = struct{}{}
+	simMu.Unlock()
+	return s
+}
+
+func (s *simSub) unsubscribe() {
+	simMu.Lock()
+	delete(simSubs, s)
+	simMu.Unlock()
+}
+
+// changed calls fn if the simulation changed the value read on the pin. The physical level
+// stands in for the simulated value before a simulation starts and after it is cleared.
+func (s *simSub) changed(prev uint, wasSimulated bool, cur uint, simulated bool) {
+	if !wasSimulated || !simulated {
+		v, err := readPhysical(s.pin)
+		if err != nil {
+			logger().Error("failed to read simulated input", "pin", s.pin.Number, "err", err)
+			return
+		}
+		if !wasSimulated {
+			prev = v
+		}
+		if !simulated {
+			cur = v
+		}
+	}
+	if prev != cur {
+		s.fn(prev, cur, simulated)
+	}
+}
+
+// SimulationHandler lets a remote operator simulate inputs, see SimulateInput:
+//
+//	GET    /       the simulated values by pin number
+//	PUT    /{pin}  {"value": 1} simulates a value
+//	DELETE /{pin}  clears the simulation
+//
+// Access control is left to the application, e.g. by wrapping the handler.
+func SimulationHandler() http.Handler {
+	return http.HandlerFunc(serveSimulation)
+}
+
+func serveSimulation(w http.ResponseWriter, r *http.Request) {
+	path := strings.Trim(r.URL.Path, "/")
+	if path == "" && r.Method == http.MethodGet {
+		sims := make(map[string]uint)
+		for pin, v := range SimulatedInputs() {
+			sims[strconv.Itoa(int(pin))] = v
+		}
+		writeJSON(w, http.StatusOK, sims)
+		return
+	}
+	pin, err := strconv.ParseUint(path, 10, 32)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	switch r.Method {
+	case http.MethodPut:
+		var req valueBody
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Value == nil {
+			http.Error(w, "expected a value", http.StatusBadRequest)
+			return
+		}
+		if err := SimulateInput(uint(pin), *req.Value); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		ClearSimulation(uint(pin))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,234 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// PWMPolarity selects whether the duty is the high (normal) or the low (inversed) part of a period
+type PWMPolarity uint
+
+const (
+	PolarityNormal PWMPolarity = iota
+	PolarityInversed
+)
+
+// PWMAlignment selects where the active part of a period sits
+type PWMAlignment uint
+
+const (
+	// AlignEdge starts the active part at the beginning of the period
+	AlignEdge PWMAlignment = iota
+	// AlignCenter centers the active part in the period
+	AlignCenter
+)
+
+// pwmEdge is a write made at a fixed offset into every PWM period
+type pwmEdge struct {
+	at    time.Duration
+	pin   int
+	value uint
+}
+
+// SoftPWM generates a PWM signal on one or two output pins from a goroutine.
+// Timing is best effort, see PulseTrain; periods much shorter than a millisecond
+// are not practical through sysfs.
+type SoftPWM struct {
+	pins     []Pin
+	period   time.Duration
+	deadTime time.Duration
+
+	mu        sync.Mutex
+	duty      time.Duration
+	polarity  PWMPolarity
+	alignment PWMAlignment
+
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// NewSoftPWM starts a software PWM with the given period on an output pin.
+// The duty starts at 0, so the pin stays low until SetDuty is called.
+func NewSoftPWM(p Pin, period time.Duration) (*SoftPWM, error) {
+	return newSoftPWM([]Pin{p}, period, 0)
+}
+
+// NewComplementaryPWM starts a software PWM on p and its complement on n, for driving
+// half-bridges. After p goes low, n goes high only once deadTime has elapsed, and n goes low
+// deadTime before p rises again, so both are never high at the same time.
+// The duty of p is limited to period-2*deadTime.
+func NewComplementaryPWM(p Pin, n Pin, period time.Duration, deadTime time.Duration) (*SoftPWM, error) {
+	if deadTime <= 0 {
+		return nil, errors.New("complementary pwm needs a positive dead time")
+	}
+	if 2*deadTime >= period {
+		return nil, fmt.Errorf("dead time %s is too long for period %s", deadTime, period)
+	}
+	return newSoftPWM([]Pin{p, n}, period, deadTime)
+}
+
+func newSoftPWM(pins []Pin, period time.Duration, deadTime time.Duration) (*SoftPWM, error) {
+	if period <= 0 {
+		return nil, fmt.Errorf("invalid pwm period %s", period)
+	}
+	if err := checkDirection(DirectionOut, pins...); err != nil {
+		return nil, err
+	}
+	s := &SoftPWM{
+		pins:     pins,
+		period:   period,
+		deadTime: deadTime,
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	spawn("SoftPWM", pinNumbers(pins), s.run)
+	return s, nil
+}
+
+// Period returns the PWM period
+func (s *SoftPWM) Period() time.Duration {
+	return s.period
+}
+
+// SetDuty sets how long the (first) pin is high in every period, starting with the next period
+func (s *SoftPWM) SetDuty(duty time.Duration) error {
+	max := s.period - 2*s.deadTime
+	if duty < 0 || duty > max {
+		return fmt.Errorf("invalid pwm duty %s, must be between 0 and %s", duty, max)
+	}
+	s.mu.Lock()
+	s.duty = duty
+	s.mu.Unlock()
+	return nil
+}
+
+// SetDutyCycle sets the duty as a fraction of the period between 0 and 1
+func (s *SoftPWM) SetDutyCycle(fraction float64) error {
+	if fraction < 0 || fraction > 1 {
+		return fmt.Errorf("invalid pwm duty cycle %f", fraction)
+	}
+	return s.SetDuty(time.Duration(fraction * float64(s.period)))
+}
+
+// SetPolarity inverts the signal on all pins of the PWM when set to PolarityInversed,
+// starting with the next period
+func (s *SoftPWM) SetPolarity(polarity PWMPolarity) error {
+	if polarity != PolarityNormal && polarity != PolarityInversed {
+		return fmt.Errorf("invalid pwm polarity %d", polarity)
+	}
+	s.mu.Lock()
+	s.polarity = polarity
+	s.mu.Unlock()
+	return nil
+}
+
+// SetAlignment selects edge or center aligned PWM, starting with the next period.
+// With a complementary pair the dead time is kept on both sides of the active part.
+func (s *SoftPWM) SetAlignment(alignment PWMAlignment) error {
+	if alignment != AlignEdge && alignment != AlignCenter {
+		return fmt.Errorf("invalid pwm alignment %d", alignment)
+	}
+	s.mu.Lock()
+	s.alignment = alignment
+	s.mu.Unlock()
+	return nil
+}
+
+// Duty returns the current duty
+func (s *SoftPWM) Duty() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.duty
+}
+
+// edges returns the active levels to write during one period, in order
+func (s *SoftPWM) edges(duty time.Duration, alignment PWMAlignment) []pwmEdge {
+	rise := time.Duration(0)
+	if alignment == AlignCenter {
+		rise = (s.period - duty) / 2
+	}
+	fall := rise + duty
+
+	var edges []pwmEdge
+	switch {
+	case duty == 0:
+		edges = append(edges, pwmEdge{0, 0, 0})
+	case duty == s.period:
+		edges = append(edges, pwmEdge{0, 0, 1})
+	case rise == 0:
+		edges = append(edges, pwmEdge{0, 0, 1}, pwmEdge{fall, 0, 0})
+	default:
+		edges = append(edges, pwmEdge{0, 0, 0}, pwmEdge{rise, 0, 1}, pwmEdge{fall, 0, 0})
+	}
+
+	if len(s.pins) == 2 {
+		switch {
+		case alignment == AlignCenter && duty == 0:
+			edges = append(edges, pwmEdge{0, 1, 1})
+		case alignment == AlignCenter:
+			// the complement is high around the period boundary
+			edges = append(edges,
+				pwmEdge{0, 1, 1},
+				pwmEdge{rise - s.deadTime, 1, 0},
+				pwmEdge{fall + s.deadTime, 1, 1})
+		case fall+s.deadTime < s.period-s.deadTime:
+			edges = append(edges,
+				pwmEdge{fall + s.deadTime, 1, 1},
+				pwmEdge{s.period - s.deadTime, 1, 0})
+		default:
+			edges = append(edges, pwmEdge{0, 1, 0})
+		}
+	}
+	sort.SliceStable(edges, func(i, j int) bool { return edges[i].at < edges[j].at })
+	return edges
+}
+
+func (s *SoftPWM) run() {
+	defer close(s.stopped)
+	start := time.Now()
+	for i := 0; ; i++ {
+		s.mu.Lock()
+		edges := s.edges(s.duty, s.alignment)
+		inverted := s.polarity == PolarityInversed
+		s.mu.Unlock()
+
+		periodStart := start.Add(time.Duration(i) * s.period)
+		for _, e := range edges {
+			select {
+			case <-s.stop:
+				return
+			default:
+			}
+			sleepUntil(periodStart.Add(e.at))
+			v := e.value
+			if inverted {
+				v = 1 - v
+			}
+			writePin(s.pins[e.pin], v)
+		}
+		sleepUntil(periodStart.Add(s.period))
+	}
+}
+
+// Close stops the PWM and drives its pins inactive, which is low unless the polarity
+// is inversed. The pins themselves are left open
+func (s *SoftPWM) Close() error {
+	close(s.stop)
+	<-s.stopped
+	idle := uint(0)
+	s.mu.Lock()
+	if s.polarity == PolarityInversed {
+		idle = 1
+	}
+	s.mu.Unlock()
+	var err error
+	for _, p := range s.pins {
+		if werr := writePin(p, idle); werr != nil && err == nil {
+			err = werr
+		}
+	}
+	return err
+}
@@ -0,0 +1,87 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Strap is a pin read by ReadRevision. Pull is applied before reading where the
+// pinctrl provider supports it, and ignored with a warning otherwise.
+type Strap struct {
+	Number uint
+	Pull   Pull
+}
+
+const strapSettle = time.Millisecond
+
+// ReadRevision reads a set of strap inputs and decodes them into a revision ID,
+// straps[0] being the least significant bit. The straps are read twice and must agree.
+// Pins exported only for reading the straps are unexported again.
+func ReadRevision(straps ...Strap) (uint, error) {
+	if len(straps) == 0 {
+		return 0, errors.New("no strap pins given")
+	}
+	pins := make([]Pin, 0, len(straps))
+	defer func() {
+		for _, p := range pins {
+			p.Cleanup()
+		}
+	}()
+	for _, s := range straps {
+		p, err := NewInput(s.Number)
+		if err != nil {
+			return 0, fmt.Errorf("failed to open strap pin: %s", err)
+		}
+		pins = append(pins, p)
+		if s.Pull != PullNone {
+			err := p.SetPull(s.Pull)
+			if err == ErrNoPinctrl || err == ErrNoPull {
+				// the board's own resistors have to hold the strap
+				logger().Warn("can't apply the pull of strap pin", "pin", s.Number, "err", err)
+			} else if err != nil {
+				return 0, fmt.Errorf("failed to set pull on strap pin %d: %s", s.Number, err)
+			}
+		}
+	}
+	time.Sleep(strapSettle)
+
+	read := func() (uint, error) {
+		rev := uint(0)
+		for i, p := range pins {
+			v, err := p.Read()
+			if err != nil {
+				return 0, fmt.Errorf("failed to read strap pin %d: %s", p.Number, err)
+			}
+			rev |= v << uint(i)
+		}
+		return rev, nil
+	}
+	first, err := read()
+	if err != nil {
+		return 0, err
+	}
+	time.Sleep(strapSettle)
+	second, err := read()
+	if err != nil {
+		return 0, err
+	}
+	if first != second {
+		return 0, fmt.Errorf("strap pins are unstable, read %d then %d", first, second)
+	}
+	return first, nil
+}
+
+// DetectProfile reads the straps and returns the profile name registered for the revision
+// in names, suitable for Profiles.Select. Revisions without a name are returned as "rev-N".
+func DetectProfile(names map[uint]string, straps ...Strap) (string, error) {
+	rev, err := ReadRevision(straps...)
+	if err != nil {
+		return "", err
+	}
+	if name, ok := names[rev]; ok {
+		return name, nil
+	}
+	return "rev-" + strconv.Itoa(int(rev)), nil
+}
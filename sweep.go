@@ -0,0 +1,86 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// SweepScale selects how the frequency of a Sweep moves from its start to its end
+type SweepScale uint
+
+const (
+	// SweepLinear changes the frequency by the same number of Hz per second
+	SweepLinear SweepScale = iota
+	// SweepLog multiplies the frequency by the same factor per second, so that each octave
+	// takes as long
+	SweepLog
+)
+
+// Sweep emits a square wave on an output pin whose frequency sweeps from from to to Hz over
+// duration, e.g. for exciting and characterizing filters, resonators and buzzers. The phase
+// is continuous, and the edges are scheduled against the start of the sweep so that timing
+// errors don't accumulate, like PulseTrain. The pin is left low. Timing is best effort:
+// above a few kHz the writes and wakeups take a large part of each half period, which the
+// returned stats show.
+func (p Pin) Sweep(from float64, to float64, duration time.Duration, scale SweepScale) (JitterStats, error) {
+	if p.dir() != DirectionOut {
+		return JitterStats{}, errWrongDirection(p, DirectionOut)
+	}
+	if from <= 0 || to <= 0 || math.IsInf(from, 0) || math.IsInf(to, 0) {
+		return JitterStats{}, fmt.Errorf("invalid sweep frequencies %f to %f Hz", from, to)
+	}
+	if duration <= 0 {
+		return JitterStats{}, errors.New("sweep duration must be positive")
+	}
+	if scale != SweepLinear && scale != SweepLog {
+		return JitterStats{}, fmt.Errorf("invalid sweep scale %d", scale)
+	}
+
+	var jitter jitterAccumulator
+	total := duration.Seconds()
+	start := time.Now()
+	for m := 0; ; m++ {
+		// edge m is where the phase reaches m half cycles
+		t := sweepTime(from, to, total, scale, float64(m)/2)
+		if t >= total {
+			break
+		}
+		at := start.Add(time.Duration(t * float64(time.Second)))
+		sleepUntil(at)
+		jitter.add(at, time.Now())
+		if err := writePin(p, uint(1-m%2)); err != nil {
+			return jitter.result(), err
+		}
+	}
+	if err := writePin(p, 0); err != nil {
+		return jitter.result(), err
+	}
+	return jitter.result(), nil
+}
+
+// sweepTime returns the time in seconds at which a sweep from f0 to f1 Hz over total seconds
+// reaches the phase given in cycles
+func sweepTime(f0 float64, f1 float64, total float64, scale SweepScale, phase float64) float64 {
+	if f0 == f1 {
+		return phase / f0
+	}
+	if scale == SweepLog {
+		// the phase is f0*total/ln(k)*(k^(t/total)-1) with k = f1/f0
+		lnK := math.Log(f1 / f0)
+		x := 1 + phase*lnK/(f0*total)
+		if x <= 0 {
+			// a falling sweep which never reaches the phase
+			return math.Inf(1)
+		}
+		return total * math.Log(x) / lnK
+	}
+	// the phase is f0*t + a*t^2 with a = (f1-f0)/(2*total)
+	a := (f1 - f0) / (2 * total)
+	d := f0*f0 + 4*a*phase
+	if d < 0 {
+		return math.Inf(1)
+	}
+	return (math.Sqrt(d) - f0) / (2 * a)
+}
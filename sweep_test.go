@@ -0,0 +1,40 @@
+package gpio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSweepTime(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		f0, f1 float64
+		scale  SweepScale
+		phase  float64
+		want   float64
+	}{
+		{"constant", 100, 100, SweepLinear, 50, 0.5},
+		{"linear start", 100, 300, SweepLinear, 0, 0},
+		// over 1s, the phase of a linear sweep is the mean frequency
+		{"linear end", 100, 300, SweepLinear, 200, 1},
+		{"linear falling", 300, 100, SweepLinear, 200, 1},
+		// over 1s from 100Hz to 400Hz, the phase is 300/ln(4) cycles
+		{"log end", 100, 400, SweepLog, 300 / math.Log(4), 1},
+		{"log half", 100, 400, SweepLog, 100 / math.Log(4), 0.5},
+		{"log falling", 400, 100, SweepLog, 300 / math.Log(4), 1},
+	} {
+		if got := sweepTime(c.f0, c.f1, 1, c.scale, c.phase); math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("%s: sweepTime = %f, want %f", c.name, got, c.want)
+		}
+	}
+}
+
+// A falling sweep never reaches the phases beyond those it would reach at 0Hz
+func TestSweepTimeUnreachable(t *testing.T) {
+	if got := sweepTime(300, 100, 1, SweepLinear, 1000); !math.IsInf(got, 1) {
+		t.Errorf("linear sweepTime = %f, want +Inf", got)
+	}
+	if got := sweepTime(400, 100, 1, SweepLog, 1000); !math.IsInf(got, 1) {
+		t.Errorf("log sweepTime = %f, want +Inf", got)
+	}
+}
@@ -3,15 +3,21 @@ package gpio
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
-type direction uint
+// Direction is whether a pin is an input or an output
+type Direction uint
 
 const (
-	inDirection direction = iota
-	outDirection
+	DirectionIn Direction = iota
+	DirectionOut
 )
 
 type Edge uint
@@ -37,50 +43,85 @@ const (
 	Active   Value = 1
 )
 
-func exportGPIO(p Pin) error {
-	if _, err := os.Stat(fmt.Sprintf("/sys/class/gpio/gpio%d", int(p.Number))); err == nil {
-		return nil
+var errShortRead = errors.New("short read from pinfile")
+
+// sysfsRoot is the directory of the gpio class, it can be moved to a fixture with SetSysfsRoot
+var sysfsRoot = "/sys/class/gpio"
+
+func classPath(file string) string {
+	return sysfsRoot + "/" + file
+}
+
+func pinPath(p Pin, attr string) string {
+	return fmt.Sprintf("%s/gpio%d/%s", sysfsRoot, p.Number, attr)
+}
+
+// exportGPIO exports the pin unless it is already exported.
+// It reports whether this call performed the export.
+func exportGPIO(p Pin) (exported bool, err error) {
+	if p.line != nil {
+		// character device lines are requested when they are opened
+		return false, nil
+	}
+	if isExported(p) {
+		return false, nil
 	}
 
-	export, err := os.OpenFile("/sys/class/gpio/export", os.O_WRONLY, 0600)
+	if err := injectFault(FaultExport, p, "export"); err != nil {
+		return false, classFileError(p.Number, err, "failed to write gpio export file: %w")
+	}
+	export, err := os.OpenFile(classPath("export"), os.O_WRONLY, 0600)
 	if err != nil {
-		return fmt.Errorf("failed to open gpio export file for writing: %s", err)
+		return false, classFileError(p.Number, err, "failed to open gpio export file for writing: %w")
 	}
 	defer export.Close()
 	_, err = export.Write([]byte(strconv.Itoa(int(p.Number))))
 	if err != nil {
-		return fmt.Errorf("failed to write gpio export file: %s", err)
+		return false, classFileError(p.Number, err, "failed to write gpio export file: %w")
 	}
-	return nil
+	logger().Debug("exported gpio", "pin", p.Number)
+	return true, nil
 }
 
 func unexportGPIO(p Pin) error {
-	export, err := os.OpenFile("/sys/class/gpio/unexport", os.O_WRONLY, 0600)
+	if p.line != nil {
+		return nil
+	}
+	export, err := os.OpenFile(classPath("unexport"), os.O_WRONLY, 0600)
 	if err != nil {
-		return fmt.Errorf("failed to open gpio unexport file for writing: %s", err)
+		return classFileError(p.Number, err, "failed to open gpio unexport file for writing: %w")
 	}
 	defer export.Close()
 	_, err = export.Write([]byte(strconv.Itoa(int(p.Number))))
 	if err != nil {
-		return fmt.Errorf("failed to write gpio unexport file: %s", err)
+		return classFileError(p.Number, err, "failed to write gpio unexport file: %w")
 	}
+	logger().Debug("unexported gpio", "pin", p.Number)
 	return nil
 }
 
-func setDirection(p Pin, d direction, initialValue uint) error {
-	dir, err := os.OpenFile(fmt.Sprintf("/sys/class/gpio/gpio%d/direction", p.Number), os.O_WRONLY, 0600)
+func setDirection(p Pin, d Direction, initialValue uint) error {
+	if p.line != nil {
+		return reconfigureLine(p, p.line.setDirection(d, initialValue))
+	}
+	if err := injectFault(FaultDirection, p, "direction"); err != nil {
+		return pinFileError(p.Number, err, "failed to open gpio %d direction file for writing: %w", p.Number)
+	}
+	dir, err := os.OpenFile(pinPath(p, "direction"), os.O_WRONLY, 0600)
 	if err != nil {
-		return fmt.Errorf("failed to open gpio %d direction file for writing: %s", p.Number, err)
+		return pinFileError(p.Number, err, "failed to open gpio %d direction file for writing: %w", p.Number)
 	}
 	defer dir.Close()
 
 	switch {
-	case d == inDirection:
+	case d == DirectionIn:
 		_, err = dir.Write([]byte("in"))
-	case d == outDirection && initialValue == 0:
+	case d == DirectionOut && initialValue == 0:
 		_, err = dir.Write([]byte("low"))
-	case d == outDirection && initialValue == 1:
+	case d == DirectionOut && initialValue == 1:
 		_, err = dir.Write([]byte("high"))
+	case d == DirectionOut:
+		return errInvalidValue(p.Number, initialValue)
 	default:
 		return fmt.Errorf("setDirection called with invalid direction or initialValue: %d, %d", d, initialValue)
 	}
@@ -91,9 +132,15 @@ func setDirection(p Pin, d direction, initialValue uint) error {
 }
 
 func setEdgeTrigger(p Pin, e Edge) error {
-	edge, err := os.OpenFile(fmt.Sprintf("/sys/class/gpio/gpio%d/edge", p.Number), os.O_WRONLY, 0600)
+	if p.line != nil {
+		return reconfigureLine(p, p.line.setEdge(e))
+	}
+	if err := injectFault(FaultEdge, p, "edge"); err != nil {
+		return pinFileError(p.Number, err, "failed to open gpio %d edge file for writing: %w", p.Number)
+	}
+	edge, err := os.OpenFile(pinPath(p, "edge"), os.O_WRONLY, 0600)
 	if err != nil {
-		return fmt.Errorf("failed to open gpio %d edge file for writing: %s", p.Number, err)
+		return pinFileError(p.Number, err, "failed to open gpio %d edge file for writing: %w", p.Number)
 	}
 	defer edge.Close()
 
@@ -115,10 +162,28 @@ func setEdgeTrigger(p Pin, e Edge) error {
 	return nil
 }
 
+// setEventClock selects the clock timestamping the edge events of a line
+func setEventClock(p Pin, c EventClock) error {
+	if p.line == nil {
+		return &PinError{
+			Pin:  p.Number,
+			Kind: ErrUnsupported,
+			Err:  fmt.Errorf("gpio %d has no kernel timestamps, they need the character device backend", p.Number),
+		}
+	}
+	return reconfigureLine(p, p.line.setEventClock(c))
+}
+
 func setLogicLevel(p Pin, l LogicLevel) error {
-	level, err := os.OpenFile(fmt.Sprintf("/sys/class/gpio/gpio%d/active_low", p.Number), os.O_WRONLY, 0600)
+	if p.line != nil {
+		return reconfigureLine(p, p.line.setLogicLevel(l))
+	}
+	if err := injectFault(FaultLogicLevel, p, "active_low"); err != nil {
+		return pinFileError(p.Number, err, "failed to open gpio %d active_low file for writing: %w", p.Number)
+	}
+	level, err := os.OpenFile(pinPath(p, "active_low"), os.O_WRONLY, 0600)
 	if err != nil {
-		return fmt.Errorf("failed to open gpio %d active_low file for writing: %s", p.Number, err)
+		return pinFileError(p.Number, err, "failed to open gpio %d active_low file for writing: %w", p.Number)
 	}
 	defer level.Close()
 
@@ -136,27 +201,271 @@ func setLogicLevel(p Pin, l LogicLevel) error {
 	return nil
 }
 
-func openPin(p Pin, write bool) (Pin, error) {
+// reconfigureLine applies a configuration change of a character device line once it is requested
+func reconfigureLine(p Pin, err error) error {
+	if err != nil || p.f == nil {
+		return err
+	}
+	p.lock()
+	defer p.unlock()
+	if err := p.checkOpen(); err != nil {
+		return err
+	}
+	return p.line.reconfigure(p.f)
+}
+
+func isExported(p Pin) bool {
+	if p.line != nil {
+		return false
+	}
+	_, err := os.Stat(fmt.Sprintf("%s/gpio%d", sysfsRoot, p.Number))
+	return err == nil
+}
+
+func readAttr(p Pin, attr string) (string, error) {
+	b, err := ioutil.ReadFile(pinPath(p, attr))
+	if err != nil {
+		return "", pinFileError(p.Number, err, "failed to read gpio %d %s file: %w", p.Number, attr)
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func readDirection(p Pin) (Direction, error) {
+	if p.line != nil {
+		flags, err := p.line.info()
+		return flagsDirection(flags), err
+	}
+	s, err := readAttr(p, "direction")
+	if err != nil {
+		return 0, err
+	}
+	switch s {
+	case "in":
+		return DirectionIn, nil
+	case "out":
+		return DirectionOut, nil
+	default:
+		return 0, fmt.Errorf("read unknown direction %q for gpio %d", s, p.Number)
+	}
+}
+
+func readEdgeTrigger(p Pin) (Edge, error) {
+	if p.line != nil {
+		flags, err := p.line.info()
+		return flagsEdge(flags), err
+	}
+	// the edge file only exists for pins which can generate interrupts
+	if _, err := os.Stat(pinPath(p, "edge")); os.IsNotExist(err) {
+		return EdgeNone, nil
+	}
+	s, err := readAttr(p, "edge")
+	if err != nil {
+		return 0, err
+	}
+	switch s {
+	case "none":
+		return EdgeNone, nil
+	case "rising":
+		return EdgeRising, nil
+	case "falling":
+		return EdgeFalling, nil
+	case "both":
+		return EdgeBoth, nil
+	default:
+		return 0, fmt.Errorf("read unknown edge %q for gpio %d", s, p.Number)
+	}
+}
+
+func readLogicLevel(p Pin) (LogicLevel, error) {
+	if p.line != nil {
+		flags, err := p.line.info()
+		return flagsLogicLevel(flags), err
+	}
+	s, err := readAttr(p, "active_low")
+	if err != nil {
+		return 0, err
+	}
+	switch s {
+	case "0":
+		return ActiveHigh, nil
+	case "1":
+		return ActiveLow, nil
+	default:
+		return 0, fmt.Errorf("read unknown active_low %q for gpio %d", s, p.Number)
+	}
+}
+
+func readValue(p Pin) (uint, error) {
+	if p.line != nil {
+		if p.f == nil {
+			return 0, errNotOpen(p.Number)
+		}
+		p.lock()
+		defer p.unlock()
+		if err := p.checkOpen(); err != nil {
+			return 0, err
+		}
+		return p.line.getValue(p.f)
+	}
+	s, err := readAttr(p, "value")
+	if err != nil {
+		return 0, err
+	}
+	switch s {
+	case "0":
+		return 0, nil
+	case "1":
+		return 1, nil
+	default:
+		return 0, fmt.Errorf("read inconsistent value in pinfile, %s", s)
+	}
+}
+
+// openPin opens the value file of p. On failure p is returned unchanged so that callers can retry
+func openPin(p Pin, dir Direction, exported bool) (Pin, error) {
+	if p.line != nil {
+		f, err := p.line.request()
+		if err != nil {
+			return p, err
+		}
+		p.f = f
+		p.state = &pinState{writable: true, direction: uint32(dir), exported: exported, backend: lineKind(p.line)}
+		return p, nil
+	}
+	write := dir == DirectionOut
 	flags := os.O_RDONLY
 	if write {
 		flags = os.O_RDWR
 	}
-	f, err := os.OpenFile(fmt.Sprintf("/sys/class/gpio/gpio%d/value", p.Number), flags, 0600)
+	if err := injectFault(FaultOpen, p, "value"); err != nil {
+		return p, pinFileError(p.Number, err, "failed to open gpio %d value file for reading: %w", p.Number)
+	}
+	f, err := os.OpenFile(pinPath(p, "value"), flags, 0600)
 	if err != nil {
-		return Pin{}, fmt.Errorf("failed to open gpio %d value file for reading: %s", p.Number, err)
+		return p, pinFileError(p.Number, err, "failed to open gpio %d value file for reading: %w", p.Number)
 	}
 	p.f = f
+	p.state = &pinState{writable: write, direction: uint32(dir), exported: exported, backend: BackendSysfs}
 	return p, nil
 }
 
-func readPin(p Pin) (val uint, err error) {
+// pinState is the state of an open pin shared by its copies
+type pinState struct {
+	// mu serializes the accesses to the file
+	mu     sync.Mutex
+	closed bool
+	// writable is false for sysfs value files opened read only
+	writable bool
+	// events is the stream of Events, stopped on Close
+	events *eventStream
+	// claim is released on Close, see SetClaimDir
+	claim *pinClaim
+	// direction is changed by SetInput and SetOutput, see dir
+	direction uint32
+	// exported is true when this process exported the pin
+	exported bool
+	// backend is the backend the pin was opened with
+	backend Backend
+}
+
+// dir returns the direction of p, which is an input until it is opened
+func (p Pin) dir() Direction {
+	if p.state == nil {
+		return DirectionIn
+	}
+	return Direction(atomic.LoadUint32(&p.state.direction))
+}
+
+// setDir records that p was turned to dir
+func (p Pin) setDir(dir Direction) {
+	atomic.StoreUint32(&p.state.direction, uint32(dir))
+}
+
+// makeWritable reopens the sysfs value file of p for writing in place of the read only one,
+// so that the copies of p keep working. p must be locked.
+func makeWritable(p Pin) error {
+	if p.line != nil || p.state.writable {
+		return nil
+	}
+	f, err := os.OpenFile(pinPath(p, "value"), os.O_RDWR, 0600)
+	if err != nil {
+		return pinFileError(p.Number, err, "failed to open gpio %d value file for writing: %w", p.Number)
+	}
+	defer f.Close()
+	if err := dupFd(int(f.Fd()), int(p.f.Fd())); err != nil {
+		return &PinError{Pin: p.Number, Err: fmt.Errorf("failed to reopen gpio %d value file: %s", p.Number, err)}
+	}
+	p.state.writable = true
+	return nil
+}
+
+// lock serializes the accesses to the file of p with its copies. Pins which were never
+// opened have nothing to serialize.
+func (p Pin) lock() {
+	if p.state != nil {
+		p.state.mu.Lock()
+	}
+}
+
+func (p Pin) unlock() {
+	if p.state != nil {
+		p.state.mu.Unlock()
+	}
+}
+
+// checkOpen returns ErrClosed once p or a copy was closed, it must be called with p locked
+func (p Pin) checkOpen() error {
+	if p.state != nil && p.state.closed {
+		return errClosed(p.Number)
+	}
+	return nil
+}
+
+// readPin reads the value of p, or the value simulated for an input
+func readPin(p Pin) (uint, error) {
+	// the physical read still clears the pending edge of a simulated input
+	v, err := readPhysical(p)
+	if err != nil || p.dir() != DirectionIn {
+		return v, err
+	}
+	if sim, ok := simulatedInput(p.Number); ok {
+		return sim, nil
+	}
+	return v, nil
+}
+
+func readPhysical(p Pin) (val uint, err error) {
+	if err := injectFault(FaultRead, p, "value"); err != nil {
+		if err == errShortRead {
+			return 0, err
+		}
+		return 0, fmt.Errorf("failed to read: %s", err)
+	}
+	p.lock()
+	defer p.unlock()
+	if err := p.checkOpen(); err != nil {
+		return 0, err
+	}
+	if p.line != nil {
+		// the events are read like a sysfs value file clears its pending edge, unless the
+		// event stream of the pin delivers them
+		if p.state == nil || p.state.events == nil {
+			if err := p.line.drain(p.f); err != nil {
+				return 0, err
+			}
+		}
+		return p.line.getValue(p.f)
+	}
 	file := p.f
 	file.Seek(0, 0)
-	buf := make([]byte, 1)
-	_, err = file.Read(buf)
+	var buf [1]byte
+	n, err := file.Read(buf[:])
 	if err != nil {
 		return 0, fmt.Errorf("failed to read: %s", err)
 	}
+	if n == 0 {
+		return 0, errShortRead
+	}
 	c := buf[0]
 	switch c {
 	case '0':
@@ -176,11 +485,107 @@ func writePin(p Pin, v uint) error {
 	case 1:
 		buf = []byte{'1'}
 	default:
-		return fmt.Errorf("invalid output value %d", v)
+		return errInvalidValue(p.Number, v)
 	}
-	_, err := p.f.Write(buf)
-	if err != nil {
+	if p.gate != nil && !p.gate.isArmed() {
+		return ErrNotArmed
+	}
+	if p.dryRun() {
+		dryRunWrite(p, v)
+		return nil
+	}
+	if err := injectFault(FaultWrite, p, "value"); err != nil {
 		return fmt.Errorf("failed to write: %s", err)
 	}
+	p.lock()
+	if err := p.checkOpen(); err != nil {
+		p.unlock()
+		return err
+	}
+	var err error
+	if p.line != nil {
+		err = p.line.setValue(p.f, v)
+	} else if _, err = p.f.Write(buf); err != nil {
+		err = fmt.Errorf("failed to write: %s", err)
+	}
+	p.unlock()
+	if err == nil {
+		watchWrite(p, v)
+	}
+	return err
+}
+
+func wakeupPath(p Pin) string {
+	return pinPath(p, "power/wakeup")
+}
+
+func readWakeup(p Pin) (bool, error) {
+	if p.line != nil {
+		return false, errNeedsSysfs
+	}
+	b, err := ioutil.ReadFile(wakeupPath(p))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, fmt.Errorf("gpio %d doesn't support wakeup", p.Number)
+		}
+		return false, fmt.Errorf("failed to read gpio %d wakeup file: %s", p.Number, err)
+	}
+	switch s := strings.TrimSpace(string(b)); s {
+	case "enabled":
+		return true, nil
+	case "disabled":
+		return false, nil
+	default:
+		return false, fmt.Errorf("read unknown wakeup setting %q for gpio %d", s, p.Number)
+	}
+}
+
+func setWakeup(p Pin, enabled bool) error {
+	if p.line != nil {
+		return errNeedsSysfs
+	}
+	wakeup, err := os.OpenFile(wakeupPath(p), os.O_WRONLY, 0600)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("gpio %d doesn't support wakeup", p.Number)
+		}
+		return pinFileError(p.Number, err, "failed to open gpio %d wakeup file for writing: %w", p.Number)
+	}
+	defer wakeup.Close()
+
+	if enabled {
+		_, err = wakeup.Write([]byte("enabled"))
+	} else {
+		_, err = wakeup.Write([]byte("disabled"))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write gpio wakeup file: %s", err)
+	}
 	return nil
 }
+
+// sysfsChipBase returns the number of the first pin of the chip with the given label and
+// number of lines in the gpio class, of any number of lines if lines is 0
+func sysfsChipBase(label string, lines uint) (uint, error) {
+	chips, _ := filepath.Glob(classPath("gpiochip*"))
+	for _, chip := range chips {
+		l, err := ioutil.ReadFile(chip + "/label")
+		if err != nil || strings.TrimSpace(string(l)) != label {
+			continue
+		}
+		n, err := ioutil.ReadFile(chip + "/ngpio")
+		if lines != 0 && (err != nil || strings.TrimSpace(string(n)) != strconv.Itoa(int(lines))) {
+			continue
+		}
+		base, err := ioutil.ReadFile(chip + "/base")
+		if err != nil {
+			return 0, fmt.Errorf("failed to read the base of gpio chip %s: %s", label, err)
+		}
+		b, err := strconv.Atoi(strings.TrimSpace(string(base)))
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse the base of gpio chip %s: %s", label, err)
+		}
+		return uint(b), nil
+	}
+	return 0, fmt.Errorf("gpio chip %s isn't in %s", label, sysfsRoot)
+}
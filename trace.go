@@ -0,0 +1,214 @@
+package gpio
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Trace is a capture of a set of pins. Names label the pins in the order of the
+// values of each sample, and Start is the time the trace is relative to.
+type Trace struct {
+	Names   []string
+	Start   time.Time
+	Samples []Sample
+}
+
+// Capture takes n samples, one every interval, and returns them as a Trace
+func (s *Sampler) Capture(interval time.Duration, n int) (Trace, error) {
+	if n < 1 {
+		return Trace{}, fmt.Errorf("invalid number of samples %d", n)
+	}
+	t := Trace{
+		Names:   make([]string, len(s.pins)),
+		Samples: make([]Sample, n),
+	}
+	for i, p := range s.pins {
+		t.Names[i] = fmt.Sprintf("gpio%d", p.Number)
+	}
+	start := time.Now()
+	for i := range t.Samples {
+		sleepUntil(start.Add(time.Duration(i) * interval))
+		if err := s.SampleInto(&t.Samples[i]); err != nil {
+			return Trace{}, err
+		}
+	}
+	t.Start = t.Samples[0].Time
+	return t, nil
+}
+
+func (t Trace) offset(smp Sample) string {
+	return strconv.FormatFloat(smp.Time.Sub(t.Start).Seconds(), 'f', 9, 64)
+}
+
+func writeCSVRow(w *csv.Writer, time string, values []uint) error {
+	row := make([]string, 0, len(values)+1)
+	row = append(row, time)
+	for _, v := range values {
+		row = append(row, strconv.Itoa(int(v)))
+	}
+	return w.Write(row)
+}
+
+// WriteSigrokCSV writes the trace in the CSV format imported by sigrok and PulseView:
+// comment lines starting with ';', a header line and one row per sample, the first
+// column being the time in seconds. Import it with the column formats "t,l,l,...".
+func (t Trace) WriteSigrokCSV(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "; CSV, generated by github.com/groove-x/gpio\n")
+	fmt.Fprintf(bw, "; Channels (%d/%d): %s\n", len(t.Names), len(t.Names), strings.Join(t.Names, ", "))
+	cw := csv.NewWriter(bw)
+	if err := cw.Write(append([]string{"time"}, t.Names...)); err != nil {
+		return err
+	}
+	for _, smp := range t.Samples {
+		if err := writeCSVRow(cw, t.offset(smp), smp.Values); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// WriteSaleaeCSV writes the trace in the digital CSV format of Saleae Logic:
+// a "Time [s]" header and one row for the first sample and for every change after it.
+func (t Trace) WriteSaleaeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"Time [s]"}, t.Names...)); err != nil {
+		return err
+	}
+	var last []uint
+	for _, smp := range t.Samples {
+		if last != nil && equalValues(last, smp.Values) {
+			continue
+		}
+		if err := writeCSVRow(cw, t.offset(smp), smp.Values); err != nil {
+			return err
+		}
+		last = smp.Values
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func equalValues(a []uint, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadTraceCSV reads a trace written by WriteSigrokCSV or WriteSaleaeCSV, or exported
+// as CSV by sigrok or Saleae Logic with a time column first.
+// The samples of the returned trace are relative to the zero Start time.
+func ReadTraceCSV(r io.Reader) (Trace, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, ";") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return Trace{}, err
+	}
+	if len(lines) == 0 {
+		return Trace{}, errors.New("empty trace")
+	}
+
+	records, err := csv.NewReader(strings.NewReader(strings.Join(lines, "\n"))).ReadAll()
+	if err != nil {
+		return Trace{}, fmt.Errorf("failed to parse trace: %s", err)
+	}
+	header := records[0]
+	if len(header) < 2 {
+		return Trace{}, errors.New("trace has no channels")
+	}
+	t := Trace{
+		Names:   append([]string(nil), header[1:]...),
+		Samples: make([]Sample, 0, len(records)-1),
+	}
+	for i, rec := range records[1:] {
+		secs, err := strconv.ParseFloat(strings.TrimSpace(rec[0]), 64)
+		if err != nil {
+			return Trace{}, fmt.Errorf("invalid time on line %d: %s", i+2, err)
+		}
+		smp := Sample{
+			Time:   t.Start.Add(time.Duration(secs * float64(time.Second))),
+			Values: make([]uint, len(t.Names)),
+		}
+		for j, field := range rec[1:] {
+			switch strings.TrimSpace(field) {
+			case "0":
+			case "1":
+				smp.Values[j] = 1
+			default:
+				return Trace{}, fmt.Errorf("invalid value %q on line %d", field, i+2)
+			}
+		}
+		t.Samples = append(t.Samples, smp)
+	}
+	return t, nil
+}
+
+// Replay plays the trace back on output pins. outputs maps trace channel names to the
+// pins to drive; channels without a pin are skipped. Time offsets are multiplied by
+// scale, so 2 plays the trace at half speed. Only changes are written, and the first
+// sample sets all pins. The returned stats report how far writes were from their schedule.
+func (t Trace) Replay(outputs map[string]Pin, scale float64) (JitterStats, error) {
+	if scale <= 0 {
+		return JitterStats{}, fmt.Errorf("invalid replay scale %f", scale)
+	}
+	pins := make([]*Pin, len(t.Names))
+	for i, name := range t.Names {
+		p, ok := outputs[name]
+		if !ok {
+			continue
+		}
+		if p.dir() != DirectionOut {
+			return JitterStats{}, errWrongDirection(p, DirectionOut)
+		}
+		pins[i] = &p
+	}
+	if len(t.Samples) == 0 {
+		return JitterStats{}, nil
+	}
+
+	var jitter jitterAccumulator
+	first := t.Samples[0].Time
+	start := time.Now()
+	var last []uint
+	for _, smp := range t.Samples {
+		at := start.Add(time.Duration(float64(smp.Time.Sub(first)) * scale))
+		sleepUntil(at)
+		jitter.add(at, time.Now())
+		for i, p := range pins {
+			if p == nil || i >= len(smp.Values) {
+				continue
+			}
+			if last != nil && last[i] == smp.Values[i] {
+				continue
+			}
+			if err := writePin(*p, smp.Values[i]); err != nil {
+				return jitter.result(), err
+			}
+		}
+		last = smp.Values
+	}
+	return jitter.result(), nil
+}
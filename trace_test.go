@@ -0,0 +1,81 @@
+package gpio
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testTrace() Trace {
+	start := time.Unix(1000, 0)
+	return Trace{
+		Names: []string{"clk", "data"},
+		Start: start,
+		Samples: []Sample{
+			{Time: start, Values: []uint{0, 1}},
+			{Time: start.Add(time.Millisecond), Values: []uint{1, 1}},
+			{Time: start.Add(2 * time.Millisecond), Values: []uint{1, 1}},
+			{Time: start.Add(3 * time.Millisecond), Values: []uint{0, 0}},
+		},
+	}
+}
+
+// offsets returns the samples of t relative to its start, as ReadTraceCSV returns them
+func offsets(t Trace) []Sample {
+	samples := make([]Sample, len(t.Samples))
+	for i, smp := range t.Samples {
+		samples[i] = Sample{Time: time.Time{}.Add(smp.Time.Sub(t.Start)), Values: smp.Values}
+	}
+	return samples
+}
+
+func TestTraceSigrokCSVRoundTrip(t *testing.T) {
+	trace := testTrace()
+	var buf bytes.Buffer
+	if err := trace.WriteSigrokCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadTraceCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Names, trace.Names) {
+		t.Fatalf("names = %v, want %v", got.Names, trace.Names)
+	}
+	if want := offsets(trace); !reflect.DeepEqual(got.Samples, want) {
+		t.Fatalf("samples = %v, want %v", got.Samples, want)
+	}
+}
+
+// The Saleae format only keeps the first sample and the changes
+func TestTraceSaleaeCSVRoundTrip(t *testing.T) {
+	trace := testTrace()
+	var buf bytes.Buffer
+	if err := trace.WriteSaleaeCSV(&buf); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadTraceCSV(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := offsets(trace)
+	want = append(want[:2], want[3])
+	if !reflect.DeepEqual(got.Samples, want) {
+		t.Fatalf("samples = %v, want %v", got.Samples, want)
+	}
+}
+
+func TestReadTraceCSVErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"; only a comment\n",
+		"time\n0,1\n",
+		"time,a\nsoon,1\n",
+		"time,a\n0,2\n",
+	} {
+		if _, err := ReadTraceCSV(bytes.NewBufferString(in)); err == nil {
+			t.Errorf("ReadTraceCSV(%q) didn't fail", in)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package gpio
+
+import (
+	"fmt"
+	"os"
+)
+
+// UnsafePin is direct access to the value of an open pin, for code which measured that the
+// checks of Pin cost too much, such as tight bit banging loops. Each access is a single
+// store on the gpiomem backend and a single ioctl or write otherwise. Nothing is checked:
+// not the direction, the value, whether the pin is still open nor whether a Manager armed
+// it, and nothing is locked, audited, rate limited, dry run, injected or watched.
+// Accessing the pin through an UnsafePin and its Pin at the same time, or after closing the
+// pin, is undefined, e.g. the file of the pin may have been reused by then.
+type UnsafePin struct {
+	Number uint
+	f      *os.File
+	line   lineBackend
+	mem    *memLine
+	flags  uint64
+	bufs   [2][]byte
+	buf    []byte
+}
+
+// Unsafe returns direct access to the value of the pin, see UnsafePin
+func (p Pin) Unsafe() (*UnsafePin, error) {
+	p.lock()
+	defer p.unlock()
+	if err := p.checkOpen(); err != nil {
+		return nil, err
+	}
+	if p.line == nil && p.dir() == DirectionOut {
+		if err := makeWritable(p); err != nil {
+			return nil, err
+		}
+	}
+	u := &UnsafePin{
+		Number: p.Number,
+		f:      p.f,
+		line:   p.line,
+		bufs:   [2][]byte{{'0'}, {'1'}},
+		buf:    make([]byte, 1),
+	}
+	if l, ok := p.line.(*memLine); ok {
+		u.mem = l
+		u.flags = l.currentFlags()
+	}
+	return u, nil
+}
+
+// Write sets the pin to v, which must be 0 or 1
+func (u *UnsafePin) Write(v uint) error {
+	if u.mem != nil {
+		u.mem.drive(u.flags, v)
+		return nil
+	}
+	if u.line != nil {
+		return u.line.setValue(u.f, v)
+	}
+	_, err := u.f.Write(u.bufs[v&1])
+	return err
+}
+
+// Read returns the value of the pin
+func (u *UnsafePin) Read() (uint, error) {
+	if u.line != nil {
+		return u.line.getValue(u.f)
+	}
+	if _, err := u.f.ReadAt(u.buf, 0); err != nil {
+		return 0, fmt.Errorf("failed to read: %s", err)
+	}
+	return uint(u.buf[0] - '0'), nil
+}
+
+// Fd returns the file descriptor of the sysfs value file or of the line request, for system
+// calls of the caller's own. It means nothing on the gpiomem backend.
+func (u *UnsafePin) Fd() uintptr {
+	return u.f.Fd()
+}
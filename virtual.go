@@ -0,0 +1,105 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Transform maps the values of a VirtualPin to and from the pins behind it
+type Transform struct {
+	// Read converts a value read from the input behind the pin. Nil passes values through.
+	Read func(v uint) (uint, error)
+	// Write drives the output behind the pin for v, e.g. with a sequence of writes which
+	// enables a device when v is 1. Nil writes v as it is, which must then be 0 or 1.
+	Write func(out Writer, v uint) error
+}
+
+// VirtualPin is a pin whose reads and writes pass through a Transform, so that code written
+// for a Pin can drive hardware which needs more than a level, without changing that code.
+// It implements InputPin and OutputPin.
+type VirtualPin struct {
+	in        Reader
+	out       Writer
+	transform Transform
+
+	// mu serializes writes, so that the writes of a transform don't interleave
+	mu      sync.Mutex
+	written uint
+	wrote   bool
+}
+
+var (
+	_ InputPin  = (*VirtualPin)(nil)
+	_ OutputPin = (*VirtualPin)(nil)
+)
+
+// NewVirtualPin creates a VirtualPin reading in and writing out through t. Either may be
+// nil: without an input, Read returns the last value written, and without an output the
+// pin can't be written. Both are closed with the pin if they have a Close method.
+func NewVirtualPin(in Reader, out Writer, t Transform) (*VirtualPin, error) {
+	if in == nil && out == nil {
+		return nil, errors.New("virtual pin needs an input or an output")
+	}
+	return &VirtualPin{in: in, out: out, transform: t}, nil
+}
+
+// Read returns the transformed value of the input, or the last value written
+func (v *VirtualPin) Read() (uint, error) {
+	if v.in == nil {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		if !v.wrote {
+			return 0, &PinError{Kind: ErrWrongDirection, Err: errors.New("virtual pin wasn't written yet")}
+		}
+		return v.written, nil
+	}
+	raw, err := v.in.Read()
+	if err != nil {
+		return 0, err
+	}
+	if v.transform.Read == nil {
+		return raw, nil
+	}
+	return v.transform.Read(raw)
+}
+
+// Set writes value through the transform. Values other than 0 and 1 are passed to
+// Transform.Write, e.g. to map a level to a pattern on several pins.
+func (v *VirtualPin) Set(value uint) error {
+	if v.out == nil {
+		return &PinError{Kind: ErrWrongDirection, Err: errors.New("virtual pin has no output")}
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var err error
+	if v.transform.Write != nil {
+		err = v.transform.Write(v.out, value)
+	} else {
+		err = Write(v.out, value)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write virtual pin: %w", err)
+	}
+	v.written, v.wrote = value, true
+	return nil
+}
+
+// High sets the pin to 1
+func (v *VirtualPin) High() error {
+	return v.Set(1)
+}
+
+// Low sets the pin to 0
+func (v *VirtualPin) Low() error {
+	return v.Set(0)
+}
+
+// Close closes the input and output of the pin which can be closed
+func (v *VirtualPin) Close() {
+	for _, p := range []interface{}{v.in, v.out} {
+		if c, ok := p.(interface{ Close() }); ok {
+			c.Close()
+		}
+	}
+}
@@ -2,9 +2,9 @@ package gpio
 
 import (
 	"container/heap"
+	"errors"
 	"fmt"
 	"io"
-	"os"
 	"syscall"
 	"time"
 )
@@ -18,15 +18,36 @@ const (
 )
 
 type watcherCmd struct {
-	pin    Pin
-	action watcherAction
+	pin         Pin
+	action      watcherAction
+	edge        Edge
+	priority    bool
+	emulateBoth bool
 }
 
 // WatcherNotification represents a single pin change
 // The new value of the pin numbered by Pin is Value
+// Simulated is true when Value was set with SimulateInput rather than read from the pin
 type WatcherNotification struct {
-	Pin   uint
-	Value uint
+	Pin       uint
+	Value     uint
+	Simulated bool
+}
+
+// edgeMatches reports whether a change from prev to cur is an edge of kind e
+func edgeMatches(e Edge, prev uint, cur uint) bool {
+	if prev == cur {
+		return false
+	}
+	switch e {
+	case EdgeRising:
+		return cur == 1
+	case EdgeFalling:
+		return cur == 0
+	case EdgeBoth:
+		return true
+	}
+	return false
 }
 
 type fdHeap []uintptr
@@ -57,77 +78,252 @@ func (h fdHeap) FdSet() *syscall.FdSet {
 	return fdset
 }
 
+func fdIsSet(fdset *syscall.FdSet, fd uintptr) bool {
+	return (fdset.Bits[fd/64] & (1 << (uint(fd) % 64))) != 0
+}
+
+// fdSets is a copy of the fd sets of a select, which are changed by a select interrupted
+// by a signal
+type fdSets [3]syscall.FdSet
+
+func selectSets(r *syscall.FdSet, w *syscall.FdSet, e *syscall.FdSet) fdSets {
+	var sets fdSets
+	for i, set := range []*syscall.FdSet{r, w, e} {
+		if set != nil {
+			sets[i] = *set
+		}
+	}
+	return sets
+}
+
+// restore resets the fd sets to the copy
+func (s *fdSets) restore(r *syscall.FdSet, w *syscall.FdSet, e *syscall.FdSet) {
+	for i, set := range []*syscall.FdSet{r, w, e} {
+		if set != nil {
+			*set = s[i]
+		}
+	}
+}
+
+// edgeFdSets returns the read and exception fd sets to select on for edges of pins, and
+// the nfd argument for select. The kernel signals sysfs edges as exceptional conditions,
+// while character device lines become readable when an edge event is queued.
+func edgeFdSets(pins []Pin) (r *syscall.FdSet, e *syscall.FdSet, nfd int) {
+	var rfds, efds fdHeap
+	for _, p := range pins {
+		fd := p.f.Fd()
+		if p.line != nil {
+			rfds = append(rfds, fd)
+		} else {
+			efds = append(efds, fd)
+		}
+		if int(fd) >= nfd {
+			nfd = int(fd) + 1
+		}
+	}
+	return rfds.FdSet(), efds.FdSet(), nfd
+}
+
+// waitForEdge blocks until the kernel reports an edge on the value file of p or timeout elapses.
+// The pending event is only cleared by reading the pin afterwards.
+func waitForEdge(p Pin, timeout time.Duration) (bool, error) {
+	return waitForEdges([]Pin{p}, timeout)
+}
+
+// waitForEdges is like waitForEdge for an edge on any of pins
+func waitForEdges(pins []Pin, timeout time.Duration) (bool, error) {
+	for _, p := range pins {
+		if p.Closed() {
+			return false, errClosed(p.Number)
+		}
+		if err := checkEdges(p); err != nil {
+			return false, err
+		}
+	}
+	rfds, efds, nfd := edgeFdSets(pins)
+	timeval := syscall.NsecToTimeval(int64(timeout))
+	changed, err := doSelect(nfd, rfds, nil, efds, &timeval)
+	if err != nil {
+		return false, fmt.Errorf("failed to call syscall.Select, %s", err)
+	}
+	return changed, nil
+}
+
 const watcherCmdChanLen = 32
+
+// watcherErrorBackoff is how long a Watcher waits after a failed select, so that a lasting
+// failure doesn't spin
+const watcherErrorBackoff = 100 * time.Millisecond
 const notificationLen = 32
 
 // Watcher provides asynchronous notifications on input changes
 // The user should supply it pins to watch with AddPin and then wait for changes with Watch
 // Alternately, users may receive directly from the Notification channel
+// Changes on pins added with AddPriorityPin are handled first and delivered on PriorityNotification
 type Watcher struct {
-	pins         map[uintptr]Pin
-	fds          fdHeap
-	cmdChan      chan watcherCmd
-	Notification chan WatcherNotification
+	pins                 map[uintptr]Pin
+	priority             map[uintptr]bool
+	emulated             map[uintptr]bool
+	sims                 map[uintptr]*simSub
+	fds                  fdHeap
+	cmdChan              chan watcherCmd
+	Notification         chan WatcherNotification
+	PriorityNotification chan WatcherNotification
+	stopped              chan struct{}
 }
 
 // NewWatcher creates a new Watcher instance for asynchronous inputs
 func NewWatcher() *Watcher {
 	w := &Watcher{
-		pins:         make(map[uintptr]Pin),
-		fds:          fdHeap{},
-		cmdChan:      make(chan watcherCmd, watcherCmdChanLen),
-		Notification: make(chan WatcherNotification, notificationLen),
+		pins:                 make(map[uintptr]Pin),
+		priority:             make(map[uintptr]bool),
+		emulated:             make(map[uintptr]bool),
+		sims:                 make(map[uintptr]*simSub),
+		fds:                  fdHeap{},
+		cmdChan:              make(chan watcherCmd, watcherCmdChanLen),
+		Notification:         make(chan WatcherNotification, notificationLen),
+		PriorityNotification: make(chan WatcherNotification, notificationLen),
+		stopped:              make(chan struct{}),
 	}
 	heap.Init(&w.fds)
-	go w.watch()
+	spawn("Watcher", nil, w.watch)
 	return w
 }
 
-func (w *Watcher) notify(fdset *syscall.FdSet) {
+func (w *Watcher) notify(rfds *syscall.FdSet, efds *syscall.FdSet) {
+	// priority pins are read and delivered before all others
+	w.notifyFds(rfds, efds, true)
+	w.notifyFds(rfds, efds, false)
+}
+
+func (w *Watcher) notifyFds(rfds *syscall.FdSet, efds *syscall.FdSet, priority bool) {
 	for _, fd := range w.fds {
-		if (fdset.Bits[fd/64] & (1 << (uint(fd) % 64))) != 0 {
+		if w.priority[fd] != priority {
+			continue
+		}
+		if fdIsSet(rfds, fd) || fdIsSet(efds, fd) {
 			pin := w.pins[fd]
-			val, err := pin.Read()
+			val, err := readPhysical(pin)
 			if err != nil {
 				if err == io.EOF {
 					w.removeFd(fd)
 					continue
 				}
-				fmt.Printf("failed to read pinfile, %s", err)
-				os.Exit(1)
+				// the edge is lost, but a transient error mustn't stop all the other pins
+				logger().Error("failed to read pinfile", "pin", pin.Number, "err", err)
+				continue
 			}
-			msg := WatcherNotification{
-				Pin:   pin.Number,
-				Value: val,
+			ch := w.Notification
+			if priority {
+				ch = w.PriorityNotification
 			}
-			select {
-			case w.Notification <- msg:
+			switch sim, simulated := simulatedInput(pin.Number); {
+			case injectFault(FaultEvent, pin, "value") != nil:
+				// a dropped edge is still re-armed below
+			case simulated:
+				// a simulated input keeps reporting its simulated value
+				sendNotification(ch, WatcherNotification{Pin: pin.Number, Value: sim, Simulated: true})
 			default:
+				send(ch, pin.Number, val)
+			}
+			if w.emulated[fd] {
+				rearmEmulatedEdge(pin, val, ch)
 			}
 		}
 	}
 }
 
+func send(ch chan WatcherNotification, p uint, v uint) {
+	sendNotification(ch, WatcherNotification{
+		Pin:   p,
+		Value: v,
+	})
+}
+
+func sendNotification(ch chan WatcherNotification, msg WatcherNotification) {
+	select {
+	case ch <- msg:
+	default:
+	}
+}
+
+// rearmEmulatedEdge arms the edge opposite to val on a pin which can only trigger on one edge.
+// The pin is read again afterwards, and any change which happened while
+// re-arming is delivered as well, unless the input is simulated.
+func rearmEmulatedEdge(pin Pin, val uint, ch chan WatcherNotification) {
+	for {
+		next := EdgeRising
+		if val == 1 {
+			next = EdgeFalling
+		}
+		if err := setEdgeTrigger(pin, next); err != nil {
+			logger().Error("failed to re-arm emulated edge", "pin", pin.Number, "err", err)
+			return
+		}
+		again, err := readPhysical(pin)
+		if err != nil || again == val {
+			return
+		}
+		val = again
+		if _, ok := simulatedInput(pin.Number); !ok {
+			send(ch, pin.Number, val)
+		}
+	}
+}
+
 func (w *Watcher) fdSelect() {
 	timeval := &syscall.Timeval{
 		Sec:  1,
 		Usec: 0,
 	}
-	fdset := w.fds.FdSet()
-	changed, err := doSelect(int(w.fds[0])+1, nil, nil, fdset, timeval)
+	pins := make([]Pin, 0, len(w.pins))
+	for _, p := range w.pins {
+		pins = append(pins, p)
+	}
+	rfds, efds, nfd := edgeFdSets(pins)
+	changed, err := doSelect(nfd, rfds, nil, efds, timeval)
 	if err != nil {
-		fmt.Printf("failed to call syscall.Select, %s", err)
-		os.Exit(1)
+		// the watcher keeps running, and selects again once a command had a chance to
+		// remove the failing pin
+		logger().Error("failed to call syscall.Select", "err", err)
+		time.Sleep(watcherErrorBackoff)
+		return
 	}
 	if changed {
-		w.notify(fdset)
+		w.notify(rfds, efds)
 	}
 }
 
-func (w *Watcher) addPin(p Pin) {
+func (w *Watcher) addPin(p Pin, edge Edge, priority bool, emulateBoth bool) {
 	fd := p.f.Fd()
 	w.pins[fd] = p
+	if priority {
+		w.priority[fd] = true
+	}
+	if emulateBoth {
+		w.emulated[fd] = true
+	}
 	heap.Push(&w.fds, fd)
+	ch := w.Notification
+	if priority {
+		ch = w.PriorityNotification
+	}
+	w.sims[fd] = subscribeSim(p, func(prev uint, cur uint, simulated bool) {
+		if edgeMatches(edge, prev, cur) {
+			sendNotification(ch, WatcherNotification{Pin: p.Number, Value: cur, Simulated: simulated})
+		}
+	})
+	if p.line != nil {
+		// a sysfs value file reports the initial value through select right away,
+		// other backends only report edges, so the initial value is sent here
+		val, err := readPin(p)
+		if err != nil {
+			logger().Error("failed to read initial value", "pin", p.Number, "err", err)
+			return
+		}
+		_, simulated := simulatedInput(p.Number)
+		sendNotification(ch, WatcherNotification{Pin: p.Number, Value: val, Simulated: simulated})
+	}
 }
 
 func (w *Watcher) removeFd(fd uintptr) {
@@ -138,9 +334,15 @@ func (w *Watcher) removeFd(fd uintptr) {
 			break
 		}
 	}
-	pin := w.pins[fd]
-	pin.f.Close()
+	// closing the pin also releases its claim, so that it can be opened again
+	w.pins[fd].Close()
+	if s := w.sims[fd]; s != nil {
+		s.unsubscribe()
+	}
 	delete(w.pins, fd)
+	delete(w.sims, fd)
+	delete(w.priority, fd)
+	delete(w.emulated, fd)
 }
 
 // removePin is only a wrapper around removeFd
@@ -156,19 +358,36 @@ func (w *Watcher) removePin(p Pin) {
 	}
 }
 
+func (w *Watcher) removeAll() {
+	for fd := range w.pins {
+		w.removeFd(fd)
+	}
+}
+
 func (w *Watcher) doCmd(cmd watcherCmd) (shouldContinue bool) {
 	shouldContinue = true
 	switch cmd.action {
 	case watcherAdd:
-		w.addPin(cmd.pin)
+		w.addPin(cmd.pin, cmd.edge, cmd.priority, cmd.emulateBoth)
+		w.label()
 	case watcherRemove:
 		w.removePin(cmd.pin)
+		w.label()
 	case watcherClose:
 		shouldContinue = false
 	}
 	return shouldContinue
 }
 
+// label updates the profiler labels of the watch goroutine with the pins watched
+func (w *Watcher) label() {
+	pins := make([]uint, 0, len(w.pins))
+	for _, p := range w.pins {
+		pins = append(pins, p.Number)
+	}
+	labelGoroutine("Watcher", pins)
+}
+
 func (w *Watcher) recv() (shouldContinue bool) {
 	for {
 		select {
@@ -185,6 +404,8 @@ func (w *Watcher) recv() (shouldContinue bool) {
 }
 
 func (w *Watcher) watch() {
+	defer close(w.stopped)
+	defer w.removeAll()
 	for {
 		// first we do a syscall.select with timeout if we have any fds to check
 		if len(w.fds) != 0 {
@@ -211,16 +432,68 @@ func (w *Watcher) AddPin(p uint) error {
 // Edges can be configured to be either rising, falling, or both.
 // Logic level can be active high or active low.
 // The pin provided should be the pin known by the kernel.
+// If the pin's controller rejects EdgeBoth, both edges are emulated as with
+// AddPinWithEmulatedBothEdges.
 func (w *Watcher) AddPinWithEdgeAndLogic(p uint, edge Edge, logicLevel LogicLevel) error {
+	return w.addPinCmd(p, edge, logicLevel, false, false)
+}
+
+// AddPinWithEmulatedBothEdges watches a pin for both edges on controllers which can
+// only trigger on a single edge. The watcher arms the edge opposite to the current
+// value and switches between rising and falling after each event.
+// Changes which are faster than the re-arming may be reported late or missed.
+func (w *Watcher) AddPinWithEmulatedBothEdges(p uint, logicLevel LogicLevel) error {
+	return w.addPinCmd(p, EdgeBoth, logicLevel, false, true)
+}
+
+// AddPriorityPin is like AddPin for safety critical inputs such as emergency stops.
+// Changes on priority pins are read before those on other pins and are delivered
+// on PriorityNotification, which Watch always drains first.
+func (w *Watcher) AddPriorityPin(p uint) error {
+	return w.AddPriorityPinWithEdgeAndLogic(p, EdgeBoth, ActiveHigh)
+}
+
+// AddPriorityPinWithEdgeAndLogic is like AddPinWithEdgeAndLogic for priority pins
+func (w *Watcher) AddPriorityPinWithEdgeAndLogic(p uint, edge Edge, logicLevel LogicLevel) error {
+	return w.addPinCmd(p, edge, logicLevel, true, false)
+}
+
+func (w *Watcher) addPinCmd(p uint, edge Edge, logicLevel LogicLevel, priority bool, emulateBoth bool) error {
 	pin, err := NewInput(p)
 	if err != nil {
 		return fmt.Errorf("failed to add pin with edge and logic: %s", err)
 	}
+	if err := checkEdges(pin); err != nil {
+		pin.Close()
+		return err
+	}
 	setLogicLevel(pin, logicLevel)
-	setEdgeTrigger(pin, edge)
+	if edge == EdgeBoth && !emulateBoth {
+		emulateBoth = setEdgeTrigger(pin, edge) != nil
+	}
+	if emulateBoth {
+		val, err := pin.Read()
+		if err != nil {
+			pin.Close()
+			return fmt.Errorf("failed to add pin with emulated edges: %s", err)
+		}
+		next := EdgeRising
+		if val == 1 {
+			next = EdgeFalling
+		}
+		if err := setEdgeTrigger(pin, next); err != nil {
+			pin.Close()
+			return fmt.Errorf("failed to add pin with emulated edges: %s", err)
+		}
+	} else if edge != EdgeBoth {
+		setEdgeTrigger(pin, edge)
+	}
 	w.cmdChan <- watcherCmd{
-		pin:    pin,
-		action: watcherAdd,
+		pin:         pin,
+		action:      watcherAdd,
+		edge:        edge,
+		priority:    priority,
+		emulateBoth: emulateBoth,
 	}
 	return nil
 }
@@ -242,15 +515,59 @@ func (w *Watcher) RemovePin(p uint) {
 // If that happens, it's possible to see consecutive changes with the same value
 // Also, if the input is connected to a mechanical switch, the user of this library must deal with debouncing
 // Users can either use Watch() or receive from Watcher.Notification directly
+// Pending changes on priority pins are always returned before other changes
 func (w *Watcher) Watch() (p uint, v uint) {
-	notification := <-w.Notification
-	return notification.Pin, notification.Value
+	select {
+	case notification := <-w.PriorityNotification:
+		return notification.Pin, notification.Value
+	default:
+	}
+	select {
+	case notification := <-w.PriorityNotification:
+		return notification.Pin, notification.Value
+	case notification := <-w.Notification:
+		return notification.Pin, notification.Value
+	}
 }
 
+const watcherCloseTimeout = 3 * time.Second
+
 // Close stops the watcher and releases all resources
+// It waits for the watcher goroutine to exit, closes the watched pins and discards
+// undelivered notifications. See Shutdown for whether the goroutine stopped in time
 func (w *Watcher) Close() {
-	w.cmdChan <- watcherCmd{
+	if err := w.Shutdown(); err != nil {
+		logger().Error("failed to close watcher", "err", err)
+	}
+}
+
+// Shutdown is like Close and returns an error if the watcher goroutine doesn't stop in time
+func (w *Watcher) Shutdown() error {
+	select {
+	case w.cmdChan <- watcherCmd{
 		pin:    Pin{},
 		action: watcherClose,
+	}:
+	case <-w.stopped:
+	}
+	t := time.NewTimer(watcherCloseTimeout)
+	defer t.Stop()
+	select {
+	case <-w.stopped:
+	case <-t.C:
+		return errors.New("watcher goroutine did not stop")
+	}
+	drainNotifications(w.Notification)
+	drainNotifications(w.PriorityNotification)
+	return nil
+}
+
+func drainNotifications(ch chan WatcherNotification) {
+	for {
+		select {
+		case <-ch:
+		default:
+			return
+		}
 	}
 }
@@ -0,0 +1,51 @@
+package gpio
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+// A failing select is logged, and the Watcher keeps serving its other pins and commands
+func TestWatcherSurvivesSelectErrors(t *testing.T) {
+	m := NewMock()
+	SetMock(m)
+	defer SetMock(nil)
+	w := NewWatcher()
+	if err := w.AddPin(5); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.AddPin(6); err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < 2; n++ {
+		select {
+		case <-w.Notification:
+		case <-time.After(3 * time.Second):
+			t.Fatal("no initial values")
+		}
+	}
+	// closing the file behind the watcher's back makes its selects fail with EBADF
+	var broken Pin
+	for _, p := range w.pins {
+		if p.Number == 5 {
+			broken = p
+		}
+	}
+	syscall.Close(int(broken.f.Fd()))
+	time.Sleep(3 * watcherErrorBackoff)
+	w.RemovePin(5)
+	time.Sleep(3 * watcherErrorBackoff)
+	m.SetInput(6, 1)
+	select {
+	case n := <-w.Notification:
+		if n.Pin != 6 || n.Value != 1 {
+			t.Fatalf("got %+v, want gpio 6 at 1", n)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("the watcher stopped after a failed select")
+	}
+	if err := w.Shutdown(); err != nil {
+		t.Fatal(err)
+	}
+}
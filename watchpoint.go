@@ -0,0 +1,136 @@
+package gpio
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WatchMode selects the writes a watchpoint records
+type WatchMode uint
+
+const (
+	// WatchWrites records every write to the pin
+	WatchWrites WatchMode = iota
+	// WatchChanges only records the writes which changed the value last written
+	WatchChanges
+)
+
+// watchpointHits is the number of hits kept per watchpoint, older ones are discarded
+const watchpointHits = 64
+
+// WatchpointHit is a write recorded by a watchpoint
+type WatchpointHit struct {
+	Pin   uint
+	Value uint
+	Time  time.Time
+	// Stack is the stack trace of the goroutine which wrote the pin
+	Stack string
+}
+
+type watchpoint struct {
+	mode  WatchMode
+	hits  []WatchpointHit
+	last  uint
+	known bool
+}
+
+var (
+	// watchpointsSet is the number of watchpoints, kept so that writes don't lock without any
+	watchpointsSet int32
+
+	watchpointMu sync.Mutex
+	watchpoints  = make(map[uint]*watchpoint)
+)
+
+// SetWatchpoint records the writes to pin with the stack trace of the writer, for tracking
+// down which code path drives a line unexpectedly. The last 64 hits are kept, see
+// WatchpointHits and DumpWatchpoints. Writes of all pin copies and helpers are recorded,
+// except those held back by dry runs, and a WriteBatch is recorded once with its last value.
+// Capturing stacks is slow, so watchpoints are only meant for debugging.
+// Setting a watchpoint again changes its mode and clears its hits.
+func SetWatchpoint(pin uint, mode WatchMode) {
+	watchpointMu.Lock()
+	defer watchpointMu.Unlock()
+	watchpoints[pin] = &watchpoint{mode: mode}
+	atomic.StoreInt32(&watchpointsSet, int32(len(watchpoints)))
+}
+
+// ClearWatchpoint removes the watchpoint of pin and its hits
+func ClearWatchpoint(pin uint) {
+	watchpointMu.Lock()
+	defer watchpointMu.Unlock()
+	delete(watchpoints, pin)
+	atomic.StoreInt32(&watchpointsSet, int32(len(watchpoints)))
+}
+
+// WatchpointHits returns the writes recorded by the watchpoint of pin, oldest first
+func WatchpointHits(pin uint) []WatchpointHit {
+	watchpointMu.Lock()
+	defer watchpointMu.Unlock()
+	w, ok := watchpoints[pin]
+	if !ok {
+		return nil
+	}
+	return append([]WatchpointHit(nil), w.hits...)
+}
+
+// DumpWatchpoints writes the hits of all watchpoints to w, by pin and oldest first
+func DumpWatchpoints(w io.Writer) error {
+	watchpointMu.Lock()
+	pins := make([]uint, 0, len(watchpoints))
+	for pin := range watchpoints {
+		pins = append(pins, pin)
+	}
+	sort.Slice(pins, func(i, j int) bool { return pins[i] < pins[j] })
+	var hits []WatchpointHit
+	for _, pin := range pins {
+		hits = append(hits, watchpoints[pin].hits...)
+	}
+	watchpointMu.Unlock()
+	for _, h := range hits {
+		_, err := fmt.Fprintf(w, "gpio %d written %d at %s\n%s\n", h.Pin, h.Value, h.Time.Format(time.RFC3339Nano), h.Stack)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// watchWrite records a write to p if it has a watchpoint
+func watchWrite(p Pin, v uint) {
+	if atomic.LoadInt32(&watchpointsSet) == 0 {
+		return
+	}
+	now := time.Now()
+	watchpointMu.Lock()
+	w, ok := watchpoints[p.Number]
+	if !ok {
+		watchpointMu.Unlock()
+		return
+	}
+	changed := !w.known || w.last != v
+	w.last, w.known = v, true
+	watchpointMu.Unlock()
+	if w.mode == WatchChanges && !changed {
+		return
+	}
+	buf := make([]byte, 4096)
+	buf = buf[:runtime.Stack(buf, false)]
+	hit := WatchpointHit{Pin: p.Number, Value: v, Time: now, Stack: string(buf)}
+	watchpointMu.Lock()
+	defer watchpointMu.Unlock()
+	// the watchpoint may have been replaced meanwhile
+	if watchpoints[p.Number] != w {
+		return
+	}
+	if len(w.hits) == watchpointHits {
+		copy(w.hits, w.hits[1:])
+		w.hits = w.hits[:len(w.hits)-1]
+	}
+	w.hits = append(w.hits, hit)
+}
@@ -0,0 +1,218 @@
+package gpio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// WearAlert is called once when the switch count of an output reaches its threshold.
+// It is called from the goroutine writing the output, so it must not block.
+type WearAlert func(pin uint, count uint64)
+
+// WearCounter counts how often outputs switched, e.g. to schedule the maintenance of relays
+// and contactors before they fail. The counts are kept in a file so that they accumulate
+// over the life of the hardware, and are saved at most once every save interval while
+// outputs are switching, as well as by Save and Close. Writes never wait for the file: the
+// periodic saves are made in the background.
+type WearCounter struct {
+	path         string
+	saveInterval time.Duration
+	kick         chan struct{}
+	done         chan struct{}
+	stopped      chan struct{}
+	closeOnce    sync.Once
+
+	// saveMu serializes the saves, which write the file without holding mu
+	saveMu     sync.Mutex
+	mu         sync.Mutex
+	counts     map[uint]uint64
+	thresholds map[uint]uint64
+	alert      WearAlert
+	dirty      bool
+	saved      time.Time
+}
+
+// wearTrack follows the value of one output tracked by a WearCounter
+type wearTrack struct {
+	counter *WearCounter
+	mu      sync.Mutex
+	last    uint
+}
+
+// NewWearCounter loads the counts kept in path, which is created on the first save if it
+// doesn't exist yet
+func NewWearCounter(path string, saveInterval time.Duration) (*WearCounter, error) {
+	w := &WearCounter{
+		path:         path,
+		saveInterval: saveInterval,
+		counts:       make(map[uint]uint64),
+		thresholds:   make(map[uint]uint64),
+		saved:        time.Now(),
+		kick:         make(chan struct{}, 1),
+		done:         make(chan struct{}),
+		stopped:      make(chan struct{}),
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read wear counts: %s", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, &w.counts); err != nil {
+			return nil, fmt.Errorf("failed to parse wear counts in %s: %s", path, err)
+		}
+	}
+	spawn("WearCounter", nil, w.run)
+	return w, nil
+}
+
+// run makes the saves requested by count
+func (w *WearCounter) run() {
+	defer close(w.stopped)
+	for {
+		select {
+		case <-w.kick:
+			if err := w.Save(); err != nil {
+				logger().Error("failed to save wear counts", "err", err)
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// SetAlert installs fn to be called when an output reaches its threshold. Passing nil disables it.
+// Reaching a threshold is also logged as a warning.
+func (w *WearCounter) SetAlert(fn WearAlert) {
+	w.mu.Lock()
+	w.alert = fn
+	w.mu.Unlock()
+}
+
+// Track returns a copy of an output pin whose value changes are counted, written through
+// High, Low, Toggle or WriteTimeout. threshold is the count at which the alert fires, 0 for none.
+func (w *WearCounter) Track(p Pin, threshold uint64) (Pin, error) {
+	if p.dir() != DirectionOut {
+		return Pin{}, errWrongDirection(p, DirectionOut)
+	}
+	v, err := readPin(p)
+	if err != nil {
+		return Pin{}, err
+	}
+	w.mu.Lock()
+	w.thresholds[p.Number] = threshold
+	w.mu.Unlock()
+	p.wear = &wearTrack{counter: w, last: v}
+	return p, nil
+}
+
+// written counts a successful write of v
+func (t *wearTrack) written(pin uint, v uint) {
+	t.mu.Lock()
+	changed := v != t.last
+	t.last = v
+	t.mu.Unlock()
+	if changed {
+		t.counter.count(pin)
+	}
+}
+
+func (w *WearCounter) count(pin uint) {
+	w.mu.Lock()
+	w.counts[pin]++
+	n := w.counts[pin]
+	w.dirty = true
+	var alert WearAlert
+	if threshold := w.thresholds[pin]; threshold != 0 && n == threshold {
+		alert = w.alert
+		logger().Warn("output reached its switch count threshold", "pin", pin, "count", n)
+	}
+	save := time.Since(w.saved) >= w.saveInterval
+	w.mu.Unlock()
+	if save {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+			// a save is pending already
+		}
+	}
+	if alert != nil {
+		alert(pin, n)
+	}
+}
+
+// Count returns how often the output switched
+func (w *WearCounter) Count(pin uint) uint64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.counts[pin]
+}
+
+// Reset sets the count of an output back to 0, e.g. after its relay was replaced
+func (w *WearCounter) Reset(pin uint) error {
+	w.mu.Lock()
+	delete(w.counts, pin)
+	w.dirty = true
+	w.mu.Unlock()
+	return w.Save()
+}
+
+// Save writes the counts to the file if they changed since the last save
+func (w *WearCounter) Save() error {
+	w.saveMu.Lock()
+	defer w.saveMu.Unlock()
+	w.mu.Lock()
+	if !w.dirty {
+		w.mu.Unlock()
+		return nil
+	}
+	b, err := json.Marshal(w.counts)
+	// the counts changing while the file is written make the next save write them
+	w.dirty = false
+	w.saved = time.Now()
+	w.mu.Unlock()
+	if err == nil {
+		err = w.writeFile(b)
+	}
+	if err != nil {
+		w.mu.Lock()
+		w.dirty = true
+		w.mu.Unlock()
+	}
+	return err
+}
+
+// writeFile replaces the file through a rename, so that a crash never leaves it truncated
+func (w *WearCounter) writeFile(b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(w.path), filepath.Base(w.path)+".tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save wear counts: %s", err)
+	}
+	_, err = tmp.Write(b)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), w.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("failed to save wear counts: %s", err)
+	}
+	return nil
+}
+
+// Close stops the background saves and saves the counts. Tracked pins keep counting, but
+// are only saved by another Save. Closing it again only saves the counts.
+func (w *WearCounter) Close() error {
+	w.closeOnce.Do(func() { close(w.done) })
+	<-w.stopped
+	return w.Save()
+}
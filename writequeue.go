@@ -0,0 +1,168 @@
+package gpio
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// WritePriority selects how a queued write is scheduled
+type WritePriority uint
+
+const (
+	PriorityNormal WritePriority = iota
+	PriorityUrgent
+)
+
+// ErrQueueFull is returned by WriteQueue.Write when the queue can't take more writes
+var ErrQueueFull = errors.New("write queue is full")
+
+// ErrQueueClosed is returned by WriteQueue.Write after Close
+var ErrQueueClosed = errors.New("write queue is closed")
+
+// WriteQueue applies writes to a single output pin asynchronously and in order,
+// so that callers never block on the kernel.
+// Urgent writes are applied before any pending normal writes, which are discarded
+// so that they can't undo the urgent state. A write equal to the last queued
+// value is coalesced with it.
+type WriteQueue struct {
+	pin  Pin
+	size int
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	normal  []uint
+	urgent  []uint
+	busy    bool
+	closed  bool
+	last    uint
+	hasLast bool
+	err     error
+	done    chan struct{}
+}
+
+// NewWriteQueue starts a queue for the given output pin which holds at most size pending writes
+func NewWriteQueue(p Pin, size int) (*WriteQueue, error) {
+	if p.dir() != DirectionOut {
+		return nil, errWrongDirection(p, DirectionOut)
+	}
+	if size < 1 {
+		return nil, fmt.Errorf("invalid write queue size %d", size)
+	}
+	q := &WriteQueue{
+		pin:  p,
+		size: size,
+		done: make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mu)
+	spawn("WriteQueue", []uint{p.Number}, q.run)
+	return q, nil
+}
+
+// Write queues v to be written to the pin and returns immediately
+func (q *WriteQueue) Write(v uint, priority WritePriority) error {
+	if v > 1 {
+		return errInvalidValue(q.pin.Number, v)
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+
+	switch priority {
+	case PriorityUrgent:
+		q.normal = q.normal[:0]
+		if n := len(q.urgent); n > 0 && q.urgent[n-1] == v {
+			return nil
+		}
+		if len(q.urgent) >= q.size {
+			return ErrQueueFull
+		}
+		q.urgent = append(q.urgent, v)
+	case PriorityNormal:
+		if last, ok := q.lastQueued(); ok && last == v {
+			return nil
+		}
+		if len(q.normal)+len(q.urgent) >= q.size {
+			return ErrQueueFull
+		}
+		q.normal = append(q.normal, v)
+	default:
+		return fmt.Errorf("invalid write priority %d", priority)
+	}
+	q.cond.Broadcast()
+	return nil
+}
+
+// lastQueued returns the value the pin will have once the queue drains, if it is known
+func (q *WriteQueue) lastQueued() (uint, bool) {
+	if n := len(q.normal); n > 0 {
+		return q.normal[n-1], true
+	}
+	if n := len(q.urgent); n > 0 {
+		return q.urgent[n-1], true
+	}
+	return q.last, q.hasLast
+}
+
+func (q *WriteQueue) next() (v uint, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.urgent) == 0 && len(q.normal) == 0 {
+		q.busy = false
+		q.cond.Broadcast()
+		if q.closed {
+			return 0, false
+		}
+		q.cond.Wait()
+	}
+	q.busy = true
+	if len(q.urgent) != 0 {
+		v, q.urgent = q.urgent[0], q.urgent[1:]
+	} else {
+		v, q.normal = q.normal[0], q.normal[1:]
+	}
+	q.last = v
+	q.hasLast = true
+	return v, true
+}
+
+func (q *WriteQueue) run() {
+	defer close(q.done)
+	for {
+		v, ok := q.next()
+		if !ok {
+			return
+		}
+		err := Write(q.pin, v)
+		q.mu.Lock()
+		if err != nil && q.err == nil {
+			q.err = err
+		}
+		q.mu.Unlock()
+	}
+}
+
+// Flush blocks until all queued writes have been applied
+func (q *WriteQueue) Flush() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.busy || len(q.urgent) != 0 || len(q.normal) != 0 {
+		q.cond.Wait()
+	}
+}
+
+// Close applies the pending writes, stops the queue and returns the first write error, if any.
+// The pin itself is left open.
+func (q *WriteQueue) Close() error {
+	q.mu.Lock()
+	q.closed = true
+	q.cond.Broadcast()
+	q.mu.Unlock()
+	<-q.done
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.err
+}